@@ -0,0 +1,169 @@
+package apperror
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// Codes clients can rely on, the message next to them is meant for humans and may change
+const (
+	CodeValidation      = "validation_failed"
+	CodeUnauthorized    = "unauthorized"
+	CodeForbidden       = "forbidden"
+	CodeNotFound        = "not_found"
+	CodeConflict        = "conflict"
+	CodeTooManyRequests = "too_many_requests"
+	CodeInternal        = "internal_error"
+)
+
+// Error is a failure the API reports to its client. Cause is only logged, never sent.
+type Error struct {
+	Status  int
+	Code    string
+	Message string
+	Details []FieldError
+	Cause   error
+}
+
+// FieldError tells which field of the request was rejected and why
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	if e.Cause != nil {
+		return e.Message + ": " + e.Cause.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Cause
+}
+
+// WithCode replaces the generic code with a more specific one, like "two_factor_required"
+func (e *Error) WithCode(code string) *Error {
+	e.Code = code
+	return e
+}
+
+// Body is the JSON envelope every error response uses. "error" keeps holding the message,
+// as it always did, so that existing clients go on working.
+func (e *Error) Body() map[string]interface{} {
+	body := map[string]interface{}{"error": e.Message, "code": e.Code}
+	if len(e.Details) > 0 {
+		body["details"] = e.Details
+	}
+	return body
+}
+
+func Validation(message string, details ...FieldError) *Error {
+	return &Error{Status: http.StatusBadRequest, Code: CodeValidation, Message: message, Details: details}
+}
+
+func Unauthorized(message string) *Error {
+	return &Error{Status: http.StatusUnauthorized, Code: CodeUnauthorized, Message: message}
+}
+
+func Forbidden(message string) *Error {
+	return &Error{Status: http.StatusForbidden, Code: CodeForbidden, Message: message}
+}
+
+func NotFound(message string) *Error {
+	return &Error{Status: http.StatusNotFound, Code: CodeNotFound, Message: message}
+}
+
+func Conflict(message string) *Error {
+	return &Error{Status: http.StatusConflict, Code: CodeConflict, Message: message}
+}
+
+func TooManyRequests(message string) *Error {
+	return &Error{Status: http.StatusTooManyRequests, Code: CodeTooManyRequests, Message: message}
+}
+
+// Internal reports a failure that is not the client's fault, cause is logged
+func Internal(message string, cause error) *Error {
+	return &Error{Status: http.StatusInternalServerError, Code: CodeInternal, Message: message, Cause: cause}
+}
+
+// Invalid turns an error from binding or validating a request into a validation error,
+// with one detail per rejected field when the validator says which
+func Invalid(err error) *Error {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr
+	}
+
+	var fieldErrors validator.ValidationErrors
+	if errors.As(err, &fieldErrors) {
+		details := make([]FieldError, len(fieldErrors))
+		for i, fieldErr := range fieldErrors {
+			details[i] = FieldError{Field: fieldErr.Field(), Message: describe(fieldErr)}
+		}
+		return Validation("the request is invalid", details...)
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return Validation("the request is invalid", FieldError{Field: typeErr.Field, Message: "must be " + kindName(typeErr.Type)})
+	}
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		return Validation("the request body is not valid JSON")
+	}
+	return Validation(err.Error())
+}
+
+func kindName(t reflect.Type) string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return "true or false"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.String:
+		return "a string"
+	case reflect.Slice, reflect.Array:
+		return "a list"
+	}
+	return "an object"
+}
+
+func describe(fieldErr validator.FieldError) string {
+	switch fieldErr.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "min":
+		return "must be at least " + fieldErr.Param()
+	case "max":
+		return "must be at most " + fieldErr.Param()
+	case "len":
+		return "must have a length of " + fieldErr.Param()
+	case "eq":
+		return "must be " + fieldErr.Param()
+	case "oneof":
+		return "must be one of " + strings.Join(strings.Fields(fieldErr.Param()), ", ")
+	case "numeric":
+		return "must contain only digits"
+	case "clock":
+		return "must be a time of day like 07:30"
+	case "timezone":
+		return "must be a time zone like Europe/Paris"
+	}
+	if fieldErr.Param() != "" {
+		return fmt.Sprintf("failed the %s=%s rule", fieldErr.Tag(), fieldErr.Param())
+	}
+	return fmt.Sprintf("failed the %s rule", fieldErr.Tag())
+}
@@ -0,0 +1,110 @@
+package apperror
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/PranavMasekar/restaurant-management/repository"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+type signup struct {
+	Email *string `json:"email" validate:"required,email"`
+	Name  string  `json:"name" validate:"min=2"`
+	Role  string  `json:"role" validate:"oneof=WAITER CASHIER"`
+	Age   int     `json:"age"`
+}
+
+func TestInvalid(t *testing.T) {
+	email := "not-an-email"
+	validationErr := validator.New().Struct(signup{Email: &email, Name: "A", Role: "CHEF"})
+	var typeErr, syntaxErr error
+	var body signup
+	typeErr = json.Unmarshal([]byte(`{"age":"ten"}`), &body)
+	syntaxErr = json.Unmarshal([]byte(`{"age":`), &body)
+	conflict := Conflict("taken")
+
+	tests := []struct {
+		name    string
+		err     error
+		message string
+		details []FieldError
+	}{
+		{"validator", validationErr, "the request is invalid", []FieldError{
+			{"Email", "must be a valid email address"},
+			{"Name", "must be at least 2"},
+			{"Role", "must be one of WAITER, CASHIER"},
+		}},
+		{"wrong type", typeErr, "the request is invalid", []FieldError{{"age", "must be a number"}}},
+		{"malformed JSON", syntaxErr, "the request body is not valid JSON", nil},
+		{"other error", errors.New("status must be active"), "status must be active", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Invalid(tt.err)
+			if got.Status != http.StatusBadRequest || got.Code != CodeValidation || got.Message != tt.message {
+				t.Fatalf("Invalid() = %d %s %q, want 400 %s %q", got.Status, got.Code, got.Message, CodeValidation, tt.message)
+			}
+			if fmt.Sprint(got.Details) != fmt.Sprint(tt.details) {
+				t.Fatalf("details = %v, want %v", got.Details, tt.details)
+			}
+		})
+	}
+	// Errors that already are API errors keep their status
+	if got := Invalid(fmt.Errorf("binding: %w", conflict)); got != conflict {
+		t.Fatalf("Invalid() of a wrapped conflict = %v, want the conflict", got)
+	}
+}
+
+func TestRespond(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		body   string
+		logs   string
+	}{
+		{"api error", Forbidden("not yours"), http.StatusForbidden, `{"code":"forbidden","error":"not yours"}`, "not yours"},
+		{"specific code", Unauthorized("code needed").WithCode("two_factor_required"), http.StatusUnauthorized, `{"code":"two_factor_required","error":"code needed"}`, "code needed"},
+		{"details", Validation("the request is invalid", FieldError{"email", "is required"}), http.StatusBadRequest,
+			`{"code":"validation_failed","details":[{"field":"email","message":"is required"}],"error":"the request is invalid"}`, "the request is invalid"},
+		{"missing document", fmt.Errorf("find food: %w", repository.ErrNotFound), http.StatusNotFound, `{"code":"not_found","error":"the resource was not found"}`, "not found"},
+		{"no mongo document", mongo.ErrNoDocuments, http.StatusNotFound, `{"code":"not_found","error":"the resource was not found"}`, "not found"},
+		// The cause of internal errors is logged, never sent
+		{"unknown error", errors.New("connection refused by 10.0.0.7"), http.StatusInternalServerError, `{"code":"internal_error","error":"something went wrong, please try again"}`, "connection refused by 10.0.0.7"},
+		{"internal error", Internal("listing failed", errors.New("cursor died")), http.StatusInternalServerError, `{"code":"internal_error","error":"listing failed"}`, "listing failed: cursor died"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logged []*gin.Error
+			router := gin.New()
+			router.GET("/", func(ctx *gin.Context) {
+				Respond(ctx, tt.err)
+				logged = ctx.Errors
+			}, func(ctx *gin.Context) {
+				t.Fatal("the handlers after Respond ran")
+			})
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			if rec.Code != tt.status || strings.TrimSpace(rec.Body.String()) != tt.body {
+				t.Fatalf("response = %d %s, want %d %s", rec.Code, rec.Body.String(), tt.status, tt.body)
+			}
+			// The request logger reports the error, with its cause
+			if len(logged) != 1 || !strings.Contains(logged[0].Error(), tt.logs) {
+				t.Fatalf("logged %v, want an error containing %q", logged, tt.logs)
+			}
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package apperror
+
+import (
+	"errors"
+
+	"github.com/PranavMasekar/restaurant-management/repository"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Respond aborts the request with the envelope of err. Unknown errors become internal errors
+// whose text is only logged, documents that do not exist become not found errors.
+func Respond(ctx *gin.Context, err error) {
+	appErr := From(err)
+	// The request logger reports it along with the status
+	ctx.Error(appErr)
+	ctx.AbortWithStatusJSON(appErr.Status, appErr.Body())
+}
+
+// From returns err as an *Error, classifying the errors of the lower layers
+func From(err error) *Error {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr
+	}
+	if errors.Is(err, repository.ErrNotFound) || errors.Is(err, mongo.ErrNoDocuments) {
+		return NotFound("the resource was not found")
+	}
+	return Internal("something went wrong, please try again", err)
+}
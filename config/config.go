@@ -0,0 +1,441 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/PranavMasekar/restaurant-management/models"
+	"gopkg.in/yaml.v2"
+)
+
+// Config holds every setting of the service. Values are applied in this order, later ones
+// winning: the defaults, the YAML or TOML file named by -config or CONFIG_FILE, the
+// environment variables and the command line flags.
+type Config struct {
+	Port         string  `yaml:"port" toml:"port"`
+	Log_level    string  `yaml:"log_level" toml:"log_level"`
+	App_base_url string  `yaml:"app_base_url" toml:"app_base_url"`
+	Currency     string  `yaml:"currency" toml:"currency"`
+	Mongo        Mongo   `yaml:"mongo" toml:"mongo"`
+	Http         Http    `yaml:"http" toml:"http"`
+	Auth         Auth    `yaml:"auth" toml:"auth"`
+	Cors         Cors    `yaml:"cors" toml:"cors"`
+	Mail         Mail    `yaml:"mail" toml:"mail"`
+	Tracing      Tracing `yaml:"tracing" toml:"tracing"`
+}
+
+type Mongo struct {
+	Uri      string `yaml:"uri" toml:"uri"`
+	Database string `yaml:"database" toml:"database"`
+	// Time allowed to connect to the cluster at startup
+	Connect_timeout time.Duration `yaml:"connect_timeout" toml:"connect_timeout"`
+	// Pings tried at startup before giving up, waiting longer after each failure
+	Startup_attempts int `yaml:"startup_attempts" toml:"startup_attempts"`
+	// Time a health check waits for the ping
+	Ping_timeout time.Duration `yaml:"ping_timeout" toml:"ping_timeout"`
+}
+
+type Http struct {
+	Read_timeout  time.Duration `yaml:"read_timeout" toml:"read_timeout"`
+	Write_timeout time.Duration `yaml:"write_timeout" toml:"write_timeout"`
+	Idle_timeout  time.Duration `yaml:"idle_timeout" toml:"idle_timeout"`
+	// Time a handler may spend on its database calls
+	Request_timeout time.Duration `yaml:"request_timeout" toml:"request_timeout"`
+	// Time in-flight requests get to finish once the process is asked to stop
+	Shutdown_timeout time.Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+	// IPs or CIDRs of the proxies whose X-Forwarded-For header gives the client IP. Empty trusts
+	// none and uses the peer address, which the login and reset throttles rely on.
+	Trusted_proxies []string `yaml:"trusted_proxies" toml:"trusted_proxies"`
+}
+
+type Auth struct {
+	Secret_key        string        `yaml:"secret_key" toml:"secret_key"`
+	Hmac_kid          string        `yaml:"hmac_kid" toml:"hmac_kid"`
+	Keys_dir          string        `yaml:"keys_dir" toml:"keys_dir"`
+	Active_kid        string        `yaml:"active_kid" toml:"active_kid"`
+	Access_token_ttl  time.Duration `yaml:"access_token_ttl" toml:"access_token_ttl"`
+	Refresh_token_ttl time.Duration `yaml:"refresh_token_ttl" toml:"refresh_token_ttl"`
+	Pin_token_ttl     time.Duration `yaml:"pin_token_ttl" toml:"pin_token_ttl"`
+	// Accept the raw token in the "token" header next to "Authorization: Bearer"
+	Legacy_token_header bool     `yaml:"legacy_token_header" toml:"legacy_token_header"`
+	Totp_issuer         string   `yaml:"totp_issuer" toml:"totp_issuer"`
+	Totp_required_roles []string `yaml:"totp_required_roles" toml:"totp_required_roles"`
+}
+
+type Cors struct {
+	// Empty disables CORS, "*" allows any origin
+	Allowed_origins   []string      `yaml:"allowed_origins" toml:"allowed_origins"`
+	Allowed_methods   []string      `yaml:"allowed_methods" toml:"allowed_methods"`
+	Allowed_headers   []string      `yaml:"allowed_headers" toml:"allowed_headers"`
+	Allow_credentials bool          `yaml:"allow_credentials" toml:"allow_credentials"`
+	Max_age           time.Duration `yaml:"max_age" toml:"max_age"`
+}
+
+type Mail struct {
+	// "smtp" sends real mail, anything else writes messages to Log_file or the application log
+	Driver        string `yaml:"driver" toml:"driver"`
+	From          string `yaml:"from" toml:"from"`
+	Log_file      string `yaml:"log_file" toml:"log_file"`
+	Smtp_host     string `yaml:"smtp_host" toml:"smtp_host"`
+	Smtp_port     string `yaml:"smtp_port" toml:"smtp_port"`
+	Smtp_username string `yaml:"smtp_username" toml:"smtp_username"`
+	Smtp_password string `yaml:"smtp_password" toml:"smtp_password"`
+}
+
+type Tracing struct {
+	// "otlp" sends spans to an OpenTelemetry collector over HTTP, "stdout" prints them, "none" disables tracing
+	Exporter string `yaml:"exporter" toml:"exporter"`
+	// Collector URL like http://otel-collector:4318, the exporter default when empty
+	Endpoint     string `yaml:"endpoint" toml:"endpoint"`
+	Service_name string `yaml:"service_name" toml:"service_name"`
+	// Share of the traces started here that are kept, between 0 and 1
+	Sample_ratio float64 `yaml:"sample_ratio" toml:"sample_ratio"`
+}
+
+// Minimum length of an HS256 secret, RFC 7518 asks for at least the size of the hash
+const MinSecretLength = 32
+
+var logLevels = []string{"debug", "info", "warn", "error"}
+
+var traceExporters = []string{"none", "stdout", "otlp"}
+
+var currencyCode = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// Default returns the settings used when nothing else is configured
+func Default() *Config {
+	return &Config{
+		Port:      "8000",
+		Log_level: "info",
+		Currency:  "USD",
+		Mongo: Mongo{
+			Database:         "restaurant",
+			Connect_timeout:  10 * time.Second,
+			Startup_attempts: 8,
+			Ping_timeout:     2 * time.Second,
+		},
+		Http: Http{
+			Read_timeout:     15 * time.Second,
+			Write_timeout:    2 * time.Minute,
+			Idle_timeout:     60 * time.Second,
+			Request_timeout:  100 * time.Second,
+			Shutdown_timeout: 30 * time.Second,
+		},
+		Auth: Auth{
+			Hmac_kid:            "hs256",
+			Access_token_ttl:    24 * time.Hour,
+			Refresh_token_ttl:   168 * time.Hour,
+			Pin_token_ttl:       15 * time.Minute,
+			Legacy_token_header: true,
+			Totp_issuer:         "Restaurant",
+			Totp_required_roles: []string{models.RoleAdmin, models.RoleManager},
+		},
+		Cors: Cors{
+			Allowed_methods: []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+			Allowed_headers: []string{"Authorization", "Content-Type", "token", "X-Request-ID"},
+			Max_age:         12 * time.Hour,
+		},
+		Mail: Mail{
+			From:      "no-reply@restaurant.local",
+			Smtp_port: "587",
+		},
+		Tracing: Tracing{
+			Exporter:     "none",
+			Service_name: "restaurant-management",
+			Sample_ratio: 1,
+		},
+	}
+}
+
+// Load builds the configuration from the command line arguments, the file they or
+// CONFIG_FILE point to and the environment, then validates it
+func Load(args []string) (*Config, error) {
+	flags := flag.NewFlagSet("restaurant-management", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	path := flags.String("config", os.Getenv("CONFIG_FILE"), "YAML or TOML configuration file")
+	port := flags.String("port", "", "port to listen on")
+	mongoUri := flags.String("mongo-uri", "", "MongoDB connection string")
+	mongoDatabase := flags.String("mongo-database", "", "MongoDB database name")
+	logLevel := flags.String("log-level", "", "one of debug, info, warn, error")
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	cfg := Default()
+	if *path != "" {
+		if err := cfg.loadFile(*path); err != nil {
+			return nil, err
+		}
+	}
+	if err := cfg.loadEnv(); err != nil {
+		return nil, err
+	}
+
+	flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "port":
+			cfg.Port = *port
+		case "mongo-uri":
+			cfg.Mongo.Uri = *mongoUri
+		case "mongo-database":
+			cfg.Mongo.Database = *mongoDatabase
+		case "log-level":
+			cfg.Log_level = *logLevel
+		}
+	})
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (cfg *Config) loadFile(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.UnmarshalStrict(data, cfg)
+	case ".toml":
+		var meta toml.MetaData
+		meta, err = toml.Decode(string(data), cfg)
+		if err == nil && len(meta.Undecoded()) > 0 {
+			err = fmt.Errorf("unknown setting %q", meta.Undecoded()[0].String())
+		}
+	default:
+		return fmt.Errorf("%s: configuration files must be .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	return nil
+}
+
+// loadEnv applies the environment variables the service always read, so existing
+// deployments keep working
+func (cfg *Config) loadEnv() error {
+	env := environment{}
+	env.string("PORT", &cfg.Port)
+	env.string("LOG_LEVEL", &cfg.Log_level)
+	env.string("APP_BASE_URL", &cfg.App_base_url)
+	env.string("CURRENCY", &cfg.Currency)
+
+	env.string("MONGODB_URI", &cfg.Mongo.Uri)
+	env.string("MONGODB_DATABASE", &cfg.Mongo.Database)
+	env.duration("MONGODB_CONNECT_TIMEOUT", &cfg.Mongo.Connect_timeout)
+	env.int("MONGODB_STARTUP_ATTEMPTS", &cfg.Mongo.Startup_attempts)
+	env.duration("MONGODB_PING_TIMEOUT", &cfg.Mongo.Ping_timeout)
+
+	env.duration("HTTP_READ_TIMEOUT", &cfg.Http.Read_timeout)
+	env.duration("HTTP_WRITE_TIMEOUT", &cfg.Http.Write_timeout)
+	env.duration("HTTP_IDLE_TIMEOUT", &cfg.Http.Idle_timeout)
+	env.duration("HTTP_REQUEST_TIMEOUT", &cfg.Http.Request_timeout)
+	env.duration("HTTP_SHUTDOWN_TIMEOUT", &cfg.Http.Shutdown_timeout)
+	env.list("TRUSTED_PROXIES", &cfg.Http.Trusted_proxies)
+
+	env.string("SECRET_KEY", &cfg.Auth.Secret_key)
+	env.string("JWT_HMAC_KID", &cfg.Auth.Hmac_kid)
+	env.string("JWT_KEYS_DIR", &cfg.Auth.Keys_dir)
+	env.string("JWT_ACTIVE_KID", &cfg.Auth.Active_kid)
+	env.duration("ACCESS_TOKEN_TTL", &cfg.Auth.Access_token_ttl)
+	env.duration("REFRESH_TOKEN_TTL", &cfg.Auth.Refresh_token_ttl)
+	env.duration("PIN_TOKEN_TTL", &cfg.Auth.Pin_token_ttl)
+	env.bool("AUTH_LEGACY_TOKEN_HEADER", &cfg.Auth.Legacy_token_header)
+	env.string("TOTP_ISSUER", &cfg.Auth.Totp_issuer)
+	env.list("TOTP_REQUIRED_ROLES", &cfg.Auth.Totp_required_roles)
+
+	env.list("CORS_ALLOWED_ORIGINS", &cfg.Cors.Allowed_origins)
+	env.list("CORS_ALLOWED_METHODS", &cfg.Cors.Allowed_methods)
+	env.list("CORS_ALLOWED_HEADERS", &cfg.Cors.Allowed_headers)
+	env.bool("CORS_ALLOW_CREDENTIALS", &cfg.Cors.Allow_credentials)
+	env.duration("CORS_MAX_AGE", &cfg.Cors.Max_age)
+
+	env.string("MAIL_DRIVER", &cfg.Mail.Driver)
+	env.string("MAIL_FROM", &cfg.Mail.From)
+	env.string("MAIL_LOG_FILE", &cfg.Mail.Log_file)
+	env.string("SMTP_HOST", &cfg.Mail.Smtp_host)
+	env.string("SMTP_PORT", &cfg.Mail.Smtp_port)
+	env.string("SMTP_USERNAME", &cfg.Mail.Smtp_username)
+	env.string("SMTP_PASSWORD", &cfg.Mail.Smtp_password)
+
+	// The standard OpenTelemetry variables
+	env.string("OTEL_TRACES_EXPORTER", &cfg.Tracing.Exporter)
+	env.string("OTEL_EXPORTER_OTLP_ENDPOINT", &cfg.Tracing.Endpoint)
+	env.string("OTEL_SERVICE_NAME", &cfg.Tracing.Service_name)
+	env.float("OTEL_TRACES_SAMPLER_ARG", &cfg.Tracing.Sample_ratio)
+	return env.err
+}
+
+// Validate reports the first missing or malformed setting
+func (cfg *Config) Validate() error {
+	if _, err := strconv.ParseUint(cfg.Port, 10, 16); err != nil {
+		return fmt.Errorf("port %q is not a valid port number", cfg.Port)
+	}
+	if !contains(logLevels, cfg.Log_level) {
+		return fmt.Errorf("log level must be one of %s", strings.Join(logLevels, ", "))
+	}
+	if !currencyCode.MatchString(cfg.Currency) {
+		return fmt.Errorf("currency %q is not an ISO 4217 code like EUR", cfg.Currency)
+	}
+	if cfg.Mongo.Uri == "" {
+		return errors.New("MONGODB_URI is required")
+	}
+	if cfg.Mongo.Database == "" {
+		return errors.New("MONGODB_DATABASE must not be empty")
+	}
+	if cfg.Auth.Secret_key == "" && cfg.Auth.Keys_dir == "" {
+		return errors.New("SECRET_KEY or JWT_KEYS_DIR is required to sign tokens")
+	}
+	if cfg.Auth.Secret_key != "" && len(cfg.Auth.Secret_key) < MinSecretLength {
+		return fmt.Errorf("SECRET_KEY must be at least %d bytes long", MinSecretLength)
+	}
+	if cfg.Mail.Driver == "smtp" && cfg.Mail.Smtp_host == "" {
+		return errors.New("MAIL_DRIVER is smtp but SMTP_HOST is not set")
+	}
+	// Mailed links are built on the base URL, relative ones would not open from a mailbox
+	if cfg.Mail.Driver == "smtp" {
+		if cfg.App_base_url == "" {
+			return errors.New("MAIL_DRIVER is smtp but APP_BASE_URL is not set")
+		}
+		if base, err := url.Parse(cfg.App_base_url); err != nil || !base.IsAbs() || base.Host == "" {
+			return fmt.Errorf("APP_BASE_URL %q is not an absolute URL like https://restaurant.example.com", cfg.App_base_url)
+		}
+	}
+
+	for _, proxy := range cfg.Http.Trusted_proxies {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			return fmt.Errorf("trusted proxy %q is not an IP address or a CIDR", proxy)
+		}
+	}
+
+	if !contains(traceExporters, cfg.Tracing.Exporter) {
+		return fmt.Errorf("tracing exporter must be one of %s", strings.Join(traceExporters, ", "))
+	}
+	if cfg.Tracing.Sample_ratio < 0 || cfg.Tracing.Sample_ratio > 1 {
+		return errors.New("tracing sample ratio must be between 0 and 1")
+	}
+	if cfg.Mongo.Startup_attempts < 1 {
+		return errors.New("mongo startup attempts must be at least 1")
+	}
+
+	durations := map[string]time.Duration{
+		"mongo connect timeout": cfg.Mongo.Connect_timeout,
+		"mongo ping timeout":    cfg.Mongo.Ping_timeout,
+		"http read timeout":     cfg.Http.Read_timeout,
+		"http write timeout":    cfg.Http.Write_timeout,
+		"http idle timeout":     cfg.Http.Idle_timeout,
+		"http request timeout":  cfg.Http.Request_timeout,
+		"http shutdown timeout": cfg.Http.Shutdown_timeout,
+		"access token ttl":      cfg.Auth.Access_token_ttl,
+		"refresh token ttl":     cfg.Auth.Refresh_token_ttl,
+		"pin token ttl":         cfg.Auth.Pin_token_ttl,
+	}
+	for name, value := range durations {
+		if value <= 0 {
+			return fmt.Errorf("%s must be positive", name)
+		}
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// environment reads typed values from environment variables and keeps the first parse error
+type environment struct {
+	err error
+}
+
+func (e *environment) string(key string, target *string) {
+	if value, ok := os.LookupEnv(key); ok && value != "" {
+		*target = value
+	}
+}
+
+func (e *environment) list(key string, target *[]string) {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return
+	}
+	list := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	*target = list
+}
+
+func (e *environment) duration(key string, target *time.Duration) {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil && e.err == nil {
+		e.err = fmt.Errorf("%s: %q is not a duration such as 30s or 24h", key, value)
+	}
+	if err == nil {
+		*target = d
+	}
+}
+
+func (e *environment) int(key string, target *int) {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil && e.err == nil {
+		e.err = fmt.Errorf("%s: %q is not a whole number", key, value)
+	}
+	if err == nil {
+		*target = n
+	}
+}
+
+func (e *environment) float(key string, target *float64) {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil && e.err == nil {
+		e.err = fmt.Errorf("%s: %q is not a number", key, value)
+	}
+	if err == nil {
+		*target = f
+	}
+}
+
+func (e *environment) bool(key string, target *bool) {
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		return
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil && e.err == nil {
+		e.err = fmt.Errorf("%s: %q is not true or false", key, value)
+	}
+	if err == nil {
+		*target = b
+	}
+}
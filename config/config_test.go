@@ -0,0 +1,216 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateMailLinks(t *testing.T) {
+	tests := []struct {
+		name    string
+		driver  string
+		baseURL string
+		problem string
+	}{
+		{"log mail needs no base URL", "log", "", ""},
+		{"smtp with an absolute URL", "smtp", "https://restaurant.example.com", ""},
+		{"smtp with a path", "smtp", "https://example.com/restaurant", ""},
+		{"smtp without a base URL", "smtp", "", "APP_BASE_URL is not set"},
+		{"smtp with a relative URL", "smtp", "/app", "not an absolute URL"},
+		{"smtp with a bare host", "smtp", "restaurant.example.com", "not an absolute URL"},
+		{"smtp without a host", "smtp", "https://", "not an absolute URL"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			cfg.Mongo.Uri = "mongodb://localhost:27017"
+			cfg.Auth.Secret_key = strings.Repeat("k", MinSecretLength)
+			cfg.Mail.Driver, cfg.Mail.Smtp_host = tt.driver, "smtp.example.com"
+			cfg.App_base_url = tt.baseURL
+
+			err := cfg.Validate()
+			if tt.problem == "" && err != nil {
+				t.Fatalf("Validate() = %v, want no error", err)
+			}
+			if tt.problem != "" && (err == nil || !strings.Contains(err.Error(), tt.problem)) {
+				t.Fatalf("Validate() = %v, want an error containing %q", err, tt.problem)
+			}
+		})
+	}
+}
+
+func TestValidateTrustedProxies(t *testing.T) {
+	tests := []struct {
+		name    string
+		proxies []string
+		valid   bool
+	}{
+		{"none", nil, true},
+		{"addresses and ranges", []string{"10.0.0.1", "10.1.0.0/16", "fd00::/8"}, true},
+		{"host name", []string{"lb.internal"}, false},
+		{"malformed range", []string{"10.0.0.0/33"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			cfg.Mongo.Uri = "mongodb://localhost:27017"
+			cfg.Auth.Secret_key = strings.Repeat("k", MinSecretLength)
+			cfg.Http.Trusted_proxies = tt.proxies
+			if err := cfg.Validate(); (err == nil) != tt.valid {
+				t.Fatalf("Validate() = %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+}
+
+// writeFile writes a configuration file named name into a temporary directory
+func writeFile(t *testing.T, name string, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	secret := strings.Repeat("k", MinSecretLength)
+	path := writeFile(t, "config.yaml", `
+port: "9000"
+log_level: warn
+mongo:
+  uri: mongodb://file:27017
+  database: from_file
+http:
+  request_timeout: 5s
+auth:
+  secret_key: `+secret+`
+`)
+	t.Setenv("CONFIG_FILE", "")
+	t.Setenv("MONGODB_DATABASE", "from_env")
+	t.Setenv("HTTP_REQUEST_TIMEOUT", "7s")
+	t.Setenv("CORS_ALLOWED_ORIGINS", " https://a.example.com, ,https://b.example.com ")
+	t.Setenv("LOG_LEVEL", "error")
+
+	cfg, err := Load([]string{"-config", path, "-log-level", "debug"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		got  interface{}
+		want interface{}
+	}{
+		{"default", cfg.Currency, "USD"},
+		{"file over default", cfg.Port, "9000"},
+		{"file", cfg.Mongo.Uri, "mongodb://file:27017"},
+		{"environment over file", cfg.Mongo.Database, "from_env"},
+		{"environment duration", cfg.Http.Request_timeout, 7 * time.Second},
+		{"environment list", strings.Join(cfg.Cors.Allowed_origins, " "), "https://a.example.com https://b.example.com"},
+		{"flag over environment", cfg.Log_level, "debug"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	secret := strings.Repeat("k", MinSecretLength)
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		problem string
+	}{
+		{"yaml", "config.yml", "mongo:\n  uri: mongodb://db:27017\nauth:\n  secret_key: " + secret + "\n", ""},
+		{"toml", "config.toml", "[mongo]\nuri = \"mongodb://db:27017\"\n[auth]\nsecret_key = \"" + secret + "\"\n", ""},
+		{"unknown yaml setting", "config.yaml", "mongo:\n  url: mongodb://db:27017\n", "url"},
+		{"unknown toml setting", "config.toml", "[mongo]\nurl = \"mongodb://db:27017\"\n", "unknown setting"},
+		{"other format", "config.json", "{}", "must be .yaml, .yml or .toml"},
+		{"invalid settings", "config.yaml", "port: \"http\"\nmongo:\n  uri: mongodb://db:27017\nauth:\n  secret_key: " + secret + "\n", "not a valid port"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CONFIG_FILE", writeFile(t, tt.file, tt.content))
+			cfg, err := Load(nil)
+			if tt.problem == "" {
+				if err != nil || cfg.Mongo.Uri != "mongodb://db:27017" {
+					t.Fatalf("Load() = %v, %v, want the file settings", cfg, err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.problem) {
+				t.Fatalf("Load() = %v, want an error containing %q", err, tt.problem)
+			}
+		})
+	}
+	if _, err := Load([]string{"-config", filepath.Join(t.TempDir(), "missing.yaml")}); err == nil {
+		t.Fatal("Load() of a missing file succeeded")
+	}
+}
+
+func TestLoadEnvRejectsMalformedValues(t *testing.T) {
+	tests := []struct {
+		key   string
+		value string
+	}{
+		{"HTTP_READ_TIMEOUT", "15"},
+		{"MONGODB_STARTUP_ATTEMPTS", "many"},
+		{"OTEL_TRACES_SAMPLER_ARG", "half"},
+		{"CORS_ALLOW_CREDENTIALS", "sometimes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			t.Setenv("CONFIG_FILE", "")
+			t.Setenv("MONGODB_URI", "mongodb://db:27017")
+			t.Setenv("SECRET_KEY", strings.Repeat("k", MinSecretLength))
+			t.Setenv(tt.key, tt.value)
+			if _, err := Load(nil); err == nil || !strings.Contains(err.Error(), tt.key) {
+				t.Fatalf("Load() = %v, want an error naming %s", err, tt.key)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(cfg *Config)
+		problem string
+	}{
+		{"defaults", func(cfg *Config) {}, ""},
+		{"keys directory instead of a secret", func(cfg *Config) { cfg.Auth.Secret_key, cfg.Auth.Keys_dir = "", "/keys" }, ""},
+		{"no mongo uri", func(cfg *Config) { cfg.Mongo.Uri = "" }, "MONGODB_URI"},
+		{"no signing key", func(cfg *Config) { cfg.Auth.Secret_key = "" }, "SECRET_KEY or JWT_KEYS_DIR"},
+		{"short secret", func(cfg *Config) { cfg.Auth.Secret_key = "short" }, "at least 32 bytes"},
+		{"port out of range", func(cfg *Config) { cfg.Port = "70000" }, "port"},
+		{"unknown log level", func(cfg *Config) { cfg.Log_level = "verbose" }, "log level"},
+		{"lower case currency", func(cfg *Config) { cfg.Currency = "eur" }, "ISO 4217"},
+		{"unknown exporter", func(cfg *Config) { cfg.Tracing.Exporter = "jaeger" }, "tracing exporter"},
+		{"sample ratio above one", func(cfg *Config) { cfg.Tracing.Sample_ratio = 1.5 }, "sample ratio"},
+		{"no startup attempt", func(cfg *Config) { cfg.Mongo.Startup_attempts = 0 }, "startup attempts"},
+		{"zero timeout", func(cfg *Config) { cfg.Http.Request_timeout = 0 }, "http request timeout"},
+		{"smtp without a host", func(cfg *Config) { cfg.Mail.Driver = "smtp" }, "SMTP_HOST"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			cfg.Mongo.Uri = "mongodb://localhost:27017"
+			cfg.Auth.Secret_key = strings.Repeat("k", MinSecretLength)
+			tt.change(cfg)
+
+			err := cfg.Validate()
+			if tt.problem == "" && err != nil {
+				t.Fatalf("Validate() = %v, want no error", err)
+			}
+			if tt.problem != "" && (err == nil || !strings.Contains(err.Error(), tt.problem)) {
+				t.Fatalf("Validate() = %v, want an error containing %q", err, tt.problem)
+			}
+		})
+	}
+}
@@ -0,0 +1,226 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/PranavMasekar/restaurant-management/apperror"
+	"github.com/PranavMasekar/restaurant-management/helpers"
+	"github.com/PranavMasekar/restaurant-management/mailer"
+	"github.com/PranavMasekar/restaurant-management/models"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type forgotPasswordRequest struct {
+	Email *string `json:"email" validate:"required,email"`
+}
+
+type resetPasswordRequest struct {
+	Token    *string `json:"token" validate:"required"`
+	Password *string `json:"password" validate:"required,min=6"`
+}
+
+type verifyEmailRequest struct {
+	Token *string `json:"token" validate:"required"`
+}
+
+func (h *UserHandler) ForgotPassword() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		c, cancel := requestContext(ctx)
+		defer cancel()
+		var body forgotPasswordRequest
+
+		if err := ctx.ShouldBindJSON(&body); err != nil {
+			apperror.Respond(ctx, apperror.Invalid(err))
+			return
+		}
+		if validationErr := validate.Struct(body); validationErr != nil {
+			apperror.Respond(ctx, apperror.Invalid(validationErr))
+			return
+		}
+		// Throttled per email and per IP, so that nobody can flood a mailbox or the mail relay
+		ip := ctx.ClientIP()
+		lockedUntil, err := helpers.ResetLockedUntil(c, h.loginAttempts, *body.Email, ip)
+		if err != nil {
+			apperror.Respond(ctx, apperror.Internal("error occured while checking reset requests", err))
+			return
+		}
+		if wait := time.Until(lockedUntil); wait > 0 {
+			ctx.Header("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+			apperror.Respond(ctx, apperror.TooManyRequests("too many password reset requests, try again later"))
+			return
+		}
+		if err := helpers.RecordResetRequest(c, h.loginAttempts, *body.Email, ip); err != nil {
+			slog.WarnContext(c, "password reset request was not recorded", "email", *body.Email, "error", err)
+		}
+
+		// The answer is the same whether or not the email is registered, so it cannot be used to find accounts
+		response := gin.H{"message": "if the email is registered, a password reset link has been sent"}
+		user, err := h.users.FindByEmail(c, *body.Email)
+		if err != nil || user.Deactivated_at != nil {
+			ctx.JSON(http.StatusOK, response)
+			return
+		}
+
+		token, err := helpers.CreateUserToken(c, h.userTokens, user.User_id, *user.Email, models.PasswordResetToken, helpers.PasswordResetTTL)
+		if err != nil {
+			apperror.Respond(ctx, apperror.Internal("error occured while creating the reset token", err))
+			return
+		}
+		msg := mailer.Message{
+			To:      *user.Email,
+			Subject: "Reset your password",
+			Body: fmt.Sprintf("Hi %s,\n\nUse the link below to choose a new password. It expires in %v.\n\n%s\n\nIf you did not ask for this, ignore this email.\n",
+				*user.First_name, helpers.PasswordResetTTL, h.mailLink("/reset-password", token)),
+		}
+		// A failure is only logged, answering differently would tell that the email is registered
+		if err := h.mailer.Send(c, msg); err != nil {
+			slog.ErrorContext(c, "password reset email was not sent", "user_id", user.User_id, "error", err)
+		}
+		ctx.JSON(http.StatusOK, response)
+	}
+}
+
+func (h *UserHandler) ResetPassword() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		c, cancel := requestContext(ctx)
+		defer cancel()
+		var body resetPasswordRequest
+
+		if err := ctx.ShouldBindJSON(&body); err != nil {
+			apperror.Respond(ctx, apperror.Invalid(err))
+			return
+		}
+		if validationErr := validate.Struct(body); validationErr != nil {
+			apperror.Respond(ctx, apperror.Invalid(validationErr))
+			return
+		}
+		userToken, err := helpers.ConsumeUserToken(c, h.userTokens, *body.Token, models.PasswordResetToken)
+		if err != nil {
+			apperror.Respond(ctx, apperror.Validation("reset token is invalid or has expired"))
+			return
+		}
+		userId := userToken.User_id
+		user, err := h.users.FindById(c, userId)
+		if err != nil {
+			apperror.Respond(ctx, apperror.Validation("reset token is invalid or has expired"))
+			return
+		}
+
+		updated_at, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		password, err := HashPassword(*body.Password)
+		if err != nil {
+			apperror.Respond(ctx, apperror.Internal("password reset failed", err))
+			return
+		}
+		update := bson.D{
+			{Key: "password", Value: password},
+			{Key: "updated_at", Value: updated_at},
+		}
+		// Following the mailed link also proves the user owns the address, unless it changed since
+		if helpers.MailedTo(userToken, user) {
+			update = append(update, bson.E{Key: "email_verified", Value: true})
+		}
+		err = h.users.Update(c, userId, update)
+		if err != nil {
+			apperror.Respond(ctx, apperror.Internal("password reset failed", err))
+			return
+		}
+		// Whoever knew the old password must not stay logged in
+		if _, err := h.users.RevokeAllSessions(c, userId); err != nil {
+			apperror.Respond(ctx, apperror.Internal("error occured while revoking the sessions", err))
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"message": "password has been reset"})
+	}
+}
+
+func (h *UserHandler) ResendVerificationEmail() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		c, cancel := requestContext(ctx)
+		defer cancel()
+
+		user, err := h.users.FindById(c, ctx.GetString("uid"))
+		if err != nil {
+			apperror.Respond(ctx, apperror.NotFound("user not found"))
+			return
+		}
+		if user.Email_verified {
+			ctx.JSON(http.StatusOK, gin.H{"message": "email is already verified"})
+			return
+		}
+		if err := h.sendVerificationEmail(c, user); err != nil {
+			apperror.Respond(ctx, apperror.Internal("error occured while sending the verification email", err))
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"message": "verification email sent"})
+	}
+}
+
+func (h *UserHandler) VerifyEmail() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		c, cancel := requestContext(ctx)
+		defer cancel()
+		var body verifyEmailRequest
+
+		if err := ctx.ShouldBindJSON(&body); err != nil {
+			apperror.Respond(ctx, apperror.Invalid(err))
+			return
+		}
+		if validationErr := validate.Struct(body); validationErr != nil {
+			apperror.Respond(ctx, apperror.Invalid(validationErr))
+			return
+		}
+		userToken, err := helpers.ConsumeUserToken(c, h.userTokens, *body.Token, models.EmailVerificationToken)
+		if err != nil {
+			apperror.Respond(ctx, apperror.Validation("verification token is invalid or has expired"))
+			return
+		}
+		user, err := h.users.FindById(c, userToken.User_id)
+		if err != nil {
+			apperror.Respond(ctx, apperror.Validation("verification token is invalid or has expired"))
+			return
+		}
+		// A link mailed to an earlier address says nothing about the current one
+		if !helpers.MailedTo(userToken, user) {
+			apperror.Respond(ctx, apperror.Validation("verification token was issued for another email address"))
+			return
+		}
+
+		updated_at, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		err = h.users.Update(c, user.User_id, bson.D{
+			{Key: "email_verified", Value: true},
+			{Key: "updated_at", Value: updated_at},
+		})
+		if err != nil {
+			apperror.Respond(ctx, apperror.Internal("email verification failed", err))
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"message": "email verified"})
+	}
+}
+
+func (h *UserHandler) sendVerificationEmail(c context.Context, user models.User) error {
+	token, err := helpers.CreateUserToken(c, h.userTokens, user.User_id, *user.Email, models.EmailVerificationToken, helpers.EmailVerificationTTL)
+	if err != nil {
+		return err
+	}
+	msg := mailer.Message{
+		To:      *user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nConfirm your email address with the link below. It expires in %v.\n\n%s\n",
+			*user.First_name, helpers.EmailVerificationTTL, h.mailLink("/verify-email", token)),
+	}
+	return h.mailer.Send(c, msg)
+}
+
+// mailLink points the mailed token at the front end page handling it
+func (h *UserHandler) mailLink(path string, token string) string {
+	return h.appBaseURL + path + "?token=" + url.QueryEscape(token)
+}
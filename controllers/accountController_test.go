@@ -0,0 +1,85 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/PranavMasekar/restaurant-management/mailer"
+	"github.com/PranavMasekar/restaurant-management/models"
+	"github.com/PranavMasekar/restaurant-management/repository"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// failingMailer counts the messages it was asked to send and fails to send them
+type failingMailer struct {
+	sent int
+}
+
+func (m *failingMailer) Send(ctx context.Context, msg mailer.Message) error {
+	m.sent++
+	return errors.New("relay unavailable")
+}
+
+func TestForgotPassword(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	email, name := "ann@example.com", "Ann"
+	user := models.User{ID: primitive.NewObjectID(), Email: &email, First_name: &name}
+	user.User_id = user.ID.Hex()
+	if err := repos.Users.Create(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+	mail := &failingMailer{}
+	handler := NewUserHandler(repos.Users, repos.Devices, repos.UserTokens, repos.LoginAttempts, mail, "https://app.example.com")
+	router := gin.New()
+	router.POST("/users/forgot-password", handler.ForgotPassword())
+
+	request := func(email string, ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/users/forgot-password", strings.NewReader(`{"email":"`+email+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.RemoteAddr = ip + ":41000"
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	tests := []struct {
+		name   string
+		email  string
+		ip     string
+		status int
+	}{
+		// A mail that cannot be sent gets the same answer as an unknown email
+		{"registered email", email, "10.0.0.1", http.StatusOK},
+		{"unknown email", "bob@example.com", "10.0.0.1", http.StatusOK},
+		{"second request", email, "10.0.0.2", http.StatusOK},
+		{"third request locks the email", email, "10.0.0.3", http.StatusOK},
+		{"locked email", email, "10.0.0.4", http.StatusTooManyRequests},
+		{"another email from a known IP", "carl@example.com", "10.0.0.1", http.StatusOK},
+	}
+	for _, tt := range tests {
+		rec := request(tt.email, tt.ip)
+		if rec.Code != tt.status {
+			t.Fatalf("%s: status = %d, want %d: %s", tt.name, rec.Code, tt.status, rec.Body.String())
+		}
+		if tt.status == http.StatusTooManyRequests && rec.Header().Get("Retry-After") == "" {
+			t.Fatalf("%s: no Retry-After", tt.name)
+		}
+	}
+	if mail.sent != 3 {
+		t.Fatalf("sent %d mails, want one per accepted request of the registered email", mail.sent)
+	}
+
+	// An IP is locked after maxResetIPRequests, whatever the emails it asks for
+	for i := 0; i < 10; i++ {
+		request(fmt.Sprintf("guest%d@example.com", i), "10.0.0.9")
+	}
+	if rec := request("dana@example.com", "10.0.0.9"); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("locked IP: status = %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+}
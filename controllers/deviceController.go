@@ -0,0 +1,95 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/PranavMasekar/restaurant-management/apperror"
+	"github.com/PranavMasekar/restaurant-management/helpers"
+	"github.com/PranavMasekar/restaurant-management/models"
+	"github.com/PranavMasekar/restaurant-management/repository"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// DeviceHandler serves the POS terminals staff log in on with their PIN
+type DeviceHandler struct {
+	devices repository.DeviceRepository
+}
+
+func NewDeviceHandler(devices repository.DeviceRepository) *DeviceHandler {
+	return &DeviceHandler{devices: devices}
+}
+
+func (h *DeviceHandler) GetDevices() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		c, cancel := requestContext(ctx)
+		defer cancel()
+		allDevices, err := h.devices.List(c)
+		if err != nil {
+			apperror.Respond(ctx, apperror.Internal("error occured while listing devices", err))
+			return
+		}
+		ctx.JSON(http.StatusOK, allDevices)
+	}
+}
+
+func (h *DeviceHandler) RegisterDevice() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		c, cancel := requestContext(ctx)
+		defer cancel()
+		var device models.Device
+		if err := ctx.ShouldBindJSON(&device); err != nil {
+			apperror.Respond(ctx, apperror.Invalid(err))
+			return
+		}
+		if validationErr := validate.Struct(device); validationErr != nil {
+			apperror.Respond(ctx, apperror.Invalid(validationErr))
+			return
+		}
+
+		secret, hash, err := helpers.GenerateDeviceSecret()
+		if err != nil {
+			apperror.Respond(ctx, apperror.Internal("error occured while generating the device secret", err))
+			return
+		}
+		device.Secret_hash = hash
+		device.Revoked = false
+		device.Registered_by = ctx.GetString("uid")
+		device.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		device.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		device.ID = primitive.NewObjectID()
+		device.Device_id = device.ID.Hex()
+
+		if err := h.devices.Create(c, device); err != nil {
+			msg := fmt.Sprintf("device was not registered")
+			apperror.Respond(ctx, apperror.Internal(msg, err))
+			return
+		}
+		// The secret is only stored hashed, the terminal has to keep this copy
+		ctx.JSON(http.StatusOK, gin.H{"device_id": device.Device_id, "name": device.Name, "device_secret": secret})
+	}
+}
+
+func (h *DeviceHandler) RevokeDevice() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		c, cancel := requestContext(ctx)
+		defer cancel()
+		updated_at, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		err := h.devices.Update(c, ctx.Param("device_id"), bson.D{
+			{Key: "revoked", Value: true},
+			{Key: "updated_at", Value: updated_at},
+		})
+		if err == repository.ErrNotFound {
+			apperror.Respond(ctx, apperror.NotFound("device not found"))
+			return
+		}
+		if err != nil {
+			apperror.Respond(ctx, apperror.Internal("device revocation failed", err))
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"message": "device revoked"})
+	}
+}
@@ -2,104 +2,145 @@ package controllers
 
 import (
 	"context"
-	"fmt"
-	"log"
-	"math"
 	"net/http"
-	"strconv"
+	"reflect"
+	"strings"
 	"time"
 
-	"github.com/PranavMasekar/restaurant-management/database"
+	"github.com/PranavMasekar/restaurant-management/apperror"
+	"github.com/PranavMasekar/restaurant-management/config"
+	"github.com/PranavMasekar/restaurant-management/helpers"
 	"github.com/PranavMasekar/restaurant-management/models"
+	"github.com/PranavMasekar/restaurant-management/money"
+	"github.com/PranavMasekar/restaurant-management/repository"
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-var foodCollection *mongo.Collection = database.OpenCollection(database.Client, "food")
-var validate = validator.New()
+var validate = newValidator()
 
-func GetFoods() gin.HandlerFunc {
+// newValidator names the rejected fields after their JSON keys, the names clients know
+func newValidator() *validator.Validate {
+	v := validator.New()
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+	// Times of day of the menu schedules, like 07:30
+	v.RegisterValidation("clock", func(fl validator.FieldLevel) bool {
+		_, err := helpers.ParseClock(fl.Field().String())
+		return err == nil
+	})
+	return v
+}
+
+// RequestTimeout is the time a handler may spend on its database calls, main sets it from the
+// configuration
+var RequestTimeout = config.Default().Http.Request_timeout
+
+// requestContext bounds the database calls of a handler by RequestTimeout. It carries the
+// values of the request, like its request ID, but is not cancelled when the client goes
+// away, so that a write is never abandoned halfway.
+func requestContext(ctx *gin.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.WithoutCancel(ctx.Request.Context()), RequestTimeout)
+}
+
+// FoodHandler serves the foods, which belong to a menu
+type FoodHandler struct {
+	foods repository.FoodRepository
+	menus repository.MenuRepository
+}
+
+func NewFoodHandler(foods repository.FoodRepository, menus repository.MenuRepository) *FoodHandler {
+	return &FoodHandler{foods: foods, menus: menus}
+}
+
+// What clients can filter, sort and select in the food list
+var foodListSpec = helpers.ListSpec{
+	Filters: map[string]helpers.FieldKind{
+		"name":       helpers.StringField,
+		"price":      helpers.MoneyField,
+		"menu_id":    helpers.StringField,
+		"food_id":    helpers.StringField,
+		"in_stock":   helpers.BoolField,
+		"tax_class":  helpers.StringField,
+		"created_at": helpers.TimeField,
+	},
+	Sorts:        []string{"name", "price", "created_at", "updated_at"},
+	Fields:       []string{"name", "price", "food_image", "menu_id", "in_stock", "tax_class", "modifier_groups", "created_at", "updated_at"},
+	Id_field:     "food_id",
+	Default_sort: "name",
+}
+
+func (h *FoodHandler) GetFoods() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		c, cancel := context.WithTimeout(context.Background(), 100*time.Second)
-		recordPerPage, err := strconv.Atoi(ctx.Query("recordPerPage"))
-		if err != nil || recordPerPage < 1 {
-			recordPerPage = 10
-		}
-		page, err := strconv.Atoi(ctx.Query("page"))
-		if err != nil || page < 1 {
-			page = 1
-		}
-		startIndex := (page - 1) * recordPerPage
-		startIndex, err = strconv.Atoi(ctx.Query("startIndex"))
-		matchStage := bson.D{{"$match", bson.D{{}}}}
-		// The members which are added in group stage are inserted in data field
-		groupStage := bson.D{{"$group", bson.D{{"_id", bson.D{{"_id", "null"}}}, {"total_count", bson.D{{"$sum", 1}}}, {"data", bson.D{{"$push", "$$ROOT"}}}}}}
-		projectStage := bson.D{
-			{
-				Key: "$project", Value: bson.D{
-					// 0 means dont send this feild to frontEnd and 1 means send to frontend
-					{Key: "_id", Value: 0},
-					{Key: "total_count", Value: 1},
-					// $slice => specifies the number of elements to return to array fields by using startIndex and End index
-					{Key: "food_items", Value: bson.D{{Key: "$slice", Value: []interface{}{"$data", startIndex, recordPerPage}}}}}}}
-		result, err := foodCollection.Aggregate(c, mongo.Pipeline{matchStage, groupStage, projectStage})
+		c, cancel := requestContext(ctx)
 		defer cancel()
+		query, pagination, err := helpers.ParseListQuery(ctx, foodListSpec)
 		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing food items"})
+			apperror.Respond(ctx, apperror.Invalid(err))
+			return
 		}
-		var allFoods []bson.M
-		if err = result.All(c, &allFoods); err != nil {
-			log.Fatal(err)
+		allFoods, total, err := h.foods.List(c, query, pagination)
+		if err != nil {
+			apperror.Respond(ctx, apperror.Internal("error occured while listing food items", err))
+			return
 		}
-		ctx.JSON(http.StatusOK, allFoods[0])
+		ctx.JSON(http.StatusOK, helpers.ListResponse(pagination, "food_items", total, allFoods))
 	}
 }
 
-func GetFood() gin.HandlerFunc {
+func (h *FoodHandler) GetFood() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		c, cancel := context.WithTimeout(context.Background(), 100*time.Second)
-		foodId := ctx.Param("food_id")
-		var food models.Food
-		// Find the Food Item
-		err := foodCollection.FindOne(c, bson.M{"food_id": foodId}).Decode(&food)
+		c, cancel := requestContext(ctx)
 		defer cancel()
+		// Find the Food Item
+		food, err := h.foods.FindById(c, ctx.Param("food_id"))
+		if err == repository.ErrNotFound {
+			apperror.Respond(ctx, apperror.NotFound("food item not found"))
+			return
+		}
 		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "errror occured while fetching food item"})
+			apperror.Respond(ctx, apperror.Internal("errror occured while fetching food item", err))
+			return
 		}
-
 		ctx.JSON(http.StatusOK, food)
 	}
 }
 
-func CreateFood() gin.HandlerFunc {
+func (h *FoodHandler) CreateFood() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		c, cancel := context.WithTimeout(context.Background(), 100*time.Second)
-		var food models.Food
-		var menu models.Menu
+		c, cancel := requestContext(ctx)
 		defer cancel()
+		var food models.Food
 		// Get the request body into struct Food
-		err := ctx.BindJSON(&food)
+		err := ctx.ShouldBindJSON(&food)
 		if err != nil {
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			apperror.Respond(ctx, apperror.Invalid(err))
 			return
 		}
 		// Validate food struct
 		validationError := validate.Struct(food)
 		if validationError != nil {
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": validationError.Error()})
+			apperror.Respond(ctx, apperror.Invalid(validationError))
+			return
+		}
+		if problem := priceProblem(*food.Price); problem != "" {
+			apperror.Respond(ctx, apperror.Validation("the request is invalid", apperror.FieldError{Field: "price", Message: problem}))
+			return
+		}
+		if field, problem := helpers.ModifierGroupsProblem(food.Modifier_groups, food.Price.Currency); problem != "" {
+			apperror.Respond(ctx, apperror.Validation("the request is invalid", apperror.FieldError{Field: field, Message: problem}))
 			return
 		}
 		// Check whether menu exits or not in DB
-		err = menuCollection.FindOne(c, bson.M{"menu_id": food.Menu_id}).Decode(&menu)
-		defer cancel()
-
-		if err != nil {
-			msg := fmt.Sprintf("Menu not found")
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		if _, err = h.menus.FindById(c, *food.Menu_id); err != nil {
+			apperror.Respond(ctx, apperror.Validation("Menu not found"))
 			return
 		}
 		// Set created and updated values
@@ -109,96 +150,152 @@ func CreateFood() gin.HandlerFunc {
 		food.ID = primitive.NewObjectID()
 		food.Food_id = food.ID.Hex()
 
-		var num = toFixed(*food.Price, 2)
-		food.Price = &num
+		if food.In_stock == nil {
+			inStock := true
+			food.In_stock = &inStock
+		}
+		if food.Tax_class == nil {
+			taxClass := defaultTaxClass
+			food.Tax_class = &taxClass
+		}
 		// Insert into DB
-		result, insertError := foodCollection.InsertOne(c, food)
-
-		if insertError != nil {
-			msg := fmt.Sprintf("Food item was not inserted")
-			ctx.JSON(http.StatusInternalServerError, gin.H{"err": msg})
+		if err = h.foods.Create(c, food); err != nil {
+			apperror.Respond(ctx, apperror.Internal("Food item was not inserted", err))
 			return
 		}
-		defer cancel()
-		// response
-		ctx.JSON(http.StatusOK, result)
-
+		ctx.JSON(http.StatusOK, food)
 	}
 }
 
-func UpdateFood() gin.HandlerFunc {
+func (h *FoodHandler) UpdateFood() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		var c, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		c, cancel := requestContext(ctx)
 		defer cancel()
-		var menu models.Menu
 		var food models.Food
 
 		foodId := ctx.Param("food_id")
 
-		if err := ctx.BindJSON(&food); err != nil {
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		if err := ctx.ShouldBindJSON(&food); err != nil {
+			apperror.Respond(ctx, apperror.Invalid(err))
 			return
 		}
 		var updateObj primitive.D
 
 		if food.Name != nil {
-			updateObj = append(updateObj, bson.E{"name", food.Name})
+			updateObj = append(updateObj, bson.E{Key: "name", Value: food.Name})
 		}
 
 		if food.Price != nil {
-			updateObj = append(updateObj, bson.E{"price", food.Price})
+			if problem := priceProblem(*food.Price); problem != "" {
+				apperror.Respond(ctx, apperror.Validation("the request is invalid", apperror.FieldError{Field: "price", Message: problem}))
+				return
+			}
+			updateObj = append(updateObj, bson.E{Key: "price", Value: food.Price})
 		}
 
 		if food.Food_image != nil {
-			updateObj = append(updateObj, bson.E{"food_image", food.Food_image})
+			updateObj = append(updateObj, bson.E{Key: "food_image", Value: food.Food_image})
+		}
+
+		if food.In_stock != nil {
+			updateObj = append(updateObj, bson.E{Key: "in_stock", Value: food.In_stock})
+		}
+
+		// The whole list is replaced, an empty one removes the modifiers
+		if food.Modifier_groups != nil {
+			for _, group := range food.Modifier_groups {
+				if err := validate.Struct(group); err != nil {
+					apperror.Respond(ctx, apperror.Invalid(err))
+					return
+				}
+			}
+			// The deltas are in the currency of the new price, or of the stored one when it is kept
+			price := food.Price
+			if price == nil {
+				stored, err := h.foods.FindById(c, foodId)
+				if err == repository.ErrNotFound {
+					apperror.Respond(ctx, apperror.NotFound("food item not found"))
+					return
+				}
+				if err != nil {
+					apperror.Respond(ctx, apperror.Internal("error occured while fetching the food item", err))
+					return
+				}
+				price = stored.Price
+			}
+			currency := money.DefaultCurrency
+			if price != nil && price.Currency != "" {
+				currency = price.Currency
+			}
+			if field, problem := helpers.ModifierGroupsProblem(food.Modifier_groups, currency); problem != "" {
+				apperror.Respond(ctx, apperror.Validation("the request is invalid", apperror.FieldError{Field: field, Message: problem}))
+				return
+			}
+			updateObj = append(updateObj, bson.E{Key: "modifier_groups", Value: food.Modifier_groups})
+		}
+
+		if food.Tax_class != nil {
+			if err := validate.Var(*food.Tax_class, "required,max=32"); err != nil {
+				apperror.Respond(ctx, apperror.Validation("the request is invalid",
+					apperror.FieldError{Field: "tax_class", Message: "must be a name of at most 32 characters"}))
+				return
+			}
+			updateObj = append(updateObj, bson.E{Key: "tax_class", Value: food.Tax_class})
 		}
 
 		if food.Menu_id != nil {
 			// Get Menu
-			err := menuCollection.FindOne(ctx, bson.M{"menu_id": food.Menu_id}).Decode(&menu)
-			defer cancel()
-			if err != nil {
-				msg := fmt.Sprintf("message:Menu was not found")
-				ctx.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			if _, err := h.menus.FindById(c, *food.Menu_id); err != nil {
+				apperror.Respond(ctx, apperror.Validation("Menu was not found"))
 				return
 			}
-			updateObj = append(updateObj, bson.E{"menu", food.Price})
+			updateObj = append(updateObj, bson.E{Key: "menu_id", Value: food.Menu_id})
 		}
 
 		food.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
-		updateObj = append(updateObj, bson.E{"updated_at", food.Updated_at})
-
-		upsert := true
-		filter := bson.M{"food_id": foodId}
+		updateObj = append(updateObj, bson.E{Key: "updated_at", Value: food.Updated_at})
 
-		opt := options.UpdateOptions{
-			Upsert: &upsert,
+		err := h.foods.Update(c, foodId, updateObj)
+		if err == repository.ErrNotFound {
+			apperror.Respond(ctx, apperror.NotFound("food item not found"))
+			return
 		}
-
-		result, err := foodCollection.UpdateOne(
-			c,
-			filter,
-			bson.D{
-				{"$set", updateObj},
-			},
-			&opt,
-		)
-
 		if err != nil {
-			msg := fmt.Sprint("food item update failed")
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			apperror.Respond(ctx, apperror.Internal("food item update failed", err))
 			return
 		}
-
-		ctx.JSON(http.StatusOK, result)
+		food, err = h.foods.FindById(c, foodId)
+		if err != nil {
+			apperror.Respond(ctx, apperror.Internal("errror occured while fetching food item", err))
+			return
+		}
+		ctx.JSON(http.StatusOK, food)
 	}
 }
 
-func round(num float64) int {
-	return int(num + math.Copysign(0.5, num))
+// inStock tells whether the kitchen can still prepare food
+func inStock(food models.Food) bool {
+	return food.In_stock == nil || *food.In_stock
+}
+
+// Tax class of the foods that were not given one
+const defaultTaxClass = "standard"
+
+func taxClass(food models.Food) string {
+	if food.Tax_class == nil || *food.Tax_class == "" {
+		return defaultTaxClass
+	}
+	return *food.Tax_class
 }
 
-func toFixed(num float64, precision int) float64 {
-	output := math.Pow(10, float64(precision))
-	return float64(round(num*output)) / output
+// priceProblem tells what is wrong with the price of a food, "" when nothing is. Invoices add up
+// the prices of their items, so they all have to be in the currency of the restaurant.
+func priceProblem(price money.Money) string {
+	if price.Currency != money.DefaultCurrency {
+		return "must be in " + money.DefaultCurrency
+	}
+	if price.IsNegative() {
+		return "must not be negative"
+	}
+	return ""
 }
@@ -0,0 +1,43 @@
+package controllers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/PranavMasekar/restaurant-management/repository"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestUpdateFoodChecksTheDeltasAgainstThePrice(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	_, foodId := seedMenu(t, repos)
+	handler := NewFoodHandler(repos.Foods, repos.Menus)
+	router := gin.New()
+	router.PATCH("/foods/:food_id", handler.UpdateFood())
+
+	groups := func(currency string) []gin.H {
+		return []gin.H{{"group_id": "extras", "name": "Extras", "options": []gin.H{
+			{"option_id": "cheese", "name": "Cheese", "price_delta": gin.H{"amount": "0.50", "currency": currency}},
+		}}}
+	}
+	tests := []struct {
+		name string
+		id   string
+		body gin.H
+		code int
+	}{
+		{"deltas in the currency of the stored price", foodId, gin.H{"modifier_groups": groups("USD")}, http.StatusOK},
+		{"deltas in another currency", foodId, gin.H{"modifier_groups": groups("EUR")}, http.StatusBadRequest},
+		{"deltas checked against the new price", foodId, gin.H{"price": gin.H{"amount": "9.00", "currency": "USD"}, "modifier_groups": groups("EUR")}, http.StatusBadRequest},
+		{"unknown food", primitive.NewObjectID().Hex(), gin.H{"modifier_groups": groups("USD")}, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body map[string]interface{}
+			if code := serve(t, router, http.MethodPatch, "/foods/"+tt.id, tt.body, &body); code != tt.code {
+				t.Fatalf("PATCH = %d, want %d: %v", code, tt.code, body)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/PranavMasekar/restaurant-management/database"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// HealthHandler answers the liveness and readiness probes
+type HealthHandler struct {
+	ping     func(c context.Context) error
+	draining int32
+}
+
+func NewHealthHandler(client *mongo.Client, pingTimeout time.Duration) *HealthHandler {
+	return &HealthHandler{ping: func(c context.Context) error {
+		return database.Ping(c, client, pingTimeout)
+	}}
+}
+
+// Drain fails the readiness probe from now on, so that no new traffic is routed to an
+// instance that is shutting down
+func (h *HealthHandler) Drain() {
+	atomic.StoreInt32(&h.draining, 1)
+}
+
+// Healthz tells whether the process is alive. MongoDB being down is reported but does not fail
+// the probe, restarting the service would not bring the database back.
+func (h *HealthHandler) Healthz() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.JSON(http.StatusOK, gin.H{"status": "ok", "mongo": h.mongoStatus(ctx)})
+	}
+}
+
+// Readyz tells whether the instance can serve requests: MongoDB answers and it is not shutting down
+func (h *HealthHandler) Readyz() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if atomic.LoadInt32(&h.draining) == 1 {
+			ctx.JSON(http.StatusServiceUnavailable, gin.H{"status": "shutting down"})
+			return
+		}
+		mongoStatus := h.mongoStatus(ctx)
+		if mongoStatus != "up" {
+			ctx.JSON(http.StatusServiceUnavailable, gin.H{"status": "unavailable", "mongo": mongoStatus})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"status": "ready", "mongo": mongoStatus})
+	}
+}
+
+func (h *HealthHandler) mongoStatus(ctx *gin.Context) string {
+	if err := h.ping(ctx.Request.Context()); err != nil {
+		return "down"
+	}
+	return "up"
+}
@@ -0,0 +1,55 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestHealthProbes(t *testing.T) {
+	up := func(c context.Context) error { return nil }
+	down := func(c context.Context) error { return errors.New("no primary") }
+	tests := []struct {
+		name     string
+		ping     func(c context.Context) error
+		draining bool
+		path     string
+		status   int
+		want     gin.H
+	}{
+		{"alive", up, false, "/healthz", http.StatusOK, gin.H{"status": "ok", "mongo": "up"}},
+		// Restarting the service would not bring the database back
+		{"alive without mongo", down, false, "/healthz", http.StatusOK, gin.H{"status": "ok", "mongo": "down"}},
+		{"alive while draining", up, true, "/healthz", http.StatusOK, gin.H{"status": "ok", "mongo": "up"}},
+		{"ready", up, false, "/readyz", http.StatusOK, gin.H{"status": "ready", "mongo": "up"}},
+		{"not ready without mongo", down, false, "/readyz", http.StatusServiceUnavailable, gin.H{"status": "unavailable", "mongo": "down"}},
+		{"not ready while draining", up, true, "/readyz", http.StatusServiceUnavailable, gin.H{"status": "shutting down"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := &HealthHandler{ping: tt.ping}
+			if tt.draining {
+				handler.Drain()
+			}
+			router := gin.New()
+			router.GET("/healthz", handler.Healthz())
+			router.GET("/readyz", handler.Readyz())
+
+			var out gin.H
+			if code := serve(t, router, http.MethodGet, tt.path, nil, &out); code != tt.status {
+				t.Fatalf("status = %d, want %d", code, tt.status)
+			}
+			if len(out) != len(tt.want) {
+				t.Fatalf("body = %v, want %v", out, tt.want)
+			}
+			for key, value := range tt.want {
+				if out[key] != value {
+					t.Fatalf("body = %v, want %v", out, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -2,67 +2,100 @@ package controllers
 
 import (
 	"context"
-	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"time"
 
-	"github.com/PranavMasekar/restaurant-management/database"
+	"github.com/PranavMasekar/restaurant-management/apperror"
+	"github.com/PranavMasekar/restaurant-management/helpers"
+	"github.com/PranavMasekar/restaurant-management/metrics"
 	"github.com/PranavMasekar/restaurant-management/models"
+	"github.com/PranavMasekar/restaurant-management/money"
+	"github.com/PranavMasekar/restaurant-management/repository"
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type InvoiceViewFormat struct {
 	Invoice_id       string
 	Payment_method   string
-	order_id         string
+	Order_id         string
 	Payment_status   *string
-	Payment_due      interface{}
+	Payment_due      money.Money
 	Table_number     interface{}
 	Payment_due_date time.Time
 	Order_details    interface{}
 }
 
-var invoiceCollection *mongo.Collection = database.OpenCollection(database.Client, "invoice")
+// InvoiceHandler serves the invoices of the orders
+type InvoiceHandler struct {
+	invoices   repository.InvoiceRepository
+	orders     repository.OrderRepository
+	orderItems repository.OrderItemRepository
+}
+
+func NewInvoiceHandler(invoices repository.InvoiceRepository, orders repository.OrderRepository, orderItems repository.OrderItemRepository) *InvoiceHandler {
+	return &InvoiceHandler{invoices: invoices, orders: orders, orderItems: orderItems}
+}
+
+// What clients can filter, sort and select in the invoice list
+var invoiceListSpec = helpers.ListSpec{
+	Filters: map[string]helpers.FieldKind{
+		"invoice_id":       helpers.StringField,
+		"order_id":         helpers.StringField,
+		"payment_method":   helpers.StringField,
+		"payment_status":   helpers.StringField,
+		"payment_due_date": helpers.TimeField,
+		"created_at":       helpers.TimeField,
+	},
+	Sorts:        []string{"created_at"},
+	Fields:       []string{"order_id", "payment_method", "payment_status", "payment_due_date", "created_at", "updated_at"},
+	Id_field:     "invoice_id",
+	Default_sort: "-created_at",
+	Keyset:       true,
+}
 
-func GetInvoices() gin.HandlerFunc {
+func (h *InvoiceHandler) GetInvoices() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		c, cancel := context.WithTimeout(context.Background(), 100*time.Second)
-		result, err := invoiceCollection.Find(context.TODO(), bson.M{})
+		c, cancel := requestContext(ctx)
 		defer cancel()
+		query, pagination, err := helpers.ParseListQuery(ctx, invoiceListSpec)
 		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing invoices items"})
+			apperror.Respond(ctx, apperror.Invalid(err))
+			return
 		}
-
-		var allInvoices []bson.M
-
-		if err = result.All(c, &allInvoices); err != nil {
-			log.Fatal(err)
+		allInvoices, page, err := h.invoices.List(c, query, pagination)
+		if err != nil {
+			apperror.Respond(ctx, apperror.Internal("error occured while listing invoices items", err))
+			return
 		}
-
-		ctx.JSON(http.StatusOK, allInvoices)
+		ctx.JSON(http.StatusOK, helpers.CursorResponse(ctx, pagination, "invoice_items", page, allInvoices))
 	}
 }
 
-func GetInvoice() gin.HandlerFunc {
+func (h *InvoiceHandler) GetInvoice() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		c, cancel := context.WithTimeout(context.Background(), 100*time.Second)
-		invoiceId := ctx.Param("invoice_id")
-		var invoice models.Invoice
-		err := invoiceCollection.FindOne(c, bson.M{"invoice_id": invoiceId}).Decode(&invoice)
+		c, cancel := requestContext(ctx)
 		defer cancel()
+		invoice, err := h.invoices.FindById(c, ctx.Param("invoice_id"))
+		if err == repository.ErrNotFound {
+			apperror.Respond(ctx, apperror.NotFound("invoice not found"))
+			return
+		}
 		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "errror occured while fetching Invoice item"})
+			apperror.Respond(ctx, apperror.Internal("errror occured while fetching Invoice item", err))
+			return
 		}
 
-		var invoiceView InvoiceViewFormat
+		allOrderItems, err := h.orderItems.ItemsByOrder(c, invoice.Order_id)
+		if err != nil {
+			apperror.Respond(ctx, apperror.Internal("error occured while listing order items by order ID", err))
+			return
+		}
 
-		allOrderItems, err := ItemsByOrder(invoice.Order_id)
-		invoiceView.order_id = invoice.Order_id
+		var invoiceView InvoiceViewFormat
+		invoiceView.Order_id = invoice.Order_id
 		invoiceView.Payment_due_date = invoice.Payment_due_date
 
 		invoiceView.Payment_method = "null"
@@ -71,35 +104,44 @@ func GetInvoice() gin.HandlerFunc {
 		}
 
 		invoiceView.Invoice_id = invoice.Invoice_id
-		invoiceView.Payment_status = *&invoice.Payment_status
-		invoiceView.Payment_due = allOrderItems[0]["payment_due"]
-		invoiceView.Table_number = allOrderItems[0]["table_number"]
-		invoiceView.Order_details = allOrderItems[0]["order_items"]
+		invoiceView.Payment_status = invoice.Payment_status
+		// An order without items has nothing to pay
+		invoiceView.Payment_due = money.New(0, money.DefaultCurrency)
+		if len(allOrderItems) > 0 {
+			if invoiceView.Payment_due, err = money.Decode(allOrderItems[0]["payment_due"]); err != nil {
+				apperror.Respond(ctx, apperror.Internal("error occured while adding up the order items", err))
+				return
+			}
+			invoiceView.Table_number = allOrderItems[0]["table_number"]
+			invoiceView.Order_details = allOrderItems[0]["order_items"]
+		}
 
 		ctx.JSON(http.StatusOK, invoiceView)
 	}
 }
 
-func CreateInvoice() gin.HandlerFunc {
+func (h *InvoiceHandler) CreateInvoice() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		c, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		c, cancel := requestContext(ctx)
+		defer cancel()
 		var invoice models.Invoice
-		err := ctx.BindJSON(&invoice)
-		if err != nil {
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		if err := ctx.ShouldBindJSON(&invoice); err != nil {
+			apperror.Respond(ctx, apperror.Invalid(err))
+			return
 		}
-		var order models.Order
-		err = orderCollection.FindOne(c, bson.M{"order_id": invoice.Order_id}).Decode(&order)
-		defer cancel()
-
-		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Order Not found"})
+		if _, err := h.orders.FindById(c, invoice.Order_id); err != nil {
+			apperror.Respond(ctx, apperror.Validation("Order Not found"))
 			return
 		}
 		status := "PENDING"
 		if invoice.Payment_status == nil {
 			invoice.Payment_status = &status
 		}
+		// Waiters and shared terminals open invoices, only those who take payments may close one
+		if isPaid(invoice) && !canTakePayment(ctx) {
+			apperror.Respond(ctx, apperror.Forbidden("only cashiers and managers can create a paid invoice"))
+			return
+		}
 
 		invoice.Payment_due_date, _ = time.Parse(time.RFC3339, time.Now().AddDate(0, 0, 1).Format(time.RFC3339))
 		invoice.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
@@ -109,74 +151,123 @@ func CreateInvoice() gin.HandlerFunc {
 
 		validationErr := validate.Struct(invoice)
 		if validationErr != nil {
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			apperror.Respond(ctx, apperror.Invalid(validationErr))
 			return
 		}
 
-		result, insertErr := invoiceCollection.InsertOne(c, invoice)
-		if insertErr != nil {
-			msg := fmt.Sprintf("invoice item was not created")
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		if err := h.invoices.Create(c, invoice); err != nil {
+			apperror.Respond(ctx, apperror.Internal("invoice item was not created", err))
 			return
 		}
-		defer cancel()
-
-		ctx.JSON(http.StatusOK, result)
+		if *invoice.Payment_status == "PAID" {
+			h.recordPayment(c, invoice)
+		}
+		ctx.JSON(http.StatusOK, invoice)
 	}
 }
 
-func UpdateInvoice() gin.HandlerFunc {
+func (h *InvoiceHandler) UpdateInvoice() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		c, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		c, cancel := requestContext(ctx)
+		defer cancel()
 
 		var invoice models.Invoice
-		invoiceid := ctx.Param("invoice_id")
+		invoiceId := ctx.Param("invoice_id")
 
-		err := ctx.BindJSON(&invoice)
+		if err := ctx.ShouldBindJSON(&invoice); err != nil {
+			apperror.Respond(ctx, apperror.Invalid(err))
+			return
+		}
+		// Only the fields sent are validated, the others keep their stored value
+		var present []string
+		if invoice.Payment_method != nil {
+			present = append(present, "Payment_method")
+		}
+		if invoice.Payment_status != nil {
+			present = append(present, "Payment_status")
+		}
+		if len(present) > 0 {
+			if validationErr := validate.StructPartial(invoice, present...); validationErr != nil {
+				apperror.Respond(ctx, apperror.Invalid(validationErr))
+				return
+			}
+		}
+		// The previous status tells whether this update is the payment
+		previous, err := h.invoices.FindById(c, invoiceId)
+		if err == repository.ErrNotFound {
+			apperror.Respond(ctx, apperror.NotFound("invoice not found"))
+			return
+		}
 		if err != nil {
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			apperror.Respond(ctx, apperror.Internal("errror occured while fetching Invoice item", err))
+			return
 		}
 
-		filter := bson.M{"invoice_id": invoiceid}
 		var updateObj primitive.D
 
 		if invoice.Payment_method != nil {
-			updateObj = append(updateObj, bson.E{"payment_method", invoice.Payment_method})
+			updateObj = append(updateObj, bson.E{Key: "payment_method", Value: invoice.Payment_method})
 		}
 
 		if invoice.Payment_status != nil {
-			updateObj = append(updateObj, bson.E{"payment_status", invoice.Payment_status})
+			updateObj = append(updateObj, bson.E{Key: "payment_status", Value: invoice.Payment_status})
 		}
 
 		invoice.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
-		updateObj = append(updateObj, bson.E{"updated_at", invoice.Updated_at})
+		updateObj = append(updateObj, bson.E{Key: "updated_at", Value: invoice.Updated_at})
 
-		upsert := true
-		opt := options.UpdateOptions{
-			Upsert: &upsert,
+		err = h.invoices.Update(c, invoiceId, updateObj)
+		if err == repository.ErrNotFound {
+			apperror.Respond(ctx, apperror.NotFound("invoice not found"))
+			return
 		}
-		// Setting default payment status as PENDING
-		status := "PENDING"
-		if invoice.Payment_status == nil {
-			invoice.Payment_status = &status
+		if err != nil {
+			apperror.Respond(ctx, apperror.Internal("invoice item update failed", err))
+			return
 		}
-
-		result, err := invoiceCollection.UpdateOne(
-			c,
-			filter,
-			bson.D{
-
-				{"$set", updateObj},
-			},
-			&opt,
-		)
+		invoice, err = h.invoices.FindById(c, invoiceId)
 		if err != nil {
-			msg := fmt.Sprintf("invoice item update failed")
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			apperror.Respond(ctx, apperror.Internal("errror occured while fetching Invoice item", err))
 			return
 		}
+		if isPaid(invoice) && !isPaid(previous) {
+			h.recordPayment(c, invoice)
+		}
+		ctx.JSON(http.StatusOK, invoice)
+	}
+}
 
-		defer cancel()
-		ctx.JSON(http.StatusOK, result)
+// canTakePayment tells whether the caller holds a role of the cashier-only PATCH /invoices route,
+// on an unscoped token
+func canTakePayment(ctx *gin.Context) bool {
+	if ctx.GetString("scope") != "" {
+		return false
+	}
+	switch ctx.GetString("user_type") {
+	case models.RoleAdmin, models.RoleManager, models.RoleCashier:
+		return true
+	}
+	return false
+}
+
+func isPaid(invoice models.Invoice) bool {
+	return invoice.Payment_status != nil && *invoice.Payment_status == "PAID"
+}
+
+// recordPayment adds a newly paid invoice to the revenue metrics. The amount is what the order
+// costs at that moment, the figure GetInvoice shows.
+func (h *InvoiceHandler) recordPayment(c context.Context, invoice models.Invoice) {
+	method := ""
+	if invoice.Payment_method != nil {
+		method = *invoice.Payment_method
+	}
+	var amount money.Money
+	items, err := h.orderItems.ItemsByOrder(c, invoice.Order_id)
+	if err == nil && len(items) > 0 {
+		amount, err = money.Decode(items[0]["payment_due"])
+	}
+	if err != nil {
+		slog.WarnContext(c, "revenue of a paid invoice was not recorded", "invoice_id", invoice.Invoice_id, "error", err)
 	}
+	metrics.InvoicePaid(method, amount.Float64())
 }
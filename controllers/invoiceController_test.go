@@ -0,0 +1,178 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/PranavMasekar/restaurant-management/helpers"
+	"github.com/PranavMasekar/restaurant-management/models"
+	"github.com/PranavMasekar/restaurant-management/money"
+	"github.com/PranavMasekar/restaurant-management/repository"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestGetInvoice(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	tableId, foodId := seedMenu(t, repos)
+	router := orderItemRouter(repos)
+	handler := NewInvoiceHandler(repos.Invoices, repos.Orders, repos.OrderItems)
+	router.GET("/invoices/:invoice_id", handler.GetInvoice())
+
+	var created struct {
+		Order models.Order `json:"order"`
+	}
+	body := gin.H{"table_id": tableId, "order_items": []gin.H{
+		{"food_id": foodId, "quantity": 2, "modifiers": []gin.H{{"group_id": "size", "option_id": "large"}}},
+		{"food_id": foodId, "modifiers": []gin.H{{"group_id": "size", "option_id": "regular"}}},
+	}}
+	if code := serve(t, router, http.MethodPost, "/orderItems", body, &created); code != http.StatusOK {
+		t.Fatalf("POST /orderItems = %d", code)
+	}
+	emptyOrder := models.Order{ID: primitive.NewObjectID(), Order_Date: time.Now(), Table_id: &tableId}
+	emptyOrder.Order_id = emptyOrder.ID.Hex()
+	if err := repos.Orders.Create(context.Background(), emptyOrder); err != nil {
+		t.Fatal(err)
+	}
+
+	invoiceOf := func(orderId string) string {
+		status := "PENDING"
+		invoice := models.Invoice{ID: primitive.NewObjectID(), Order_id: orderId, Payment_status: &status}
+		invoice.Invoice_id = invoice.ID.Hex()
+		if err := repos.Invoices.Create(context.Background(), invoice); err != nil {
+			t.Fatal(err)
+		}
+		return invoice.Invoice_id
+	}
+
+	tests := []struct {
+		name   string
+		id     string
+		code   int
+		due    money.Money
+		lines  int
+		number float64
+	}{
+		// 2 x 11.50 for the large burgers and 10.00 for the regular one
+		{"order with items", invoiceOf(created.Order.Order_id), http.StatusOK, money.New(3300, money.DefaultCurrency), 2, 7},
+		{"order without items", invoiceOf(emptyOrder.Order_id), http.StatusOK, money.New(0, money.DefaultCurrency), 0, 0},
+		{"unknown invoice", primitive.NewObjectID().Hex(), http.StatusNotFound, money.Money{}, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var view struct {
+				Payment_due   money.Money
+				Table_number  float64
+				Order_details []map[string]interface{}
+			}
+			code := serve(t, router, http.MethodGet, "/invoices/"+tt.id, nil, &view)
+			if code != tt.code {
+				t.Fatalf("GET = %d, want %d", code, tt.code)
+			}
+			if code != http.StatusOK {
+				return
+			}
+			if view.Payment_due != tt.due || len(view.Order_details) != tt.lines || view.Table_number != tt.number {
+				t.Fatalf("invoice = %+v, want %v due on %d lines at table %v", view, tt.due, tt.lines, tt.number)
+			}
+		})
+	}
+}
+
+func TestUpdateInvoice(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	handler := NewInvoiceHandler(repos.Invoices, repos.Orders, repos.OrderItems)
+	router := gin.New()
+	router.PATCH("/invoices/:invoice_id", handler.UpdateInvoice())
+
+	status := "PENDING"
+	invoice := models.Invoice{ID: primitive.NewObjectID(), Order_id: primitive.NewObjectID().Hex(), Payment_status: &status}
+	invoice.Invoice_id = invoice.ID.Hex()
+	if err := repos.Invoices.Create(context.Background(), invoice); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		id     string
+		body   gin.H
+		code   int
+		method string
+		status string
+	}{
+		{"nothing to change", invoice.Invoice_id, gin.H{}, http.StatusOK, "", "PENDING"},
+		{"payment method", invoice.Invoice_id, gin.H{"payment_method": "CARD"}, http.StatusOK, "CARD", "PENDING"},
+		{"unknown payment method", invoice.Invoice_id, gin.H{"payment_method": "BITCOIN"}, http.StatusBadRequest, "", ""},
+		{"unknown payment status", invoice.Invoice_id, gin.H{"payment_status": "REFUNDED"}, http.StatusBadRequest, "", ""},
+		{"empty payment status", invoice.Invoice_id, gin.H{"payment_status": ""}, http.StatusBadRequest, "", ""},
+		{"payment", invoice.Invoice_id, gin.H{"payment_method": "CASH", "payment_status": "PAID"}, http.StatusOK, "CASH", "PAID"},
+		{"unknown invoice", primitive.NewObjectID().Hex(), gin.H{"payment_status": "PAID"}, http.StatusNotFound, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var updated models.Invoice
+			code := serve(t, router, http.MethodPatch, "/invoices/"+tt.id, tt.body, &updated)
+			if code != tt.code {
+				t.Fatalf("PATCH = %d, want %d", code, tt.code)
+			}
+			if code != http.StatusOK {
+				return
+			}
+			method := ""
+			if updated.Payment_method != nil {
+				method = *updated.Payment_method
+			}
+			if method != tt.method || *updated.Payment_status != tt.status {
+				t.Fatalf("invoice paid with %q is %s, want %q and %s", method, *updated.Payment_status, tt.method, tt.status)
+			}
+		})
+	}
+}
+
+func TestCreateInvoiceLeavesPaymentToCashiers(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	tableId, _ := seedMenu(t, repos)
+	order := models.Order{ID: primitive.NewObjectID(), Order_Date: time.Now(), Table_id: &tableId}
+	order.Order_id = order.ID.Hex()
+	if err := repos.Orders.Create(context.Background(), order); err != nil {
+		t.Fatal(err)
+	}
+	handler := NewInvoiceHandler(repos.Invoices, repos.Orders, repos.OrderItems)
+
+	tests := []struct {
+		name   string
+		role   string
+		scope  string
+		status string
+		code   int
+	}{
+		{"waiter opens an invoice", models.RoleWaiter, "", "PENDING", http.StatusOK},
+		{"waiter leaves the status out", models.RoleWaiter, "", "", http.StatusOK},
+		{"waiter creates a paid invoice", models.RoleWaiter, "", "PAID", http.StatusForbidden},
+		{"cashier on a terminal creates a paid invoice", models.RoleCashier, helpers.ScopePOS, "PAID", http.StatusForbidden},
+		{"cashier creates a paid invoice", models.RoleCashier, "", "PAID", http.StatusOK},
+		{"manager creates a paid invoice", models.RoleManager, "", "PAID", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.POST("/invoices", func(ctx *gin.Context) {
+				ctx.Set("user_type", tt.role)
+				ctx.Set("scope", tt.scope)
+			}, handler.CreateInvoice())
+			body := gin.H{"order_id": order.Order_id, "payment_method": "CARD"}
+			if tt.status != "" {
+				body["payment_status"] = tt.status
+			}
+			var created models.Invoice
+			if code := serve(t, router, http.MethodPost, "/invoices", body, &created); code != tt.code {
+				t.Fatalf("POST /invoices = %d, want %d", code, tt.code)
+			}
+			if tt.code == http.StatusOK && tt.status == "" && *created.Payment_status != "PENDING" {
+				t.Fatalf("invoice created %s, want PENDING", *created.Payment_status)
+			}
+		})
+	}
+}
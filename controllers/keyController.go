@@ -0,0 +1,16 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/PranavMasekar/restaurant-management/helpers"
+	"github.com/gin-gonic/gin"
+)
+
+func GetJWKS() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		// Public keys change only on rotation, let other services cache them for a while
+		ctx.Header("Cache-Control", "public, max-age=300")
+		ctx.JSON(http.StatusOK, helpers.Keys.JWKS())
+	}
+}
@@ -1,73 +1,105 @@
 package controllers
 
 import (
-	"context"
-	"fmt"
-	"log"
 	"net/http"
 	"time"
 
-	"github.com/PranavMasekar/restaurant-management/database"
+	"github.com/PranavMasekar/restaurant-management/apperror"
+	"github.com/PranavMasekar/restaurant-management/helpers"
 	"github.com/PranavMasekar/restaurant-management/models"
+	"github.com/PranavMasekar/restaurant-management/repository"
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-var menuCollection *mongo.Collection = database.OpenCollection(database.Client, "menu")
+// MenuHandler serves the menus and the foods that can be ordered from them
+type MenuHandler struct {
+	menus repository.MenuRepository
+	foods repository.FoodRepository
+}
+
+func NewMenuHandler(menus repository.MenuRepository, foods repository.FoodRepository) *MenuHandler {
+	return &MenuHandler{menus: menus, foods: foods}
+}
+
+// ActiveMenu is a menu being served, with its foods
+type ActiveMenu struct {
+	models.Menu
+	Foods []models.Food `json:"foods"`
+}
 
-func GetMenues() gin.HandlerFunc {
+// What clients can filter, sort and select in the menu list
+var menuListSpec = helpers.ListSpec{
+	Filters: map[string]helpers.FieldKind{
+		"name":       helpers.StringField,
+		"category":   helpers.StringField,
+		"menu_id":    helpers.StringField,
+		"start_date": helpers.TimeField,
+		"end_date":   helpers.TimeField,
+		"created_at": helpers.TimeField,
+	},
+	Sorts:        []string{"name", "category", "start_date", "end_date", "created_at", "updated_at"},
+	Fields:       []string{"name", "category", "start_date", "end_date", "timezone", "schedule", "created_at", "updated_at"},
+	Id_field:     "menu_id",
+	Default_sort: "name",
+}
+
+func (h *MenuHandler) GetMenues() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		c, cancel := context.WithTimeout(context.Background(), 100*time.Second)
-		// Get all Menus
-		result, err := menuCollection.Find(context.TODO(), bson.M{})
+		c, cancel := requestContext(ctx)
 		defer cancel()
-
+		query, pagination, err := helpers.ParseListQuery(ctx, menuListSpec)
 		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, bson.M{"error": "error while listening menu items"})
+			apperror.Respond(ctx, apperror.Invalid(err))
 			return
 		}
-		var allMenus []bson.M
-		// Convert menus to slice of menus
-		if err = result.All(c, &allMenus); err != nil {
-			log.Fatal(err)
+		allMenus, total, err := h.menus.List(c, query, pagination)
+		if err != nil {
+			apperror.Respond(ctx, apperror.Internal("error while listening menu items", err))
+			return
 		}
-		// Return all menus
-		ctx.JSON(http.StatusOK, allMenus)
+		ctx.JSON(http.StatusOK, helpers.ListResponse(pagination, "menu_items", total, allMenus))
 	}
-
 }
-func GetMenu() gin.HandlerFunc {
+
+func (h *MenuHandler) GetMenu() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		c, cancel := context.WithTimeout(context.Background(), 100*time.Second)
-		menuId := ctx.Param("menu_id")
-		var menu models.Menu
-		// Find the Menu Item
-		err := foodCollection.FindOne(c, bson.M{"menu_id": menuId}).Decode(&menu)
+		c, cancel := requestContext(ctx)
 		defer cancel()
+		// Find the Menu Item
+		menu, err := h.menus.FindById(c, ctx.Param("menu_id"))
+		if err == repository.ErrNotFound {
+			apperror.Respond(ctx, apperror.NotFound("menu not found"))
+			return
+		}
 		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "errror occured while fetching Menu"})
+			apperror.Respond(ctx, apperror.Internal("errror occured while fetching Menu", err))
+			return
 		}
-
 		ctx.JSON(http.StatusOK, menu)
 	}
 }
-func CreateMenu() gin.HandlerFunc {
+
+func (h *MenuHandler) CreateMenu() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		var menu models.Menu
-		c, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		c, cancel := requestContext(ctx)
 		defer cancel()
-		err := ctx.BindJSON(&menu)
+		err := ctx.ShouldBindJSON(&menu)
 		if err != nil {
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			apperror.Respond(ctx, apperror.Invalid(err))
 			return
 		}
 
 		validationError := validate.Struct(menu)
 		if validationError != nil {
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": validationError.Error()})
+			apperror.Respond(ctx, apperror.Invalid(validationError))
+			return
+		}
+
+		if !inTimeSpan(menu.Start_Date, menu.End_Date) {
+			apperror.Respond(ctx, apperror.Validation("the end date must be after the start date"))
 			return
 		}
 
@@ -77,80 +109,153 @@ func CreateMenu() gin.HandlerFunc {
 		menu.ID = primitive.NewObjectID()
 		menu.Menu_id = menu.ID.Hex()
 
-		result, insertError := menuCollection.InsertOne(c, menu)
-		if insertError != nil {
-			msg := fmt.Sprintf("Menu item was not Created")
-			ctx.JSON(http.StatusInternalServerError, gin.H{"err": msg})
+		if err = h.menus.Create(c, menu); err != nil {
+			apperror.Respond(ctx, apperror.Internal("Menu item was not Created", err))
 			return
 		}
+		ctx.JSON(http.StatusOK, menu)
+	}
+}
+
+// GetActiveMenus lists the menus that can be ordered from at ?at=, an RFC 3339 time that
+// defaults to now, with their foods in stock
+func (h *MenuHandler) GetActiveMenus() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		c, cancel := requestContext(ctx)
 		defer cancel()
-		// response
-		ctx.JSON(http.StatusOK, result)
+		at := time.Now()
+		if value := ctx.Query("at"); value != "" {
+			var err error
+			if at, err = time.Parse(time.RFC3339, value); err != nil {
+				apperror.Respond(ctx, apperror.Validation("at must be an RFC 3339 time like 2024-05-04T09:30:00+02:00",
+					apperror.FieldError{Field: "at", Message: "must be an RFC 3339 time"}))
+				return
+			}
+		}
 
+		candidates, err := h.menus.InEffect(c, at)
+		if err != nil {
+			apperror.Respond(ctx, apperror.Internal("error while listing the active menus", err))
+			return
+		}
+		active := []ActiveMenu{}
+		var menuIds []string
+		for _, menu := range candidates {
+			if helpers.MenuActiveAt(menu, at) {
+				active = append(active, ActiveMenu{Menu: menu, Foods: []models.Food{}})
+				menuIds = append(menuIds, menu.Menu_id)
+			}
+		}
+		if len(active) > 0 {
+			foods, err := h.foods.ByMenus(c, menuIds)
+			if err != nil {
+				apperror.Respond(ctx, apperror.Internal("error while listing the foods of the active menus", err))
+				return
+			}
+			byMenu := map[string]int{}
+			for i, menu := range active {
+				byMenu[menu.Menu_id] = i
+			}
+			for _, food := range foods {
+				if food.Menu_id == nil || !inStock(food) {
+					continue
+				}
+				if i, ok := byMenu[*food.Menu_id]; ok {
+					active[i].Foods = append(active[i].Foods, food)
+				}
+			}
+		}
+		ctx.JSON(http.StatusOK, gin.H{"at": at, "menus": active})
 	}
 }
 
-func inTimeSpan(start, end, check time.Time) bool {
-	return start.After(time.Now()) && end.After(start)
+// inTimeSpan tells whether the dates of a menu make a span, an open end counts as one
+func inTimeSpan(start, end *time.Time) bool {
+	return start == nil || end == nil || end.After(*start)
 }
 
-func UpdateMenu() gin.HandlerFunc {
+func (h *MenuHandler) UpdateMenu() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		c, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		c, cancel := requestContext(ctx)
 		var menu models.Menu
 		defer cancel()
-		err := ctx.BindJSON(&menu)
+		err := ctx.ShouldBindJSON(&menu)
 		if err != nil {
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			apperror.Respond(ctx, apperror.Invalid(err))
 			return
 		}
 
 		menuId := ctx.Param("menu_id")
-		filter := bson.M{"menu_id": menuId}
 
 		var updateObj primitive.D
 
-		if menu.Start_Date != nil && menu.End_Date != nil {
-			if !inTimeSpan(*menu.Start_Date, *menu.End_Date, time.Now()) {
-				msg := "kindly retype the time"
-				ctx.JSON(http.StatusInternalServerError, gin.H{"error": msg})
-				defer cancel()
+		if menu.Start_Date != nil || menu.End_Date != nil {
+			// A single date is checked against the other one, as stored
+			previous, err := h.menus.FindById(c, menuId)
+			if err == repository.ErrNotFound {
+				apperror.Respond(ctx, apperror.NotFound("menu not found"))
 				return
 			}
-			updateObj = append(updateObj, bson.E{Key: "start_date", Value: menu.Start_Date})
-			updateObj = append(updateObj, bson.E{Key: "end_date", Value: menu.End_Date})
-
-			if menu.Name != "" {
-				updateObj = append(updateObj, bson.E{Key: "name", Value: menu.Name})
+			if err != nil {
+				apperror.Respond(ctx, apperror.Internal("errror occured while fetching Menu", err))
+				return
 			}
-			if menu.Category != "" {
-				updateObj = append(updateObj, bson.E{Key: "category", Value: menu.Category})
+			start, end := previous.Start_Date, previous.End_Date
+			if menu.Start_Date != nil {
+				start = menu.Start_Date
+				updateObj = append(updateObj, bson.E{Key: "start_date", Value: menu.Start_Date})
 			}
-
-			menu.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
-			updateObj = append(updateObj, bson.E{Key: "crated_at", Value: menu.Created_at})
-
-			upsert := true
-
-			opt := options.UpdateOptions{
-				Upsert: &upsert,
+			if menu.End_Date != nil {
+				end = menu.End_Date
+				updateObj = append(updateObj, bson.E{Key: "end_date", Value: menu.End_Date})
 			}
-			result, err := menuCollection.UpdateOne(
-				c,
-				filter,
-				bson.D{
-					{Key: "$set", Value: updateObj},
-				},
-				&opt,
-			)
-
-			if err != nil {
-				msg := "menu updation failed"
-				ctx.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			if !inTimeSpan(start, end) {
+				apperror.Respond(ctx, apperror.Validation("the end date must be after the start date"))
+				return
 			}
-			defer cancel()
-			ctx.JSON(http.StatusOK, result)
 		}
+		if menu.Timezone != nil {
+			if err = validate.Var(*menu.Timezone, "timezone"); err != nil {
+				apperror.Respond(ctx, apperror.Validation("invalid timezone",
+					apperror.FieldError{Field: "timezone", Message: "must be a time zone like Europe/Paris"}))
+				return
+			}
+			updateObj = append(updateObj, bson.E{Key: "timezone", Value: menu.Timezone})
+		}
+		// An empty list removes the schedule, the menu is then served all day
+		if menu.Schedule != nil {
+			for _, window := range menu.Schedule {
+				if err = validate.Struct(window); err != nil {
+					apperror.Respond(ctx, apperror.Invalid(err))
+					return
+				}
+			}
+			updateObj = append(updateObj, bson.E{Key: "schedule", Value: menu.Schedule})
+		}
+		if menu.Name != "" {
+			updateObj = append(updateObj, bson.E{Key: "name", Value: menu.Name})
+		}
+		if menu.Category != "" {
+			updateObj = append(updateObj, bson.E{Key: "category", Value: menu.Category})
+		}
+
+		menu.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		updateObj = append(updateObj, bson.E{Key: "updated_at", Value: menu.Updated_at})
 
+		err = h.menus.Update(c, menuId, updateObj)
+		if err == repository.ErrNotFound {
+			apperror.Respond(ctx, apperror.NotFound("menu not found"))
+			return
+		}
+		if err != nil {
+			apperror.Respond(ctx, apperror.Internal("menu updation failed", err))
+			return
+		}
+		menu, err = h.menus.FindById(c, menuId)
+		if err != nil {
+			apperror.Respond(ctx, apperror.Internal("errror occured while fetching Menu", err))
+			return
+		}
+		ctx.JSON(http.StatusOK, menu)
 	}
 }
@@ -2,162 +2,165 @@ package controllers
 
 import (
 	"context"
-	"fmt"
-	"log"
 	"net/http"
 	"time"
 
-	"github.com/PranavMasekar/restaurant-management/database"
+	"github.com/PranavMasekar/restaurant-management/apperror"
+	"github.com/PranavMasekar/restaurant-management/helpers"
+	"github.com/PranavMasekar/restaurant-management/metrics"
 	"github.com/PranavMasekar/restaurant-management/models"
+	"github.com/PranavMasekar/restaurant-management/repository"
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-var orderCollection *mongo.Collection = database.OpenCollection(database.Client, "order")
-var c, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+// OrderHandler serves the orders taken at the tables
+type OrderHandler struct {
+	orders repository.OrderRepository
+	tables repository.TableRepository
+}
+
+func NewOrderHandler(orders repository.OrderRepository, tables repository.TableRepository) *OrderHandler {
+	return &OrderHandler{orders: orders, tables: tables}
+}
 
-func GetOrders() gin.HandlerFunc {
+// What clients can filter, sort and select in the order list
+var orderListSpec = helpers.ListSpec{
+	Filters: map[string]helpers.FieldKind{
+		"order_id":   helpers.StringField,
+		"table_id":   helpers.StringField,
+		"order_date": helpers.TimeField,
+		"created_at": helpers.TimeField,
+	},
+	Sorts:        []string{"created_at"},
+	Fields:       []string{"order_date", "table_id", "created_at", "updated_at"},
+	Id_field:     "order_id",
+	Default_sort: "-created_at",
+	Keyset:       true,
+}
+
+func (h *OrderHandler) GetOrders() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		c, cancel := context.WithTimeout(context.Background(), 100*time.Second)
-		result, err := orderCollection.Find(context.TODO(), bson.M{})
+		c, cancel := requestContext(ctx)
 		defer cancel()
+		query, pagination, err := helpers.ParseListQuery(ctx, orderListSpec)
 		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing order items"})
+			apperror.Respond(ctx, apperror.Invalid(err))
+			return
 		}
-		var allOrders []bson.M
-		if err = result.All(c, &allOrders); err != nil {
-			log.Fatal(err)
+		allOrders, page, err := h.orders.List(c, query, pagination)
+		if err != nil {
+			apperror.Respond(ctx, apperror.Internal("error occured while listing order items", err))
+			return
 		}
-		ctx.JSON(http.StatusOK, allOrders)
+		ctx.JSON(http.StatusOK, helpers.CursorResponse(ctx, pagination, "order_items", page, allOrders))
 	}
 }
-func GetOrder() gin.HandlerFunc {
-	return func(ctx *gin.Context) {
-		c, cancel := context.WithTimeout(context.Background(), 100*time.Second)
-		orderId := ctx.Param("order_id")
-
-		var order models.Order
 
-		err := orderCollection.FindOne(c, bson.M{"order_id": orderId}).Decode(&order)
+func (h *OrderHandler) GetOrder() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		c, cancel := requestContext(ctx)
 		defer cancel()
+		order, err := h.orders.FindById(c, ctx.Param("order_id"))
+		if err == repository.ErrNotFound {
+			apperror.Respond(ctx, apperror.NotFound("order not found"))
+			return
+		}
 		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "errror occured while fetching Order"})
+			apperror.Respond(ctx, apperror.Internal("errror occured while fetching Order", err))
+			return
 		}
 		ctx.JSON(http.StatusOK, order)
 	}
 }
-func CreateOrder() gin.HandlerFunc {
+
+func (h *OrderHandler) CreateOrder() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		c, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		c, cancel := requestContext(ctx)
 		defer cancel()
 
 		var order models.Order
-		var table models.Table
 
-		err := ctx.BindJSON(&order)
-
-		if err != nil {
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		if err := ctx.ShouldBindJSON(&order); err != nil {
+			apperror.Respond(ctx, apperror.Invalid(err))
+			return
 		}
 
 		validationError := validate.Struct(order)
 
 		if validationError != nil {
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": validationError.Error()})
+			apperror.Respond(ctx, apperror.Invalid(validationError))
 			return
 		}
 
-		if order.Table_id != nil {
-			err := tableCollection.FindOne(c, bson.M{"table_id": order.Table_id}).Decode(&table)
-			defer cancel()
-			if err != nil {
-				msg := fmt.Sprintf("message:Table was not found")
-				ctx.JSON(http.StatusInternalServerError, gin.H{"error": msg})
-				return
-			}
+		if _, err := h.tables.FindById(c, *order.Table_id); err != nil {
+			apperror.Respond(ctx, apperror.Validation("Table was not found"))
+			return
 		}
 
-		order.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
-		order.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
-
-		order.ID = primitive.NewObjectID()
-		order.Order_id = order.ID.Hex()
-
-		result, insertError := orderCollection.InsertOne(c, order)
-
-		if insertError != nil {
-			msg := fmt.Sprintf("Food item was not inserted")
-			ctx.JSON(http.StatusInternalServerError, gin.H{"err": msg})
+		order, err := createOrder(c, h.orders, order)
+		if err != nil {
+			apperror.Respond(ctx, apperror.Internal("Order was not inserted", err))
 			return
 		}
-		defer cancel()
-		ctx.JSON(http.StatusOK, result)
-
+		ctx.JSON(http.StatusOK, order)
 	}
 }
-func UpdateOrder() gin.HandlerFunc {
+
+func (h *OrderHandler) UpdateOrder() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		var table models.Table
+		c, cancel := requestContext(ctx)
+		defer cancel()
 		var order models.Order
-		var c, cancel = context.WithTimeout(context.Background(), 100*time.Second)
 		var updateObj primitive.D
 
 		orderId := ctx.Param("order_id")
 
-		if err := ctx.BindJSON(&order); err != nil {
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		if err := ctx.ShouldBindJSON(&order); err != nil {
+			apperror.Respond(ctx, apperror.Invalid(err))
 			return
 		}
 
 		if order.Table_id != nil {
-			err := orderCollection.FindOne(ctx, bson.M{"tabled_id": order.Table_id}).Decode(&table)
-			defer cancel()
-			if err != nil {
-				msg := fmt.Sprintf("message:Table was not found")
-				ctx.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			if _, err := h.tables.FindById(c, *order.Table_id); err != nil {
+				apperror.Respond(ctx, apperror.Validation("Table was not found"))
 				return
 			}
-			updateObj = append(updateObj, bson.E{"menu", order.Table_id})
+			updateObj = append(updateObj, bson.E{Key: "table_id", Value: order.Table_id})
 		}
 
 		order.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
-		updateObj = append(updateObj, bson.E{"updated_at", order.Updated_at})
-
-		upsert := true
-		filter := bson.M{"order_id": orderId}
+		updateObj = append(updateObj, bson.E{Key: "updated_at", Value: order.Updated_at})
 
-		opt := options.UpdateOptions{
-			Upsert: &upsert,
+		err := h.orders.Update(c, orderId, updateObj)
+		if err == repository.ErrNotFound {
+			apperror.Respond(ctx, apperror.NotFound("order not found"))
+			return
 		}
-
-		result, err := foodCollection.UpdateOne(
-			c,
-			filter,
-			bson.D{
-				{"$set", updateObj},
-			},
-			&opt,
-		)
 		if err != nil {
-			msg := fmt.Sprint("food item update failed")
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			apperror.Respond(ctx, apperror.Internal("order update failed", err))
 			return
 		}
-
-		ctx.JSON(http.StatusOK, result)
+		order, err = h.orders.FindById(c, orderId)
+		if err != nil {
+			apperror.Respond(ctx, apperror.Internal("errror occured while fetching Order", err))
+			return
+		}
+		ctx.JSON(http.StatusOK, order)
 	}
 }
 
-func OrderItemOrderCreator(order models.Order) string {
+// createOrder stores a new order, giving it its id and timestamps
+func createOrder(c context.Context, orders repository.OrderRepository, order models.Order) (models.Order, error) {
 	order.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 	order.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 	order.ID = primitive.NewObjectID()
 	order.Order_id = order.ID.Hex()
 
-	orderCollection.InsertOne(c, order)
-	defer cancel()
-	return order.Order_id
+	if err := orders.Create(c, order); err != nil {
+		return order, err
+	}
+	metrics.OrdersCreated.Inc()
+	return order, nil
 }
@@ -2,17 +2,17 @@ package controllers
 
 import (
 	"context"
-	"log"
+	"fmt"
 	"net/http"
 	"time"
 
-	"github.com/PranavMasekar/restaurant-management/database"
+	"github.com/PranavMasekar/restaurant-management/apperror"
+	"github.com/PranavMasekar/restaurant-management/helpers"
 	"github.com/PranavMasekar/restaurant-management/models"
+	"github.com/PranavMasekar/restaurant-management/repository"
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type OrderItemPack struct {
@@ -20,280 +20,318 @@ type OrderItemPack struct {
 	Order_items []models.OrderItem
 }
 
-var orderItemCollection *mongo.Collection = database.OpenCollection(database.Client, "orderItem")
+// OrderItemHandler serves the lines of the orders
+type OrderItemHandler struct {
+	orderItems repository.OrderItemRepository
+	orders     repository.OrderRepository
+	tables     repository.TableRepository
+	foods      repository.FoodRepository
+	menus      repository.MenuRepository
+}
+
+func NewOrderItemHandler(orderItems repository.OrderItemRepository, orders repository.OrderRepository, tables repository.TableRepository, foods repository.FoodRepository, menus repository.MenuRepository) *OrderItemHandler {
+	return &OrderItemHandler{orderItems: orderItems, orders: orders, tables: tables, foods: foods, menus: menus}
+}
 
-func GetOrderItems() gin.HandlerFunc {
+// What clients can filter, sort and select in the order item list
+var orderItemListSpec = helpers.ListSpec{
+	Filters: map[string]helpers.FieldKind{
+		"order_item_id": helpers.StringField,
+		"order_id":      helpers.StringField,
+		"food_id":       helpers.StringField,
+		"quantity":      helpers.NumberField,
+		"unit_price":    helpers.MoneyField,
+		"tax_class":     helpers.StringField,
+		"created_at":    helpers.TimeField,
+	},
+	Sorts:        []string{"created_at"},
+	Fields:       []string{"order_id", "food_id", "quantity", "modifiers", "unit_price", "food_name", "tax_class", "created_at", "updated_at"},
+	Id_field:     "order_item_id",
+	Default_sort: "-created_at",
+	Keyset:       true,
+}
+
+func (h *OrderItemHandler) GetOrderItems() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		c, cancel := context.WithTimeout(context.Background(), 100*time.Second)
-		result, err := orderItemCollection.Find(context.TODO(), bson.M{})
+		c, cancel := requestContext(ctx)
 		defer cancel()
+		query, pagination, err := helpers.ParseListQuery(ctx, orderItemListSpec)
 		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing ordered items"})
+			apperror.Respond(ctx, apperror.Invalid(err))
 			return
 		}
-		var allOrderItems []bson.M
-		if err = result.All(c, &allOrderItems); err != nil {
-			log.Fatal(err)
+		allOrderItems, page, err := h.orderItems.List(c, query, pagination)
+		if err != nil {
+			apperror.Respond(ctx, apperror.Internal("error occured while listing ordered items", err))
 			return
 		}
-		ctx.JSON(http.StatusOK, allOrderItems)
+		ctx.JSON(http.StatusOK, helpers.CursorResponse(ctx, pagination, "order_items", page, allOrderItems))
 	}
 }
-func GetOrderItemsByOrder() gin.HandlerFunc {
+
+func (h *OrderItemHandler) GetOrderItemsByOrder() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		orderId := ctx.Param("order_id")
+		c, cancel := requestContext(ctx)
+		defer cancel()
 		// Get all items of particular order
-		allOrderItems, err := ItemsByOrder(orderId)
+		allOrderItems, err := h.orderItems.ItemsByOrder(c, ctx.Param("order_id"))
 		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing order items by order ID"})
+			apperror.Respond(ctx, apperror.Internal("error occured while listing order items by order ID", err))
 			return
 		}
 		ctx.JSON(http.StatusOK, allOrderItems)
 	}
 }
 
-func ItemsByOrder(id string) (OrderItems []primitive.M, err error) {
-	c, cancel := context.WithTimeout(context.Background(), 100*time.Second)
-
-	matchStage := bson.D{
-		{"$match", bson.D{
-			{"order_id", id},
-		},
-		},
-	}
-
-	// lookup => used to look Up in particular collection i.e. food in this case
-	lookUpStage := bson.D{
-		{"$lookup", bson.D{
-			{"from", "food"},
-			{"localField", "food_id"},
-			{"foreignField", "food_id"},
-			{"as", "food"},
-		},
-		},
-	}
-	// LookUp stage gives array and to perform actions on it we have to unwind the array
-	unwindStage := bson.D{
-		{"$unwind", bson.D{
-			{"path", "$food"},
-			{"preserveNullAndEmptyArrays", true},
-		},
-		},
-	}
-
-	lookupOrderStage := bson.D{
-		{"$lookup", bson.D{
-			{"from", "order"},
-			{"localField", "order_id"},
-			{"foreignField", "order_id"},
-			{"as", "order"},
-		},
-		},
-	}
-	unwindOrderStage := bson.D{
-		{"$unwind", bson.D{
-			{"path", "$order"},
-			{"preserveNullAndEmptyArrays", true},
-		},
-		},
-	}
-
-	lookupTableStage := bson.D{
-		{"$lookup", bson.D{
-			{"from", "table"},
-			{"localField", "order.table_id"},
-			{"foreignField", "table_id"},
-			{"as", "table"},
-		},
-		},
-	}
-	unwindTableStage := bson.D{
-		{"$unwind", bson.D{
-			{"path", "$table"},
-			{"preserveNullAndEmptyArrays", true},
-		},
-		},
-	}
-
-	projectStage := bson.D{
-		{
-			"$project", bson.D{
-				{"id", 0},
-				{"amount", "$food.price"},
-				{"total_count", 1},
-				{"food_name", "$food.name"},
-				{"food_image", "$food.food_image"},
-				{"table_number", "$table.table_number"},
-				{"table_id", "$table.table_id"},
-				{"order_id", "$order.order_id"},
-				{"price", "$food.price"},
-				{"quantity", 1},
-			},
-		},
-	}
-
-	groupStage := bson.D{
-		{"$group", bson.D{
-			{"_id", bson.D{
-				{"order_id", "$order_id"},
-				{"table_id", "$table_id"},
-				{"table_number", "$table_number"},
-			},
-			},
-			{"payment_due", bson.D{
-				{"$sum", "$amount"},
-			},
-			},
-			{"total_count", bson.D{
-				{"$sum", 1},
-			},
-			},
-			{"order_items", bson.D{
-				{"$push", "$$ROOT"},
-			},
-			},
-		},
-		},
-	}
-
-	projectStage2 := bson.D{
-		{"$project", bson.D{
-
-			{"id", 0},
-			{"payment_due", 1},
-			{"total_count", 1},
-			{"table_number", "$_id.table_number"},
-			{"order_items", 1},
-		},
-		},
-	}
-
-	result, err := orderItemCollection.Aggregate(c, mongo.Pipeline{
-		matchStage,
-		lookUpStage,
-		unwindStage,
-		lookupOrderStage,
-		unwindOrderStage,
-		lookupTableStage,
-		unwindTableStage,
-		projectStage,
-		groupStage,
-		projectStage2,
-	},
-	)
-	if err != nil {
-		panic(err)
-	}
-	if err = result.All(c, &OrderItems); err != nil {
-		panic(err)
-	}
-	defer cancel()
-	return OrderItems, err
-}
-
-func GetOrderItem() gin.HandlerFunc {
+func (h *OrderItemHandler) GetOrderItem() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		c, cancel := context.WithTimeout(context.Background(), 100*time.Second)
-		orderItemId := ctx.Param("order_item_id")
-		var orderItem models.OrderItem
-		err := orderItemCollection.FindOne(c, bson.M{"orderItem_id": orderItemId}).Decode(&orderItem)
+		c, cancel := requestContext(ctx)
 		defer cancel()
+		orderItem, err := h.orderItems.FindById(c, ctx.Param("order_item_id"))
+		if err == repository.ErrNotFound {
+			apperror.Respond(ctx, apperror.NotFound("order item not found"))
+			return
+		}
 		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, bson.M{"error": "error occured while listing item"})
+			apperror.Respond(ctx, apperror.Internal("error occured while listing item", err))
 			return
 		}
 		ctx.JSON(http.StatusOK, orderItem)
 	}
 }
-func CreateOrderItem() gin.HandlerFunc {
+
+// CreateOrderItem opens a new order at a table with all its items
+func (h *OrderItemHandler) CreateOrderItem() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		c, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		c, cancel := requestContext(ctx)
+		defer cancel()
 
 		var orderItemPack OrderItemPack
 		var order models.Order
 
-		if err := ctx.BindJSON(&order); err != nil {
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		if err := ctx.ShouldBindJSON(&orderItemPack); err != nil {
+			apperror.Respond(ctx, apperror.Invalid(err))
+			return
+		}
+		if orderItemPack.Table_id == nil || len(orderItemPack.Order_items) == 0 {
+			apperror.Respond(ctx, apperror.Validation("a table and at least one order item are required"))
+			return
+		}
+		if _, err := h.tables.FindById(c, *orderItemPack.Table_id); err != nil {
+			apperror.Respond(ctx, apperror.Validation("Table was not found"))
 			return
 		}
 
 		order.Order_Date, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
-
-		orderItemsToBeInserted := []interface{}{}
-
 		order.Table_id = orderItemPack.Table_id
-		order_id := OrderItemOrderCreator(order)
-
-		for _, orderItem := range orderItemPack.Order_items {
-			orderItem.Order_id = order_id
-
-			validationErr := validate.Struct(orderItem)
 
-			if validationErr != nil {
-				ctx.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+		// Every rejected line is reported at once, so that the whole order can be fixed in one go
+		var lineErrors []apperror.FieldError
+		menus := map[string]*models.Menu{}
+		orderItemsToBeInserted := []models.OrderItem{}
+		for i, orderItem := range orderItemPack.Order_items {
+			line := fmt.Sprintf("order_items[%d]", i)
+			// The order id is only known once the order is created
+			if validationErr := validate.StructExcept(orderItem, "Order_id"); validationErr != nil {
+				for _, detail := range apperror.Invalid(validationErr).Details {
+					lineErrors = append(lineErrors, apperror.FieldError{Field: line + "." + detail.Field, Message: detail.Message})
+				}
+				continue
+			}
+			food, reason, err := h.unorderable(c, *orderItem.Food_id, order.Order_Date, menus)
+			if err != nil {
+				apperror.Respond(ctx, apperror.Internal("error occured while checking the ordered foods", err))
 				return
 			}
+			if reason != "" {
+				lineErrors = append(lineErrors, apperror.FieldError{Field: line + ".food_id", Message: reason})
+				continue
+			}
+			if orderItem.Quantity == nil {
+				one := 1
+				orderItem.Quantity = &one
+			}
 			orderItem.ID = primitive.NewObjectID()
 			orderItem.Order_item_id = orderItem.ID.Hex()
 			orderItem.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 			orderItem.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
-			var num = toFixed(*orderItem.Unit_price, 2)
-			orderItem.Unit_price = &num
+			// Whatever price the client sent, the line costs what the food and its modifiers cost now
+			if problem := snapshotFood(&orderItem, food); problem != "" {
+				lineErrors = append(lineErrors, apperror.FieldError{Field: line + ".modifiers", Message: problem})
+				continue
+			}
 			orderItemsToBeInserted = append(orderItemsToBeInserted, orderItem)
 		}
+		if len(lineErrors) > 0 {
+			apperror.Respond(ctx, apperror.Validation("some order items cannot be ordered", lineErrors...))
+			return
+		}
 
-		insertedOrderItems, err := orderItemCollection.InsertMany(c, orderItemsToBeInserted)
-
+		order, err := createOrder(c, h.orders, order)
 		if err != nil {
-			log.Fatal(err)
+			apperror.Respond(ctx, apperror.Internal("Order was not inserted", err))
+			return
 		}
-		defer cancel()
-		ctx.JSON(http.StatusOK, insertedOrderItems)
+		for i := range orderItemsToBeInserted {
+			orderItemsToBeInserted[i].Order_id = order.Order_id
+		}
+		if err = h.orderItems.Create(c, orderItemsToBeInserted...); err != nil {
+			apperror.Respond(ctx, apperror.Internal("Order items were not inserted", err))
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"order": order, "order_items": orderItemsToBeInserted})
 	}
 }
-func UpdateOrderItem() gin.HandlerFunc {
+
+func (h *OrderItemHandler) UpdateOrderItem() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		c, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		c, cancel := requestContext(ctx)
+		defer cancel()
 
 		var orderItem models.OrderItem
 
-		orderItemid := ctx.Param("order_item_id")
-		filter := bson.M{"orderItem_id": orderItemid}
-
-		var updatedObj primitive.D
+		orderItemId := ctx.Param("order_item_id")
 
-		if orderItem.Unit_price != nil {
-			updatedObj = append(updatedObj, bson.E{"unit_price", *&orderItem.Unit_price})
+		if err := ctx.ShouldBindJSON(&orderItem); err != nil {
+			apperror.Respond(ctx, apperror.Invalid(err))
+			return
 		}
 
+		var updatedObj primitive.D
+
 		if orderItem.Quantity != nil {
-			updatedObj = append(updatedObj, bson.E{"quantity", *&orderItem.Quantity})
+			if err := validate.Var(*orderItem.Quantity, "min=1,max=99"); err != nil {
+				apperror.Respond(ctx, apperror.Validation("the request is invalid",
+					apperror.FieldError{Field: "quantity", Message: "must be between 1 and 99"}))
+				return
+			}
+			updatedObj = append(updatedObj, bson.E{Key: "quantity", Value: orderItem.Quantity})
 		}
-		if orderItem.Food_id != nil {
-			updatedObj = append(updatedObj, bson.E{"food_id", *orderItem.Food_id})
+		// The price only changes with the food and its modifiers, the unit_price of the request is
+		// ignored. A new food starts without modifiers, those of the previous one do not apply.
+		if orderItem.Food_id != nil || orderItem.Modifiers != nil {
+			for _, modifier := range orderItem.Modifiers {
+				if err := validate.Struct(modifier); err != nil {
+					apperror.Respond(ctx, apperror.Invalid(err))
+					return
+				}
+			}
+			if orderItem.Food_id == nil {
+				previous, err := h.orderItems.FindById(c, orderItemId)
+				if err == repository.ErrNotFound {
+					apperror.Respond(ctx, apperror.NotFound("order item not found"))
+					return
+				}
+				if err != nil {
+					apperror.Respond(ctx, apperror.Internal("error occured while listing item", err))
+					return
+				}
+				orderItem.Food_id = previous.Food_id
+			}
+			food, reason, err := h.unorderable(c, *orderItem.Food_id, time.Now(), map[string]*models.Menu{})
+			if err != nil {
+				apperror.Respond(ctx, apperror.Internal("error occured while checking the ordered food", err))
+				return
+			}
+			if reason != "" {
+				apperror.Respond(ctx, apperror.Validation("the food cannot be ordered",
+					apperror.FieldError{Field: "food_id", Message: reason}))
+				return
+			}
+			if problem := snapshotFood(&orderItem, food); problem != "" {
+				apperror.Respond(ctx, apperror.Validation("the modifiers cannot be ordered",
+					apperror.FieldError{Field: "modifiers", Message: problem}))
+				return
+			}
+			updatedObj = append(updatedObj, bson.E{Key: "food_id", Value: orderItem.Food_id})
+			updatedObj = append(updatedObj, bson.E{Key: "modifiers", Value: orderItem.Modifiers})
+			updatedObj = append(updatedObj, bson.E{Key: "unit_price", Value: orderItem.Unit_price})
+			updatedObj = append(updatedObj, bson.E{Key: "food_name", Value: orderItem.Food_name})
+			updatedObj = append(updatedObj, bson.E{Key: "tax_class", Value: orderItem.Tax_class})
 		}
 
 		orderItem.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
-		updatedObj = append(updatedObj, bson.E{"updated_at", orderItem.Updated_at})
+		updatedObj = append(updatedObj, bson.E{Key: "updated_at", Value: orderItem.Updated_at})
 
-		upsert := true
-		opt := options.UpdateOptions{
-			Upsert: &upsert,
+		err := h.orderItems.Update(c, orderItemId, updatedObj)
+		if err == repository.ErrNotFound {
+			apperror.Respond(ctx, apperror.NotFound("order item not found"))
+			return
 		}
-		result, err := orderItemCollection.UpdateOne(
-			c,
-			filter,
-			bson.D{
-				{"$set", updatedObj},
-			},
-			&opt,
-		)
 		if err != nil {
-			msg := "Order item update failed"
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			apperror.Respond(ctx, apperror.Internal("Order item update failed", err))
 			return
 		}
-		defer cancel()
-		ctx.JSON(http.StatusOK, result)
+		orderItem, err = h.orderItems.FindById(c, orderItemId)
+		if err != nil {
+			apperror.Respond(ctx, apperror.Internal("error occured while listing item", err))
+			return
+		}
+		ctx.JSON(http.StatusOK, orderItem)
+	}
+}
+
+// unorderable returns the food and tells why it cannot be ordered at the instant at, "" when it can.
+// The menus already looked up are kept in menus, orders often have several foods of the same menu.
+func (h *OrderItemHandler) unorderable(c context.Context, foodId string, at time.Time, menus map[string]*models.Menu) (models.Food, string, error) {
+	food, err := h.foods.FindById(c, foodId)
+	if err == repository.ErrNotFound {
+		return food, "food not found", nil
+	}
+	if err != nil {
+		return food, "", err
+	}
+	if food.Menu_id == nil {
+		return food, "the food is not on a menu", nil
+	}
+	menu, ok := menus[*food.Menu_id]
+	if !ok {
+		found, err := h.menus.FindById(c, *food.Menu_id)
+		if err != nil && err != repository.ErrNotFound {
+			return food, "", err
+		}
+		if err == nil {
+			menu = &found
+		}
+		menus[*food.Menu_id] = menu
+	}
+	if menu == nil {
+		return food, "the menu of the food no longer exists", nil
+	}
+	if !helpers.MenuActiveAt(*menu, at) {
+		return food, fmt.Sprintf("the %s menu is not served at this time", menu.Name), nil
+	}
+	if !inStock(food) {
+		return food, "the food is out of stock", nil
+	}
+	if food.Price == nil {
+		return food, "the food has no price", nil
+	}
+	return food, "", nil
+}
+
+// snapshotFood copies onto the order item what the invoice and the kitchen need to know about its
+// food and the modifiers picked. It returns why the modifiers are refused, "" when they are valid.
+func snapshotFood(orderItem *models.OrderItem, food models.Food) string {
+	modifiers, problem := helpers.SelectModifiers(food, orderItem.Modifiers)
+	if problem != "" {
+		return problem
+	}
+	price := *food.Price
+	for _, modifier := range modifiers {
+		var err error
+		if price, err = price.Add(modifier.Price_delta); err != nil {
+			return fmt.Sprintf("%s is priced in %s but the food in %s, ask a manager to fix the menu",
+				modifier.Name, modifier.Price_delta.Currency, food.Price.Currency)
+		}
+	}
+	if price.IsNegative() {
+		return "the modifiers cost less than nothing"
 	}
+	tax := taxClass(food)
+	orderItem.Modifiers = modifiers
+	orderItem.Unit_price = &price
+	orderItem.Food_name = food.Name
+	orderItem.Tax_class = &tax
+	return ""
 }
@@ -0,0 +1,356 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/PranavMasekar/restaurant-management/models"
+	"github.com/PranavMasekar/restaurant-management/money"
+	"github.com/PranavMasekar/restaurant-management/repository"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// serve runs a request through router and decodes the JSON body of the response into out
+func serve(t *testing.T, router *gin.Engine, method, target string, body interface{}, out interface{}) int {
+	t.Helper()
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req := httptest.NewRequest(method, target, &payload)
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if out != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			t.Fatalf("%s %s: cannot decode %q: %v", method, target, rec.Body.String(), err)
+		}
+	}
+	return rec.Code
+}
+
+// seedMenu stores a table and a menu served all day with a burger of 10.00, whose size
+// costs 1.50 more when large
+func seedMenu(t *testing.T, repos repository.Repositories) (tableId string, foodId string) {
+	t.Helper()
+	c := context.Background()
+	guests, number := 4, 7
+	table := models.Table{ID: primitive.NewObjectID(), Number_of_guests: &guests, Table_number: &number}
+	table.Table_id = table.ID.Hex()
+	menu := models.Menu{ID: primitive.NewObjectID(), Name: "Lunch", Category: "mains"}
+	menu.Menu_id = menu.ID.Hex()
+
+	name, image := "Burger", "burger.png"
+	price, large := money.New(1000, money.DefaultCurrency), money.New(150, money.DefaultCurrency)
+	food := models.Food{ID: primitive.NewObjectID(), Name: &name, Price: &price, Food_image: &image, Menu_id: &menu.Menu_id,
+		Modifier_groups: []models.ModifierGroup{{
+			Group_id: "size", Name: "Size", Required: true, Max_selections: 1,
+			Options: []models.ModifierOption{{Option_id: "regular", Name: "Regular"}, {Option_id: "large", Name: "Large", Price_delta: &large}},
+		}},
+	}
+	food.Food_id = food.ID.Hex()
+
+	if err := repos.Tables.Create(c, table); err != nil {
+		t.Fatal(err)
+	}
+	if err := repos.Menus.Create(c, menu); err != nil {
+		t.Fatal(err)
+	}
+	if err := repos.Foods.Create(c, food); err != nil {
+		t.Fatal(err)
+	}
+	return table.Table_id, food.Food_id
+}
+
+func orderItemRouter(repos repository.Repositories) *gin.Engine {
+	handler := NewOrderItemHandler(repos.OrderItems, repos.Orders, repos.Tables, repos.Foods, repos.Menus)
+	router := gin.New()
+	router.GET("/orderItems", handler.GetOrderItems())
+	router.POST("/orderItems", handler.CreateOrderItem())
+	router.PATCH("/orderItems/:order_item_id", handler.UpdateOrderItem())
+	return router
+}
+
+type orderItemPage struct {
+	Next_cursor *string            `json:"next_cursor"`
+	Prev_cursor *string            `json:"prev_cursor"`
+	Order_items []models.OrderItem `json:"order_items"`
+}
+
+func TestGetOrderItemsWalksTheCursors(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	var ids []string
+	for i := 0; i < 5; i++ {
+		foodId := "food"
+		item := models.OrderItem{ID: primitive.NewObjectID(), Food_id: &foodId, Order_id: "order", Created_at: start.Add(time.Duration(i) * time.Minute)}
+		item.Order_item_id = item.ID.Hex()
+		// Two items share a created_at, the _id breaks the tie
+		if i == 3 {
+			item.Created_at = start.Add(2 * time.Minute)
+		}
+		if err := repos.OrderItems.Create(context.Background(), item); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, item.Order_item_id)
+	}
+	router := orderItemRouter(repos)
+	// Newest first, the item of index 3 sorts right after index 4 and before index 2
+	want := []string{ids[4], ids[3], ids[2], ids[1], ids[0]}
+
+	var pages []orderItemPage
+	target := "/orderItems?limit=2"
+	for len(pages) < 10 {
+		var page orderItemPage
+		if code := serve(t, router, http.MethodGet, target, nil, &page); code != http.StatusOK {
+			t.Fatalf("GET %s = %d", target, code)
+		}
+		pages = append(pages, page)
+		if page.Next_cursor == nil {
+			break
+		}
+		target = "/orderItems?limit=2&cursor=" + url.QueryEscape(*page.Next_cursor)
+	}
+
+	var got []string
+	for _, page := range pages {
+		for _, item := range page.Order_items {
+			got = append(got, item.Order_item_id)
+		}
+	}
+	if len(got) != len(want) {
+		t.Fatalf("walked %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("walked %v, want %v", got, want)
+		}
+	}
+	if len(pages) != 3 || pages[0].Prev_cursor != nil || pages[2].Prev_cursor == nil {
+		t.Fatalf("the first page must have no prev_cursor and the last one a prev_cursor")
+	}
+
+	// Going back from the last page gives the second one again
+	var back orderItemPage
+	serve(t, router, http.MethodGet, "/orderItems?limit=2&cursor="+url.QueryEscape(*pages[2].Prev_cursor), nil, &back)
+	if len(back.Order_items) != 2 || back.Order_items[0].Order_item_id != want[2] || back.Order_items[1].Order_item_id != want[3] {
+		t.Fatalf("prev page = %+v, want %v", back.Order_items, want[2:4])
+	}
+	if back.Next_cursor == nil || back.Prev_cursor == nil {
+		t.Fatalf("the middle page must link both ways")
+	}
+
+	if code := serve(t, router, http.MethodGet, "/orderItems?cursor=not-a-cursor", nil, nil); code != http.StatusBadRequest {
+		t.Fatalf("a tampered cursor = %d, want %d", code, http.StatusBadRequest)
+	}
+}
+
+func TestCreateAndUpdateOrderItem(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	tableId, foodId := seedMenu(t, repos)
+	router := orderItemRouter(repos)
+
+	var created struct {
+		Order       models.Order       `json:"order"`
+		Order_items []models.OrderItem `json:"order_items"`
+	}
+	body := gin.H{"table_id": tableId, "order_items": []gin.H{{
+		"food_id":    foodId,
+		"quantity":   2,
+		"modifiers":  []gin.H{{"group_id": "size", "option_id": "large"}},
+		"unit_price": "0.01",
+	}}}
+	if code := serve(t, router, http.MethodPost, "/orderItems", body, &created); code != http.StatusOK {
+		t.Fatalf("POST /orderItems = %d", code)
+	}
+	if len(created.Order_items) != 1 {
+		t.Fatalf("created %d items, want 1", len(created.Order_items))
+	}
+	item := created.Order_items[0]
+	if item.Order_id != created.Order.Order_id || *item.Food_name != "Burger" || *item.Quantity != 2 {
+		t.Fatalf("created item = %+v", item)
+	}
+	// The price sent by the client is ignored, the food and its modifier are charged
+	if *item.Unit_price != money.New(1150, money.DefaultCurrency) {
+		t.Fatalf("unit price = %v, want 11.50", item.Unit_price)
+	}
+
+	tests := []struct {
+		name  string
+		id    string
+		body  gin.H
+		code  int
+		check func(models.OrderItem) bool
+	}{
+		{"quantity", item.Order_item_id, gin.H{"quantity": 3}, http.StatusOK,
+			func(updated models.OrderItem) bool {
+				return *updated.Quantity == 3 && *updated.Unit_price == *item.Unit_price
+			}},
+		{"modifiers are priced again", item.Order_item_id, gin.H{"modifiers": []gin.H{{"group_id": "size", "option_id": "regular"}}}, http.StatusOK,
+			func(updated models.OrderItem) bool {
+				return *updated.Unit_price == money.New(1000, money.DefaultCurrency)
+			}},
+		{"null price_delta sent back by a client", item.Order_item_id, gin.H{"modifiers": []gin.H{{"group_id": "size", "option_id": "large", "price_delta": nil}}}, http.StatusOK,
+			func(updated models.OrderItem) bool {
+				return *updated.Unit_price == money.New(1150, money.DefaultCurrency)
+			}},
+		{"quantity out of range", item.Order_item_id, gin.H{"quantity": 0}, http.StatusBadRequest, nil},
+		{"unknown option", item.Order_item_id, gin.H{"modifiers": []gin.H{{"group_id": "size", "option_id": "huge"}}}, http.StatusBadRequest, nil},
+		{"required group left out", item.Order_item_id, gin.H{"modifiers": []gin.H{}}, http.StatusBadRequest, nil},
+		{"unknown item", primitive.NewObjectID().Hex(), gin.H{"quantity": 1}, http.StatusNotFound, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var updated models.OrderItem
+			code := serve(t, router, http.MethodPatch, "/orderItems/"+tt.id, tt.body, &updated)
+			if code != tt.code {
+				t.Fatalf("PATCH = %d, want %d", code, tt.code)
+			}
+			if tt.check != nil && !tt.check(updated) {
+				t.Fatalf("updated item = %+v", updated)
+			}
+		})
+	}
+}
+
+func TestCreateOrderItemReportsEveryRejectedLine(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	tableId, foodId := seedMenu(t, repos)
+	router := orderItemRouter(repos)
+
+	var problem struct {
+		Details []struct {
+			Field string `json:"field"`
+		} `json:"details"`
+	}
+	body := gin.H{"table_id": tableId, "order_items": []gin.H{
+		{"food_id": primitive.NewObjectID().Hex()},
+		{"food_id": foodId, "modifiers": []gin.H{}},
+	}}
+	if code := serve(t, router, http.MethodPost, "/orderItems", body, &problem); code != http.StatusBadRequest {
+		t.Fatalf("POST /orderItems = %d, want %d", code, http.StatusBadRequest)
+	}
+	if len(problem.Details) != 2 || problem.Details[0].Field != "order_items[0].food_id" || problem.Details[1].Field != "order_items[1].modifiers" {
+		t.Fatalf("details = %+v", problem.Details)
+	}
+	if items, _, _ := repos.OrderItems.List(context.Background(), repository.ListQuery{}, repository.Pagination{Per_page: 10}); len(items) != 0 {
+		t.Fatalf("a rejected order stored %d items", len(items))
+	}
+}
+
+func TestSnapshotFoodExplainsMismatchedCurrencies(t *testing.T) {
+	name, price, delta := "Burger", money.New(1000, "USD"), money.New(150, "EUR")
+	// Stored before the currencies of the deltas were checked
+	food := models.Food{Name: &name, Price: &price, Modifier_groups: []models.ModifierGroup{{
+		Group_id: "size", Name: "Size", Options: []models.ModifierOption{{Option_id: "large", Name: "Large", Price_delta: &delta}},
+	}}}
+	item := models.OrderItem{Modifiers: []models.SelectedModifier{{Group_id: "size", Option_id: "large"}}}
+	problem := snapshotFood(&item, food)
+	if problem != "Large is priced in EUR but the food in USD, ask a manager to fix the menu" {
+		t.Fatalf("problem = %q", problem)
+	}
+	if item.Unit_price != nil {
+		t.Fatalf("a refused item was priced at %v", *item.Unit_price)
+	}
+}
+
+func TestOrderItemsRejectUnorderableFoods(t *testing.T) {
+	c := context.Background()
+	repos := repository.NewMemoryRepositories()
+	tableId, burgerId := seedMenu(t, repos)
+	router := orderItemRouter(repos)
+
+	ended := time.Now().Add(-24 * time.Hour)
+	past := models.Menu{ID: primitive.NewObjectID(), Name: "Winter", Category: "mains", End_Date: &ended}
+	past.Menu_id = past.ID.Hex()
+	if err := repos.Menus.Create(c, past); err != nil {
+		t.Fatal(err)
+	}
+	burger, err := repos.Foods.FindById(c, burgerId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Foods of the burger's menu, without modifiers, in every state an order can find them in
+	food := func(name string, menuId *string, inStock *bool) string {
+		price := money.New(500, money.DefaultCurrency)
+		f := models.Food{ID: primitive.NewObjectID(), Name: &name, Price: &price, Menu_id: menuId, In_stock: inStock}
+		f.Food_id = f.ID.Hex()
+		if err := repos.Foods.Create(c, f); err != nil {
+			t.Fatal(err)
+		}
+		return f.Food_id
+	}
+	yes, no, gone := true, false, primitive.NewObjectID().Hex()
+	fries := food("Fries", burger.Menu_id, &yes)
+	legacy := food("Salad", burger.Menu_id, nil)
+	soldOut := food("Soup", burger.Menu_id, &no)
+	seasonal := food("Stew", &past.Menu_id, &yes)
+	orphan := food("Pie", &gone, &yes)
+	unlisted := food("Tart", nil, &yes)
+
+	tests := []struct {
+		name   string
+		foodId string
+		reason string
+	}{
+		{"in stock", fries, ""},
+		// Foods stored before stock was tracked are in stock
+		{"stored without stock", legacy, ""},
+		{"out of stock", soldOut, "the food is out of stock"},
+		{"menu no longer served", seasonal, "the Winter menu is not served at this time"},
+		{"menu deleted", orphan, "the menu of the food no longer exists"},
+		{"no menu", unlisted, "the food is not on a menu"},
+		{"unknown food", primitive.NewObjectID().Hex(), "food not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out struct {
+				Order_items []models.OrderItem `json:"order_items"`
+				Details     []struct {
+					Field   string `json:"field"`
+					Message string `json:"message"`
+				} `json:"details"`
+			}
+			body := gin.H{"table_id": tableId, "order_items": []gin.H{{"food_id": tt.foodId, "quantity": 1}}}
+			code := serve(t, router, http.MethodPost, "/orderItems", body, &out)
+			if tt.reason == "" {
+				if code != http.StatusOK || len(out.Order_items) != 1 {
+					t.Fatalf("POST /orderItems = %d with %d items, want the item ordered", code, len(out.Order_items))
+				}
+				return
+			}
+			if code != http.StatusBadRequest || len(out.Details) != 1 || out.Details[0].Field != "order_items[0].food_id" || out.Details[0].Message != tt.reason {
+				t.Fatalf("POST /orderItems = %d %+v, want 400 because %s", code, out.Details, tt.reason)
+			}
+
+			// Switching an ordered item to the food is refused alike
+			var ordered struct {
+				Order_items []models.OrderItem `json:"order_items"`
+			}
+			body = gin.H{"table_id": tableId, "order_items": []gin.H{{"food_id": fries, "quantity": 1}}}
+			if code := serve(t, router, http.MethodPost, "/orderItems", body, &ordered); code != http.StatusOK {
+				t.Fatalf("POST /orderItems = %d", code)
+			}
+			id := ordered.Order_items[0].Order_item_id
+			if code := serve(t, router, http.MethodPatch, "/orderItems/"+id, gin.H{"food_id": tt.foodId}, nil); code != http.StatusBadRequest {
+				t.Fatalf("PATCH food_id = %d, want %d", code, http.StatusBadRequest)
+			}
+			if item, err := repos.OrderItems.FindById(c, id); err != nil || *item.Food_id != fries {
+				t.Fatalf("the refused food was stored: %v, %v", item.Food_id, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,210 @@
+package controllers
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/PranavMasekar/restaurant-management/apperror"
+	"github.com/PranavMasekar/restaurant-management/helpers"
+	"github.com/PranavMasekar/restaurant-management/repository"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// PINs are short, what protects them is the device binding and the login throttling,
+// so a cheaper bcrypt cost than for passwords keeps terminal logins snappy
+const pinHashCost = 10
+
+type setPinRequest struct {
+	Pin       *string `json:"pin" validate:"required,numeric,min=4,max=6"`
+	Password  *string `json:"password" validate:"required"`
+	Device_id *string `json:"device_id" validate:"required"`
+}
+
+type pinLoginRequest struct {
+	Device_id     *string `json:"device_id" validate:"required"`
+	Device_secret *string `json:"device_secret" validate:"required"`
+	User_id       *string `json:"user_id" validate:"required"`
+	Pin           *string `json:"pin" validate:"required,numeric"`
+}
+
+// SetPin sets the PIN of the user and binds it to a registered terminal,
+// setting it again for another terminal adds that terminal
+func (h *UserHandler) SetPin() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		c, cancel := requestContext(ctx)
+		defer cancel()
+		var body setPinRequest
+
+		if err := ctx.ShouldBindJSON(&body); err != nil {
+			apperror.Respond(ctx, apperror.Invalid(err))
+			return
+		}
+		if validationErr := validate.Struct(body); validationErr != nil {
+			apperror.Respond(ctx, apperror.Invalid(validationErr))
+			return
+		}
+		user, err := h.users.FindById(c, ctx.Param("user_id"))
+		if err != nil {
+			apperror.Respond(ctx, apperror.NotFound("user not found"))
+			return
+		}
+		if helpers.TwoFactorRequired(helpers.UserType(user)) {
+			apperror.Respond(ctx, apperror.Forbidden("PIN login is not available for your role"))
+			return
+		}
+		// Whoever holds the token has to know the password as well
+		if ok, msg := VerifyPassword(*body.Password, *user.Password); !ok {
+			apperror.Respond(ctx, apperror.Unauthorized(msg))
+			return
+		}
+		device, err := h.devices.FindById(c, *body.Device_id)
+		if err != nil || device.Revoked {
+			apperror.Respond(ctx, apperror.NotFound("device not found"))
+			return
+		}
+
+		hash, err := bcrypt.GenerateFromPassword([]byte(*body.Pin), pinHashCost)
+		if err != nil {
+			apperror.Respond(ctx, apperror.Internal("error occured while hashing the PIN", err))
+			return
+		}
+		updated_at, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		pinDevices := user.Pin_devices
+		if !containsString(pinDevices, device.Device_id) {
+			pinDevices = append(pinDevices, device.Device_id)
+		}
+		err = h.users.Update(c, user.User_id, bson.D{
+			{Key: "pin_hash", Value: string(hash)},
+			{Key: "pin_devices", Value: pinDevices},
+			{Key: "updated_at", Value: updated_at},
+		})
+		if err != nil {
+			apperror.Respond(ctx, apperror.Internal("PIN update failed", err))
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"message": "PIN set"})
+	}
+}
+
+func (h *UserHandler) RemovePin() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		c, cancel := requestContext(ctx)
+		defer cancel()
+		updated_at, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		err := h.users.Update(c, ctx.Param("user_id"), bson.D{
+			{Key: "pin_hash", Value: nil},
+			{Key: "pin_devices", Value: nil},
+			{Key: "updated_at", Value: updated_at},
+		})
+		if err == repository.ErrNotFound {
+			apperror.Respond(ctx, apperror.NotFound("user not found"))
+			return
+		}
+		if err != nil {
+			apperror.Respond(ctx, apperror.Internal("PIN removal failed", err))
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"message": "PIN removed"})
+	}
+}
+
+// PinLogin switches the user on a shared terminal. The terminal proves itself with its device
+// secret and the user with the PIN, the tokens handed out are short-lived and limited to the POS scope.
+func (h *UserHandler) PinLogin() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		c, cancel := requestContext(ctx)
+		defer cancel()
+		var body pinLoginRequest
+
+		if err := ctx.ShouldBindJSON(&body); err != nil {
+			apperror.Respond(ctx, apperror.Invalid(err))
+			return
+		}
+		if validationErr := validate.Struct(body); validationErr != nil {
+			apperror.Respond(ctx, apperror.Invalid(validationErr))
+			return
+		}
+		ip := ctx.ClientIP()
+		device, ok := helpers.VerifyDevice(c, h.devices, *body.Device_id, *body.Device_secret)
+		if !ok {
+			if err := helpers.RecordLoginFailure(c, h.loginAttempts, "", ip); err != nil {
+				slog.WarnContext(c, "failed PIN login was not recorded", "ip", ip, "error", err)
+			}
+			apperror.Respond(ctx, apperror.Unauthorized("device is not registered"))
+			return
+		}
+		user, err := h.users.FindById(c, *body.User_id)
+		if err != nil {
+			apperror.Respond(ctx, apperror.Unauthorized("user or PIN is incorrect"))
+			return
+		}
+
+		// PIN attempts share the lockout of the password login
+		lockedUntil, err := helpers.LoginLockedUntil(c, h.loginAttempts, *user.Email, ip)
+		if err != nil {
+			apperror.Respond(ctx, apperror.Internal("error occured while checking login attempts", err))
+			return
+		}
+		if wait := time.Until(lockedUntil); wait > 0 {
+			ctx.Header("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+			apperror.Respond(ctx, apperror.TooManyRequests("too many failed login attempts, try again later"))
+			return
+		}
+		if user.Deactivated_at != nil {
+			apperror.Respond(ctx, apperror.Forbidden("this account has been deactivated"))
+			return
+		}
+		if helpers.TwoFactorRequired(helpers.UserType(user)) {
+			apperror.Respond(ctx, apperror.Forbidden("PIN login is not available for your role"))
+			return
+		}
+		if user.Pin_hash == nil || !containsString(user.Pin_devices, device.Device_id) {
+			apperror.Respond(ctx, apperror.Unauthorized("PIN login is not set up on this device"))
+			return
+		}
+		if bcrypt.CompareHashAndPassword([]byte(*user.Pin_hash), []byte(*body.Pin)) != nil {
+			if err := helpers.RecordLoginFailure(c, h.loginAttempts, *user.Email, ip); err != nil {
+				slog.WarnContext(c, "failed PIN login was not recorded", "email", *user.Email, "error", err)
+			}
+			apperror.Respond(ctx, apperror.Unauthorized("user or PIN is incorrect"))
+			return
+		}
+		if err := helpers.RecordLoginSuccess(c, h.loginAttempts, *user.Email); err != nil {
+			slog.WarnContext(c, "login attempts were not cleared", "email", *user.Email, "error", err)
+		}
+
+		session := helpers.NewTerminalSession(device.Device_id)
+		token, refreshToken, err := helpers.GenerateAllTokens(user, session)
+		if err != nil {
+			apperror.Respond(ctx, apperror.Internal("error occured while generating tokens", err))
+			return
+		}
+		if err := helpers.UpdateAllTokens(c, h.users, token, refreshToken, user.User_id, session); err != nil {
+			apperror.Respond(ctx, apperror.Internal("error occured while saving the session", err))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, gin.H{
+			"token":         token,
+			"refresh_token": refreshToken,
+			"expires_in":    int(helpers.PinTokenTTL.Seconds()),
+			"user_id":       user.User_id,
+			"first_name":    user.First_name,
+			"last_name":     user.Last_name,
+			"user_type":     helpers.UserType(user),
+		})
+	}
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
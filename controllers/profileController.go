@@ -0,0 +1,257 @@
+package controllers
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/PranavMasekar/restaurant-management/apperror"
+	"github.com/PranavMasekar/restaurant-management/helpers"
+	"github.com/PranavMasekar/restaurant-management/models"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type updateUserRequest struct {
+	First_name *string `json:"first_name" validate:"omitempty,min=2,max=100"`
+	Last_name  *string `json:"last_name" validate:"omitempty,min=2,max=100"`
+	Email      *string `json:"email" validate:"omitempty,email"`
+	Phone      *string `json:"phone" validate:"omitempty,min=1"`
+	Avatar     *string `json:"avatar" validate:"omitempty,max=2048"`
+}
+
+type changePasswordRequest struct {
+	Current_password *string `json:"current_password" validate:"required"`
+	New_password     *string `json:"new_password" validate:"required,min=6"`
+}
+
+func (h *UserHandler) UpdateUser() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		c, cancel := requestContext(ctx)
+		defer cancel()
+		var body updateUserRequest
+		userId := targetUserId(ctx)
+
+		if err := ctx.ShouldBindJSON(&body); err != nil {
+			apperror.Respond(ctx, apperror.Invalid(err))
+			return
+		}
+		if validationErr := validate.Struct(body); validationErr != nil {
+			apperror.Respond(ctx, apperror.Invalid(validationErr))
+			return
+		}
+		user, err := h.users.FindById(c, userId)
+		if err != nil {
+			apperror.Respond(ctx, apperror.NotFound("user not found"))
+			return
+		}
+		if !canManage(ctx, user) {
+			apperror.Respond(ctx, apperror.Forbidden("only an admin can change an admin account"))
+			return
+		}
+		// A password reset goes to the email, so whoever sets it can take the account over
+		emailChanged := body.Email != nil && (user.Email == nil || *body.Email != *user.Email)
+		if emailChanged && !canChangeEmail(ctx, user) {
+			apperror.Respond(ctx, apperror.Forbidden("only an admin can change the email of another manager"))
+			return
+		}
+		taken, err := h.users.EmailOrPhoneTaken(c, body.Email, body.Phone, userId)
+		if err != nil {
+			apperror.Respond(ctx, apperror.Internal("error occured while checking emails and phone numbers", err))
+			return
+		}
+		if taken {
+			apperror.Respond(ctx, apperror.Conflict("this email or phone number alredy exits"))
+			return
+		}
+
+		var updateObj primitive.D
+		if body.First_name != nil {
+			updateObj = append(updateObj, bson.E{Key: "first_name", Value: body.First_name})
+		}
+		if body.Last_name != nil {
+			updateObj = append(updateObj, bson.E{Key: "last_name", Value: body.Last_name})
+		}
+		if body.Phone != nil {
+			updateObj = append(updateObj, bson.E{Key: "phone", Value: body.Phone})
+		}
+		if body.Avatar != nil {
+			updateObj = append(updateObj, bson.E{Key: "avatar", Value: body.Avatar})
+		}
+		// A new address has to be verified again
+		if emailChanged {
+			updateObj = append(updateObj, bson.E{Key: "email", Value: body.Email})
+			updateObj = append(updateObj, bson.E{Key: "email_verified", Value: false})
+		}
+		updated_at, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		updateObj = append(updateObj, bson.E{Key: "updated_at", Value: updated_at})
+
+		if err = h.users.Update(c, userId, updateObj); err != nil {
+			apperror.Respond(ctx, apperror.Internal("user update failed", err))
+			return
+		}
+		if user, err = h.users.FindById(c, userId); err != nil {
+			apperror.Respond(ctx, err)
+			return
+		}
+		if emailChanged {
+			if err := h.sendVerificationEmail(c, user); err != nil {
+				slog.WarnContext(c, "verification email was not sent", "user_id", user.User_id, "error", err)
+			}
+		}
+		ctx.JSON(http.StatusOK, newUserView(user))
+	}
+}
+
+// ChangePassword changes the password of the caller. Every other session is logged out,
+// the caller gets the tokens of a new session back.
+func (h *UserHandler) ChangePassword() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		c, cancel := requestContext(ctx)
+		defer cancel()
+		var body changePasswordRequest
+		userId := ctx.GetString("uid")
+
+		if err := ctx.ShouldBindJSON(&body); err != nil {
+			apperror.Respond(ctx, apperror.Invalid(err))
+			return
+		}
+		if validationErr := validate.Struct(body); validationErr != nil {
+			apperror.Respond(ctx, apperror.Invalid(validationErr))
+			return
+		}
+		user, err := h.users.FindById(c, userId)
+		if err != nil {
+			apperror.Respond(ctx, apperror.NotFound("user not found"))
+			return
+		}
+		if ok, _ := VerifyPassword(*body.Current_password, *user.Password); !ok {
+			apperror.Respond(ctx, apperror.Validation("current password is incorrect"))
+			return
+		}
+
+		password, err := HashPassword(*body.New_password)
+		if err != nil {
+			apperror.Respond(ctx, apperror.Internal("password update failed", err))
+			return
+		}
+		updated_at, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		err = h.users.Update(c, userId, bson.D{
+			{Key: "password", Value: password},
+			{Key: "updated_at", Value: updated_at},
+		})
+		if err != nil {
+			apperror.Respond(ctx, apperror.Internal("password update failed", err))
+			return
+		}
+		if _, err := h.users.RevokeAllSessions(c, userId); err != nil {
+			apperror.Respond(ctx, apperror.Internal("error occured while revoking the sessions", err))
+			return
+		}
+
+		// The token version changed, so reload the user before issuing the new tokens
+		if user, err = h.users.FindById(c, userId); err != nil {
+			apperror.Respond(ctx, err)
+			return
+		}
+		session := helpers.NewSession(ctx.GetBool("mfa"))
+		token, refreshToken, err := helpers.GenerateAllTokens(user, session)
+		if err != nil {
+			apperror.Respond(ctx, apperror.Internal("error occured while generating tokens", err))
+			return
+		}
+		if err := helpers.UpdateAllTokens(c, h.users, token, refreshToken, user.User_id, session); err != nil {
+			apperror.Respond(ctx, apperror.Internal("error occured while saving the session", err))
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"token": token, "refresh_token": refreshToken})
+	}
+}
+
+// DeactivateUser disables the account of a former employee. The user is logged out everywhere
+// and cannot log in anymore, but the account and its history stay in the database.
+func (h *UserHandler) DeactivateUser() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		c, cancel := requestContext(ctx)
+		defer cancel()
+		userId := ctx.Param("user_id")
+
+		if userId == ctx.GetString("uid") {
+			apperror.Respond(ctx, apperror.Validation("you cannot deactivate your own account"))
+			return
+		}
+		user, err := h.users.FindById(c, userId)
+		if err != nil {
+			apperror.Respond(ctx, apperror.NotFound("user not found"))
+			return
+		}
+		if !canManage(ctx, user) {
+			apperror.Respond(ctx, apperror.Forbidden("only an admin can change an admin account"))
+			return
+		}
+
+		updated_at, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		err = h.users.Update(c, userId, bson.D{
+			{Key: "deactivated_at", Value: updated_at},
+			{Key: "updated_at", Value: updated_at},
+		})
+		if err != nil {
+			apperror.Respond(ctx, apperror.Internal("user deactivation failed", err))
+			return
+		}
+		if _, err := h.users.RevokeAllSessions(c, userId); err != nil {
+			apperror.Respond(ctx, apperror.Internal("error occured while revoking the sessions", err))
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"message": "user deactivated"})
+	}
+}
+
+func (h *UserHandler) ReactivateUser() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		c, cancel := requestContext(ctx)
+		defer cancel()
+		userId := ctx.Param("user_id")
+
+		user, err := h.users.FindById(c, userId)
+		if err != nil {
+			apperror.Respond(ctx, apperror.NotFound("user not found"))
+			return
+		}
+		if !canManage(ctx, user) {
+			apperror.Respond(ctx, apperror.Forbidden("only an admin can change an admin account"))
+			return
+		}
+
+		updated_at, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		err = h.users.Update(c, userId, bson.D{
+			{Key: "deactivated_at", Value: nil},
+			{Key: "updated_at", Value: updated_at},
+		})
+		if err != nil {
+			apperror.Respond(ctx, apperror.Internal("user reactivation failed", err))
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"message": "user reactivated"})
+	}
+}
+
+// canChangeEmail tells whether the caller may change the email of user, on top of canManage: the
+// accounts of managers are only the business of themselves and of the admins
+func canChangeEmail(ctx *gin.Context, user models.User) bool {
+	if user.User_id == ctx.GetString("uid") || ctx.GetString("user_type") == models.RoleAdmin {
+		return true
+	}
+	role := helpers.UserType(user)
+	return role != models.RoleAdmin && role != models.RoleManager
+}
+
+// canManage tells whether the caller may change the account of user: everyone can change
+// their own account, managers everyone but admins, admins everyone
+func canManage(ctx *gin.Context, user models.User) bool {
+	if user.User_id == ctx.GetString("uid") {
+		return true
+	}
+	return helpers.UserType(user) != models.RoleAdmin || ctx.GetString("user_type") == models.RoleAdmin
+}
@@ -0,0 +1,114 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/PranavMasekar/restaurant-management/helpers"
+	"github.com/PranavMasekar/restaurant-management/models"
+	"github.com/PranavMasekar/restaurant-management/repository"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// seedUser stores a user of the role with the email, already verified
+func seedUser(t *testing.T, repos repository.Repositories, role string, email string) models.User {
+	t.Helper()
+	name, phone := "Ann", primitive.NewObjectID().Hex()
+	user := models.User{ID: primitive.NewObjectID(), Email: &email, First_name: &name, Last_name: &name, Phone: &phone, User_type: &role, Email_verified: true}
+	user.User_id = user.ID.Hex()
+	if err := repos.Users.Create(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// profileRouter serves PATCH /users/:user_id and POST /users/verify-email, the caller is
+// the user with the uid and the role, as the authentication middleware would set them
+func profileRouter(repos repository.Repositories, uid string, role string) *gin.Engine {
+	handler := NewUserHandler(repos.Users, repos.Devices, repos.UserTokens, repos.LoginAttempts, &failingMailer{}, "")
+	router := gin.New()
+	router.POST("/users/verify-email", handler.VerifyEmail())
+	router.Use(func(ctx *gin.Context) {
+		ctx.Set("uid", uid)
+		ctx.Set("user_type", role)
+	})
+	router.PATCH("/users/:user_id", handler.UpdateUser())
+	return router
+}
+
+func TestUpdateUserEmail(t *testing.T) {
+	tests := []struct {
+		name   string
+		caller string
+		target string
+		self   bool
+		want   int
+	}{
+		{"manager changes a waiter", models.RoleManager, models.RoleWaiter, false, http.StatusOK},
+		{"manager changes another manager", models.RoleManager, models.RoleManager, false, http.StatusForbidden},
+		{"manager changes an admin", models.RoleManager, models.RoleAdmin, false, http.StatusForbidden},
+		{"manager changes their own", models.RoleManager, models.RoleManager, true, http.StatusOK},
+		{"admin changes a manager", models.RoleAdmin, models.RoleManager, false, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repos := repository.NewMemoryRepositories()
+			target := seedUser(t, repos, tt.target, "target@example.com")
+			caller := target
+			if !tt.self {
+				caller = seedUser(t, repos, tt.caller, "caller@example.com")
+			}
+			router := profileRouter(repos, caller.User_id, tt.caller)
+
+			code := serve(t, router, http.MethodPatch, "/users/"+target.User_id, gin.H{"email": "new@example.com"}, nil)
+			if code != tt.want {
+				t.Fatalf("status = %d, want %d", code, tt.want)
+			}
+			user, err := repos.Users.FindById(context.Background(), target.User_id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			changed := *user.Email == "new@example.com"
+			if changed != (tt.want == http.StatusOK) {
+				t.Fatalf("email = %s after a %d", *user.Email, code)
+			}
+			// A new address has to be verified again
+			if user.Email_verified == changed {
+				t.Fatalf("email_verified = %v with email %s", user.Email_verified, *user.Email)
+			}
+		})
+	}
+}
+
+func TestVerifyEmailOnlyProvesTheAddressItWasMailedTo(t *testing.T) {
+	c := context.Background()
+	repos := repository.NewMemoryRepositories()
+	admin := seedUser(t, repos, models.RoleAdmin, "admin@example.com")
+	user := seedUser(t, repos, models.RoleManager, "ann@example.com")
+	router := profileRouter(repos, admin.User_id, models.RoleAdmin)
+
+	// The link was mailed to the old address, the attacker who holds it then changes the email
+	stale, err := helpers.CreateUserToken(c, repos.UserTokens, user.User_id, "ann@example.com", models.EmailVerificationToken, helpers.EmailVerificationTTL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code := serve(t, router, http.MethodPatch, "/users/"+user.User_id, gin.H{"email": "mallory@example.com"}, nil); code != http.StatusOK {
+		t.Fatalf("email change = %d", code)
+	}
+	if code := serve(t, router, http.MethodPost, "/users/verify-email", gin.H{"token": stale}, nil); code == http.StatusOK {
+		t.Fatal("a link mailed to the old address verified the new one")
+	}
+
+	fresh, err := helpers.CreateUserToken(c, repos.UserTokens, user.User_id, "mallory@example.com", models.EmailVerificationToken, helpers.EmailVerificationTTL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code := serve(t, router, http.MethodPost, "/users/verify-email", gin.H{"token": fresh}, nil); code != http.StatusOK {
+		t.Fatalf("verify = %d, want %d", code, http.StatusOK)
+	}
+	if user, err = repos.Users.FindById(c, user.User_id); err != nil || !user.Email_verified {
+		t.Fatalf("email_verified = %v (%v), want true", user.Email_verified, err)
+	}
+}
@@ -1,124 +1,143 @@
 package controllers
 
 import (
-	"context"
-	"fmt"
-	"log"
 	"net/http"
 	"time"
 
-	"github.com/PranavMasekar/restaurant-management/database"
+	"github.com/PranavMasekar/restaurant-management/apperror"
+	"github.com/PranavMasekar/restaurant-management/helpers"
 	"github.com/PranavMasekar/restaurant-management/models"
+	"github.com/PranavMasekar/restaurant-management/repository"
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-var tableCollection *mongo.Collection = database.OpenCollection(database.Client, "table")
+// TableHandler serves the tables of the restaurant
+type TableHandler struct {
+	tables repository.TableRepository
+}
+
+func NewTableHandler(tables repository.TableRepository) *TableHandler {
+	return &TableHandler{tables: tables}
+}
 
-func GetTables() gin.HandlerFunc {
+// What clients can filter, sort and select in the table list
+var tableListSpec = helpers.ListSpec{
+	Filters: map[string]helpers.FieldKind{
+		"table_number":     helpers.NumberField,
+		"number_of_guests": helpers.NumberField,
+		"table_id":         helpers.StringField,
+		"created_at":       helpers.TimeField,
+	},
+	Sorts:        []string{"table_number", "number_of_guests", "created_at", "updated_at"},
+	Fields:       []string{"table_number", "number_of_guests", "created_at", "updated_at"},
+	Id_field:     "table_id",
+	Default_sort: "table_number",
+}
+
+func (h *TableHandler) GetTables() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		c, cancel := context.WithTimeout(context.Background(), 100*time.Second)
-		result, err := tableCollection.Find(context.TODO(), bson.M{})
+		c, cancel := requestContext(ctx)
 		defer cancel()
+		query, pagination, err := helpers.ParseListQuery(ctx, tableListSpec)
 		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, bson.M{"error": "error while listening tables"})
+			apperror.Respond(ctx, apperror.Invalid(err))
 			return
 		}
-		var allTables []bson.M
-		defer cancel()
-		if err = result.All(c, &allTables); err != nil {
-			log.Fatal(err)
+		allTables, total, err := h.tables.List(c, query, pagination)
+		if err != nil {
+			apperror.Respond(ctx, apperror.Internal("error while listening tables", err))
+			return
 		}
-		ctx.JSON(http.StatusOK, allTables)
+		ctx.JSON(http.StatusOK, helpers.ListResponse(pagination, "table_items", total, allTables))
 	}
 }
-func GetTable() gin.HandlerFunc {
+
+func (h *TableHandler) GetTable() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		c, cancel := context.WithTimeout(context.Background(), 100*time.Second)
-		tableId := ctx.Param("table_id")
-		var table models.Table
-		err := tableCollection.FindOne(c, bson.M{"table_id": tableId}).Decode(&table)
+		c, cancel := requestContext(ctx)
 		defer cancel()
+		table, err := h.tables.FindById(c, ctx.Param("table_id"))
+		if err == repository.ErrNotFound {
+			apperror.Respond(ctx, apperror.NotFound("table not found"))
+			return
+		}
 		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while fetching the tables"})
+			apperror.Respond(ctx, apperror.Internal("error occured while fetching the tables", err))
+			return
 		}
 		ctx.JSON(http.StatusOK, table)
 	}
 }
-func CreateTable() gin.HandlerFunc {
+
+func (h *TableHandler) CreateTable() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		var table models.Table
-		c, cancel := context.WithTimeout(context.Background(), 100*time.Second)
-		err := ctx.BindJSON(&table)
+		c, cancel := requestContext(ctx)
+		defer cancel()
+		err := ctx.ShouldBindJSON(&table)
 		if err != nil {
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			apperror.Respond(ctx, apperror.Invalid(err))
 			return
 		}
 		validatoinError := validate.Struct(table)
 		if validatoinError != nil {
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": validatoinError.Error()})
+			apperror.Respond(ctx, apperror.Invalid(validatoinError))
 			return
 		}
 		table.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 		table.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 		table.ID = primitive.NewObjectID()
 		table.Table_id = table.ID.Hex()
-		result, insertError := tableCollection.InsertOne(c, table)
-		if insertError != nil {
-			msg := fmt.Sprintf("Table was not Created")
-			ctx.JSON(http.StatusInternalServerError, gin.H{"err": msg})
+		if err = h.tables.Create(c, table); err != nil {
+			apperror.Respond(ctx, apperror.Internal("Table was not Created", err))
 			return
 		}
-		defer cancel()
-		ctx.JSON(http.StatusOK, result)
+		ctx.JSON(http.StatusOK, table)
 	}
 }
-func UpdateTable() gin.HandlerFunc {
+
+func (h *TableHandler) UpdateTable() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		c, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		c, cancel := requestContext(ctx)
 		defer cancel()
 		var table models.Table
 
-		err := ctx.BindJSON(&table)
+		err := ctx.ShouldBindJSON(&table)
 
 		if err != nil {
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			apperror.Respond(ctx, apperror.Invalid(err))
 			return
 		}
 
-		menuId := ctx.Param("table_id")
-		filter := bson.M{"table_id": menuId}
+		tableId := ctx.Param("table_id")
 
 		var updateObj primitive.D
 
 		if table.Number_of_guests != nil {
-			updateObj = append(updateObj, bson.E{"number_of_guests", table.Number_of_guests})
+			updateObj = append(updateObj, bson.E{Key: "number_of_guests", Value: table.Number_of_guests})
 		}
 		if table.Table_number != nil {
-			updateObj = append(updateObj, bson.E{"table_number", table.Table_number})
+			updateObj = append(updateObj, bson.E{Key: "table_number", Value: table.Table_number})
 		}
 		table.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
-		upsert := true
+		updateObj = append(updateObj, bson.E{Key: "updated_at", Value: table.Updated_at})
 
-		opt := options.UpdateOptions{
-			Upsert: &upsert,
+		err = h.tables.Update(c, tableId, updateObj)
+		if err == repository.ErrNotFound {
+			apperror.Respond(ctx, apperror.NotFound("table not found"))
+			return
 		}
-		result, err := tableCollection.UpdateOne(
-			c,
-			filter,
-			bson.D{
-				{"$set", updateObj},
-			},
-			&opt,
-		)
 		if err != nil {
-			msg := "Table updation failed"
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			apperror.Respond(ctx, apperror.Internal("Table updation failed", err))
+			return
 		}
-		defer cancel()
-		ctx.JSON(http.StatusOK, result)
+		table, err = h.tables.FindById(c, tableId)
+		if err != nil {
+			apperror.Respond(ctx, apperror.Internal("error occured while fetching the tables", err))
+			return
+		}
+		ctx.JSON(http.StatusOK, table)
 	}
 }
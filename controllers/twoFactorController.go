@@ -0,0 +1,245 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/PranavMasekar/restaurant-management/apperror"
+	"github.com/PranavMasekar/restaurant-management/helpers"
+	"github.com/PranavMasekar/restaurant-management/models"
+	"github.com/PranavMasekar/restaurant-management/repository"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type twoFactorRequest struct {
+	Code          *string `json:"code"`
+	Recovery_code *string `json:"recovery_code"`
+}
+
+func (h *UserHandler) SetupTwoFactor() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		c, cancel := requestContext(ctx)
+		defer cancel()
+		user, err := h.users.FindById(c, ctx.GetString("uid"))
+		if err != nil {
+			apperror.Respond(ctx, apperror.NotFound("user not found"))
+			return
+		}
+		if user.Totp_enabled {
+			apperror.Respond(ctx, apperror.Conflict("two-factor authentication is already enabled"))
+			return
+		}
+
+		// The secret stays pending until a first code proves the app was set up
+		secret, err := helpers.GenerateTOTPSecret()
+		if err != nil {
+			apperror.Respond(ctx, apperror.Internal("error occured while generating the secret", err))
+			return
+		}
+		updated_at, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		err = h.users.Update(c, user.User_id, bson.D{
+			{Key: "totp_secret", Value: secret},
+			{Key: "updated_at", Value: updated_at},
+		})
+		if err != nil {
+			apperror.Respond(ctx, apperror.Internal("error occured while saving the secret", err))
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"secret": secret, "otpauth_uri": helpers.TOTPURI(secret, *user.Email)})
+	}
+}
+
+func (h *UserHandler) EnableTwoFactor() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		c, cancel := requestContext(ctx)
+		defer cancel()
+		var body twoFactorRequest
+		if err := ctx.ShouldBindJSON(&body); err != nil {
+			apperror.Respond(ctx, apperror.Invalid(err))
+			return
+		}
+		if body.Code == nil {
+			apperror.Respond(ctx, apperror.Validation("code is required"))
+			return
+		}
+		user, err := h.users.FindById(c, ctx.GetString("uid"))
+		if err != nil {
+			apperror.Respond(ctx, apperror.NotFound("user not found"))
+			return
+		}
+		if user.Totp_enabled {
+			apperror.Respond(ctx, apperror.Conflict("two-factor authentication is already enabled"))
+			return
+		}
+		if user.Totp_secret == nil {
+			apperror.Respond(ctx, apperror.Validation("start the two-factor setup first"))
+			return
+		}
+		step, ok := helpers.ValidateTOTP(*user.Totp_secret, *body.Code, time.Now())
+		if !ok {
+			apperror.Respond(ctx, apperror.Validation("two-factor code is incorrect"))
+			return
+		}
+
+		codes, hashes, err := helpers.GenerateRecoveryCodes()
+		if err != nil {
+			apperror.Respond(ctx, apperror.Internal("error occured while generating recovery codes", err))
+			return
+		}
+		updated_at, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		err = h.users.Update(c, user.User_id, bson.D{
+			{Key: "totp_enabled", Value: true},
+			{Key: "totp_last_step", Value: step},
+			{Key: "recovery_codes", Value: hashes},
+			{Key: "updated_at", Value: updated_at},
+		})
+		if err != nil {
+			apperror.Respond(ctx, apperror.Internal("error occured while enabling two-factor authentication", err))
+			return
+		}
+		// Recovery codes are only stored hashed, this is the one chance to write them down
+		ctx.JSON(http.StatusOK, gin.H{
+			"message":        "two-factor authentication enabled, log in again to use it",
+			"recovery_codes": codes,
+		})
+	}
+}
+
+func (h *UserHandler) DisableTwoFactor() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		c, cancel := requestContext(ctx)
+		defer cancel()
+		var body twoFactorRequest
+		if err := ctx.ShouldBindJSON(&body); err != nil {
+			apperror.Respond(ctx, apperror.Invalid(err))
+			return
+		}
+		user, err := h.users.FindById(c, ctx.GetString("uid"))
+		if err != nil {
+			apperror.Respond(ctx, apperror.NotFound("user not found"))
+			return
+		}
+		if helpers.TwoFactorRequired(helpers.UserType(user)) {
+			apperror.Respond(ctx, apperror.Forbidden("two-factor authentication is mandatory for your role"))
+			return
+		}
+		if !user.Totp_enabled {
+			apperror.Respond(ctx, apperror.Validation("two-factor authentication is not enabled"))
+			return
+		}
+		if !h.verifySecondFactor(c, user, body.Code, body.Recovery_code) {
+			apperror.Respond(ctx, apperror.Validation("two-factor code is incorrect"))
+			return
+		}
+		if err := h.clearTwoFactor(c, user.User_id); err != nil {
+			apperror.Respond(ctx, apperror.Internal("error occured while disabling two-factor authentication", err))
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"message": "two-factor authentication disabled"})
+	}
+}
+
+func (h *UserHandler) RegenerateRecoveryCodes() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		c, cancel := requestContext(ctx)
+		defer cancel()
+		var body twoFactorRequest
+		if err := ctx.ShouldBindJSON(&body); err != nil {
+			apperror.Respond(ctx, apperror.Invalid(err))
+			return
+		}
+		if body.Code == nil {
+			apperror.Respond(ctx, apperror.Validation("code is required"))
+			return
+		}
+		user, err := h.users.FindById(c, ctx.GetString("uid"))
+		if err != nil {
+			apperror.Respond(ctx, apperror.NotFound("user not found"))
+			return
+		}
+		if !user.Totp_enabled {
+			apperror.Respond(ctx, apperror.Validation("two-factor authentication is not enabled"))
+			return
+		}
+		if !h.verifySecondFactor(c, user, body.Code, nil) {
+			apperror.Respond(ctx, apperror.Validation("two-factor code is incorrect"))
+			return
+		}
+
+		codes, hashes, err := helpers.GenerateRecoveryCodes()
+		if err != nil {
+			apperror.Respond(ctx, apperror.Internal("error occured while generating recovery codes", err))
+			return
+		}
+		updated_at, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		err = h.users.Update(c, user.User_id, bson.D{
+			{Key: "recovery_codes", Value: hashes},
+			{Key: "updated_at", Value: updated_at},
+		})
+		if err != nil {
+			apperror.Respond(ctx, apperror.Internal("error occured while saving recovery codes", err))
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+	}
+}
+
+// ResetTwoFactor lets an admin remove the second factor of a user who lost their device.
+// The user is logged out everywhere and has to enroll again on the next login.
+func (h *UserHandler) ResetTwoFactor() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		c, cancel := requestContext(ctx)
+		defer cancel()
+		userId := ctx.Param("user_id")
+		if err := h.clearTwoFactor(c, userId); err != nil {
+			apperror.Respond(ctx, apperror.Internal("error occured while resetting two-factor authentication", err))
+			return
+		}
+		found, err := h.users.RevokeAllSessions(c, userId)
+		if err != nil {
+			apperror.Respond(ctx, apperror.Internal("error occured while revoking the sessions", err))
+			return
+		}
+		if !found {
+			apperror.Respond(ctx, apperror.NotFound("user not found"))
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"message": "two-factor authentication reset"})
+	}
+}
+
+// verifySecondFactor accepts either a TOTP code, which cannot be replayed within its time step,
+// or one of the recovery codes, which is used up
+func (h *UserHandler) verifySecondFactor(c context.Context, user models.User, code *string, recoveryCode *string) bool {
+	if code != nil && user.Totp_secret != nil {
+		step, ok := helpers.ValidateTOTP(*user.Totp_secret, *code, time.Now())
+		if !ok {
+			return false
+		}
+		used, err := h.users.UseTotpStep(c, user.User_id, step)
+		return err == nil && used
+	}
+	if recoveryCode != nil {
+		used, err := h.users.UseRecoveryCode(c, user.User_id, helpers.HashRecoveryCode(*recoveryCode))
+		return err == nil && used
+	}
+	return false
+}
+
+func (h *UserHandler) clearTwoFactor(c context.Context, userId string) error {
+	updated_at, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	err := h.users.Update(c, userId, bson.D{
+		{Key: "totp_enabled", Value: false},
+		{Key: "totp_secret", Value: nil},
+		{Key: "totp_last_step", Value: 0},
+		{Key: "recovery_codes", Value: nil},
+		{Key: "updated_at", Value: updated_at},
+	})
+	// A user who is not there has no second factor to clear, ResetTwoFactor reports it
+	if err == repository.ErrNotFound {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,70 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/PranavMasekar/restaurant-management/helpers"
+	"github.com/PranavMasekar/restaurant-management/models"
+	"github.com/PranavMasekar/restaurant-management/repository"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestLoginUsesEachRecoveryCodeOnce(t *testing.T) {
+	configureKeys(t)
+	repos := repository.NewMemoryRepositories()
+	secret, err := helpers.GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	codes, hashes, err := helpers.GenerateRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	password, err := HashPassword("correct horse battery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	email, name, role := "ann@example.com", "Ann", models.RoleManager
+	user := models.User{ID: primitive.NewObjectID(), Email: &email, First_name: &name, Last_name: &name, Password: &password,
+		User_type: &role, Totp_enabled: true, Totp_secret: &secret, Recovery_codes: hashes}
+	user.User_id = user.ID.Hex()
+	if err := repos.Users.Create(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+	handler := NewUserHandler(repos.Users, repos.Devices, repos.UserTokens, repos.LoginAttempts, &failingMailer{}, "")
+	router := gin.New()
+	router.POST("/users/login", handler.Login())
+
+	tests := []struct {
+		name   string
+		body   gin.H
+		status int
+		code   string
+	}{
+		{"password only", gin.H{}, http.StatusUnauthorized, "two_factor_required"},
+		{"unknown recovery code", gin.H{"recovery_code": "aaaaa-aaaaa"}, http.StatusUnauthorized, "unauthorized"},
+		{"wrong TOTP code", gin.H{"totp_code": "000000x"}, http.StatusUnauthorized, "unauthorized"},
+		{"recovery code", gin.H{"recovery_code": codes[0]}, http.StatusOK, ""},
+		{"same recovery code again", gin.H{"recovery_code": codes[0]}, http.StatusUnauthorized, "unauthorized"},
+		{"another recovery code", gin.H{"recovery_code": codes[1]}, http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.body["email"], tt.body["password"] = email, "correct horse battery"
+			var body map[string]interface{}
+			if status := serve(t, router, http.MethodPost, "/users/login", tt.body, &body); status != tt.status {
+				t.Fatalf("status = %d, want %d: %v", status, tt.status, body)
+			}
+			if body["code"] != nil && body["code"] != tt.code {
+				t.Fatalf("code = %v, want %s", body["code"], tt.code)
+			}
+		})
+	}
+	stored, err := repos.Users.FindById(context.Background(), user.User_id)
+	if err != nil || len(stored.Recovery_codes) != len(codes)-2 {
+		t.Fatalf("%d recovery codes left (%v), want %d", len(stored.Recovery_codes), err, len(codes)-2)
+	}
+}
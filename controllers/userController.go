@@ -3,189 +3,686 @@ package controllers
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
+	"regexp"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
-	"github.com/PranavMasekar/restaurant-management/database"
+	"github.com/PranavMasekar/restaurant-management/apperror"
 	"github.com/PranavMasekar/restaurant-management/helpers"
+	"github.com/PranavMasekar/restaurant-management/mailer"
 	"github.com/PranavMasekar/restaurant-management/models"
+	"github.com/PranavMasekar/restaurant-management/repository"
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 	"golang.org/x/crypto/bcrypt"
 )
 
-var userCollection *mongo.Collection = database.OpenCollection(database.Client, "user")
-
-func GetUsers() gin.HandlerFunc {
-	return func(ctx *gin.Context) {
-		c, cancel := context.WithTimeout(context.Background(), 100*time.Second)
-
-		recordPerPage, err := strconv.Atoi(ctx.Query("recordPerPage"))
-		if err != nil || recordPerPage < 1 {
-			recordPerPage = 10
-		}
+// UserHandler serves the staff accounts: signup and logins, sessions, profiles, second factors
+// and PINs. Password resets and email verifications are mailed with links to appBaseURL.
+type UserHandler struct {
+	users         repository.UserRepository
+	devices       repository.DeviceRepository
+	userTokens    repository.UserTokenRepository
+	loginAttempts repository.LoginAttemptRepository
+	mailer        mailer.Mailer
+	appBaseURL    string
+}
 
-		page, err1 := strconv.Atoi(ctx.Query("page"))
-		if err1 != nil || page < 1 {
-			page = 1
-		}
+func NewUserHandler(users repository.UserRepository, devices repository.DeviceRepository, userTokens repository.UserTokenRepository, loginAttempts repository.LoginAttemptRepository, mail mailer.Mailer, appBaseURL string) *UserHandler {
+	return &UserHandler{
+		users:         users,
+		devices:       devices,
+		userTokens:    userTokens,
+		loginAttempts: loginAttempts,
+		mailer:        mail,
+		appBaseURL:    strings.TrimRight(appBaseURL, "/"),
+	}
+}
 
-		startIndex := (page - 1) * recordPerPage
-		startIndex, err = strconv.Atoi(ctx.Query("startIndex"))
+// UserView is what the API shows of a user, credentials and tokens never leave the server
+type UserView struct {
+	User_id        string     `json:"user_id"`
+	First_name     *string    `json:"first_name"`
+	Last_name      *string    `json:"last_name"`
+	Email          *string    `json:"email"`
+	Email_verified bool       `json:"email_verified"`
+	Avatar         *string    `json:"avatar"`
+	Phone          *string    `json:"phone"`
+	User_type      string     `json:"user_type"`
+	Totp_enabled   bool       `json:"totp_enabled"`
+	Pin_devices    []string   `json:"pin_devices"`
+	Deactivated_at *time.Time `json:"deactivated_at"`
+	Created_at     time.Time  `json:"created_at"`
+	Updated_at     time.Time  `json:"updated_at"`
+}
 
-		matchStage := bson.D{{"$match", bson.D{{}}}}
-		projectStage := bson.D{{"$project", bson.D{{"_id", 0}, {"total_count", 1}, {"user_items", bson.D{{"$slice", []interface{}{"$data", startIndex, recordPerPage}}}}}}}
+// Fields of the user document that list queries must leave out
+var userSecretFields = bson.D{
+	{Key: "password", Value: 0},
+	{Key: "token", Value: 0},
+	{Key: "refresh_token", Value: 0},
+	{Key: "sessions", Value: 0},
+	{Key: "totp_secret", Value: 0},
+	{Key: "totp_last_step", Value: 0},
+	{Key: "recovery_codes", Value: 0},
+	{Key: "pin_hash", Value: 0},
+}
 
-		result, err := userCollection.Aggregate(c, mongo.Pipeline{matchStage, projectStage})
+func newUserView(user models.User) UserView {
+	return UserView{
+		User_id:        user.User_id,
+		First_name:     user.First_name,
+		Last_name:      user.Last_name,
+		Email:          user.Email,
+		Email_verified: user.Email_verified,
+		Avatar:         user.Avatar,
+		Phone:          user.Phone,
+		User_type:      helpers.UserType(user),
+		Totp_enabled:   user.Totp_enabled,
+		Pin_devices:    user.Pin_devices,
+		Deactivated_at: user.Deactivated_at,
+		Created_at:     user.Created_at,
+		Updated_at:     user.Updated_at,
+	}
+}
 
+// GetUsers lists the users page by page. On top of the generic ?filter[...] they can be searched
+// with ?role=, ?name=, ?email=, ?status=active|deactivated and ?created_from=/?created_to=.
+func (h *UserHandler) GetUsers() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		c, cancel := requestContext(ctx)
 		defer cancel()
 
+		query, pagination, err := helpers.ParseListQuery(ctx, userListSpec)
+		if err != nil {
+			apperror.Respond(ctx, apperror.Invalid(err))
+			return
+		}
+		if query.Filter, err = userFilter(ctx, query.Filter); err != nil {
+			apperror.Respond(ctx, apperror.Invalid(err))
+			return
+		}
+		query.Projection = userSecretFields
+
+		users, total, err := h.users.List(c, query, pagination)
 		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while listing user items"})
+			apperror.Respond(ctx, apperror.Internal("error occured while listing user items", err))
+			return
+		}
+		userItems := []UserView{}
+		for _, user := range users {
+			userItems = append(userItems, newUserView(user))
 		}
+		ctx.JSON(http.StatusOK, helpers.ListResponse(pagination, "user_items", total, userItems))
+	}
+}
 
-		var allUsers []bson.M
+// What clients can filter and sort in the user list. Users always come back as UserView,
+// so there are no fields to select.
+var userListSpec = helpers.ListSpec{
+	Filters: map[string]helpers.FieldKind{
+		"user_id":        helpers.StringField,
+		"email_verified": helpers.BoolField,
+		"totp_enabled":   helpers.BoolField,
+		"created_at":     helpers.TimeField,
+	},
+	Sorts:        []string{"first_name", "last_name", "email", "user_type", "created_at", "updated_at"},
+	Default_sort: "-created_at",
+}
 
-		if err = result.All(c, &allUsers); err != nil {
-			log.Fatal(err)
+func userFilter(ctx *gin.Context, filter bson.D) (bson.D, error) {
+	if role := strings.ToUpper(ctx.Query("role")); role != "" {
+		if role == models.RoleWaiter {
+			// Accounts created before roles existed count as waiters
+			filter = append(filter, bson.E{Key: "user_type", Value: bson.M{"$in": bson.A{role, nil, ""}}})
+		} else {
+			filter = append(filter, bson.E{Key: "user_type", Value: role})
 		}
-		ctx.JSON(http.StatusOK, allUsers)
 	}
+	if name := ctx.Query("name"); name != "" {
+		pattern := primitive.Regex{Pattern: regexp.QuoteMeta(name), Options: "i"}
+		filter = append(filter, bson.E{Key: "$or", Value: bson.A{
+			bson.M{"first_name": pattern},
+			bson.M{"last_name": pattern},
+		}})
+	}
+	if email := ctx.Query("email"); email != "" {
+		filter = append(filter, bson.E{Key: "email", Value: primitive.Regex{Pattern: regexp.QuoteMeta(email), Options: "i"}})
+	}
+	switch ctx.Query("status") {
+	case "":
+	case "active":
+		filter = append(filter, bson.E{Key: "deactivated_at", Value: nil})
+	case "deactivated":
+		filter = append(filter, bson.E{Key: "deactivated_at", Value: bson.M{"$ne": nil}})
+	default:
+		return nil, fmt.Errorf("status must be active or deactivated")
+	}
+
+	created := bson.M{}
+	for param, operator := range map[string]string{"created_from": "$gte", "created_to": "$lte"} {
+		value := ctx.Query(param)
+		if value == "" {
+			continue
+		}
+		at, err := helpers.ParseQueryTime(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be a RFC 3339 time or a 2006-01-02 date", param)
+		}
+		// A bare date up to which to list includes the whole day
+		if operator == "$lte" && len(value) == len("2006-01-02") {
+			at = at.Add(24*time.Hour - time.Nanosecond)
+		}
+		created[operator] = at
+	}
+	if len(created) > 0 {
+		filter = append(filter, bson.E{Key: "created_at", Value: created})
+	}
+	return filter, nil
 }
 
-func GetUser() gin.HandlerFunc {
+func (h *UserHandler) GetUser() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		c, cancel := context.WithTimeout(context.Background(), 100*time.Second)
-		userId := ctx.Param("user_id")
-		var user models.User
-		err := userCollection.FindOne(c, bson.M{"user_id": userId}).Decode(&user)
+		c, cancel := requestContext(ctx)
 		defer cancel()
+		user, err := h.users.FindById(c, targetUserId(ctx))
+		if err == repository.ErrNotFound {
+			apperror.Respond(ctx, apperror.NotFound("user not found"))
+			return
+		}
 		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			apperror.Respond(ctx, err)
 			return
 		}
-		ctx.JSON(http.StatusOK, user)
+		ctx.JSON(http.StatusOK, newUserView(user))
 	}
 }
 
-func SignUp() gin.HandlerFunc {
+// SignUp lets an admin or a manager create a staff account, which starts as a WAITER and gets
+// promoted by an admin through /users/:user_id/role
+func (h *UserHandler) SignUp() gin.HandlerFunc {
+	return h.signUp(models.RoleWaiter, func(c context.Context, user models.User) (bool, error) {
+		return true, h.users.Create(c, user)
+	})
+}
+
+// Bootstrap creates the first account of a new installation as its ADMIN. Once any account
+// exists it refuses, staff accounts are then created through SignUp.
+func (h *UserHandler) Bootstrap() gin.HandlerFunc {
+	return h.signUp(models.RoleAdmin, h.users.CreateFirstUser)
+}
+
+// signUp creates an account with the given role through create, which returns false when it
+// refused to store it
+func (h *UserHandler) signUp(role string, create func(c context.Context, user models.User) (bool, error)) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		var c, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var c, cancel = requestContext(ctx)
 		defer cancel()
 		var user models.User
 		// SignUp means we have to create user so get the request body and convert to struct user
-		if err := ctx.BindJSON(&user); err != nil {
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		if err := ctx.ShouldBindJSON(&user); err != nil {
+			apperror.Respond(ctx, apperror.Invalid(err))
 			return
 		}
 		// Validate the new user with validate properties we set in model
 		validationErr := validate.Struct(user)
 
 		if validationErr != nil {
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
+			apperror.Respond(ctx, apperror.Invalid(validationErr))
 			return
 		}
-		// Checking if user aleady exits in DB via Email
-		count, err := userCollection.CountDocuments(c, bson.M{"email": user.Email})
-		defer cancel()
+		// Checking if user aleady exits in DB via Email or Phone
+		taken, err := h.users.EmailOrPhoneTaken(c, user.Email, user.Phone, "")
 		if err != nil {
-			log.Panic(err)
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while checking emails"})
+			apperror.Respond(ctx, apperror.Internal("error occured while checking emails and phone numbers", err))
+			return
+		}
+		if taken {
+			apperror.Respond(ctx, apperror.Conflict("this email or phone number alredy exits"))
 			return
 		}
 		// Hashing the password to store in db
-		password := HashPassword(*user.Password)
-		user.Password = &password
-
-		// Checking if user aleady exits in DB via Phone
-		count, err = userCollection.CountDocuments(c, bson.M{"phone": user.Phone})
-		defer cancel()
+		password, err := HashPassword(*user.Password)
 		if err != nil {
-			log.Panic(err)
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "error occured while checking phone numbers"})
+			apperror.Respond(ctx, apperror.Internal("user item was not created", err))
 			return
 		}
-
-		if count > 0 {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "this email or phone number alredy exits"})
-		}
+		user.Password = &password
+		user.User_type = &role
+		user.Email_verified = false
+		user.Deactivated_at = nil
 		// Complete the user model with rokens and time stamps
 		user.Created_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 		user.Updated_at, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 		user.ID = primitive.NewObjectID()
 		user.User_id = user.ID.Hex()
-		token, refreshToken, _ := helpers.GenerateAllTokens(*user.Email, *user.First_name, *user.Last_name, user.User_id)
+		session := helpers.NewSession(false)
+		token, refreshToken, err := helpers.GenerateAllTokens(user, session)
+		if err != nil {
+			apperror.Respond(ctx, apperror.Internal("error occured while generating tokens", err))
+			return
+		}
+		session.Refresh_token = refreshToken
 		user.Token = &token
 		user.RefreshToken = &refreshToken
+		user.Sessions = []models.Session{session}
 		// Adding user to DB
-		resultInsertionNumber, insertedError := userCollection.InsertOne(c, user)
-
-		if insertedError != nil {
-			msg := fmt.Sprintf("user item was not created")
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+		created, err := create(c, user)
+		if err != nil {
+			apperror.Respond(ctx, apperror.Internal("user item was not created", err))
+			return
+		}
+		if !created {
+			apperror.Respond(ctx, apperror.Forbidden("the first account already exists, ask an admin or a manager to create yours"))
+			return
+		}
+		// The account works without it, so a failing mail server must not fail the signup
+		if err := h.sendVerificationEmail(c, user); err != nil {
+			slog.WarnContext(c, "verification email was not sent", "user_id", user.User_id, "error", err)
 		}
-		defer cancel()
 		// Response
-		ctx.JSON(http.StatusOK, resultInsertionNumber)
+		ctx.JSON(http.StatusOK, newUserView(user))
 
 	}
 }
 
-func Login() gin.HandlerFunc {
+type loginRequest struct {
+	Email         *string `json:"email"`
+	Password      *string `json:"password"`
+	Totp_code     *string `json:"totp_code"`
+	Recovery_code *string `json:"recovery_code"`
+}
+
+type loginResponse struct {
+	UserView
+	Token         string `json:"token"`
+	Refresh_token string `json:"refresh_token"`
+}
+
+func (h *UserHandler) Login() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		var c, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var c, cancel = requestContext(ctx)
 		defer cancel()
-		var user models.User
-		var foundUser models.User
+		var user loginRequest
 		// Body of request
-		if err := ctx.BindJSON(&user); err != nil {
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		if err := ctx.ShouldBindJSON(&user); err != nil {
+			apperror.Respond(ctx, apperror.Invalid(err))
+			return
+		}
+		if user.Email == nil || user.Password == nil {
+			apperror.Respond(ctx, apperror.Validation("email and password are required"))
+			return
+		}
+		// Refuse locked emails and IPs before spending any time on bcrypt
+		ip := ctx.ClientIP()
+		lockedUntil, err := helpers.LoginLockedUntil(c, h.loginAttempts, *user.Email, ip)
+		if err != nil {
+			apperror.Respond(ctx, apperror.Internal("error occured while checking login attempts", err))
+			return
+		}
+		if wait := time.Until(lockedUntil); wait > 0 {
+			ctx.Header("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+			apperror.Respond(ctx, apperror.TooManyRequests("too many failed login attempts, try again later"))
 			return
 		}
 		// Find the collection with email and store in foundUser
-		err := userCollection.FindOne(c, bson.M{"email": user.Email}).Decode(&foundUser)
-		defer cancel()
+		foundUser, err := h.users.FindByEmail(c, *user.Email)
 		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Email or password is incorrect"})
+			// Spend the time of a password check, so the response time does not tell
+			// registered emails apart
+			VerifyPassword(*user.Password, unknownUserHash())
+			if err := helpers.RecordLoginFailure(c, h.loginAttempts, *user.Email, ip); err != nil {
+				slog.WarnContext(c, "failed login was not recorded", "email", *user.Email, "error", err)
+			}
+			apperror.Respond(ctx, apperror.Unauthorized("Email or password is incorrect"))
 			return
 		}
 		// Verify the password
-		passwordIsValid, msg := VerifyPassword(*user.Password, *foundUser.Password)
-		defer cancel()
+		passwordIsValid, _ := VerifyPassword(*user.Password, *foundUser.Password)
 
 		if !passwordIsValid {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+			if err := helpers.RecordLoginFailure(c, h.loginAttempts, *user.Email, ip); err != nil {
+				slog.WarnContext(c, "failed login was not recorded", "email", *user.Email, "error", err)
+			}
+			// The same answer as for an unknown email
+			apperror.Respond(ctx, apperror.Unauthorized("Email or password is incorrect"))
 			return
 		}
+		if foundUser.Deactivated_at != nil {
+			apperror.Respond(ctx, apperror.Forbidden("this account has been deactivated"))
+			return
+		}
+		// Accounts with 2FA also need a code from the authenticator app or a recovery code
+		if foundUser.Totp_enabled {
+			if user.Totp_code == nil && user.Recovery_code == nil {
+				appErr := apperror.Unauthorized("two-factor code required").WithCode("two_factor_required")
+				body := appErr.Body()
+				// Kept for clients written before the error codes existed
+				body["two_factor_required"] = true
+				ctx.AbortWithStatusJSON(appErr.Status, body)
+				return
+			}
+			if !h.verifySecondFactor(c, foundUser, user.Totp_code, user.Recovery_code) {
+				if err := helpers.RecordLoginFailure(c, h.loginAttempts, *user.Email, ip); err != nil {
+					slog.WarnContext(c, "failed login was not recorded", "email", *user.Email, "error", err)
+				}
+				apperror.Respond(ctx, apperror.Unauthorized("two-factor code is incorrect"))
+				return
+			}
+		}
+		if err := helpers.RecordLoginSuccess(c, h.loginAttempts, *user.Email); err != nil {
+			slog.WarnContext(c, "login attempts were not cleared", "email", *user.Email, "error", err)
+		}
 
 		if foundUser.Email == nil {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "user not found"})
+			apperror.Respond(ctx, apperror.Internal("user not found", nil))
 			return
 		}
-		// Generate the tokens
-		token, refreshToken, _ := helpers.GenerateAllTokens(*foundUser.Email, *foundUser.First_name, *foundUser.Last_name, foundUser.User_id)
-		helpers.UpdateAllTokens(token, refreshToken, foundUser.User_id)
-		err = userCollection.FindOne(c, bson.M{"user_id": foundUser.User_id}).Decode(&foundUser)
+		// Generate the tokens, every login starts a new session
+		session := helpers.NewSession(foundUser.Totp_enabled)
+		token, refreshToken, err := helpers.GenerateAllTokens(foundUser, session)
 		if err != nil {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			apperror.Respond(ctx, apperror.Internal("error occured while generating tokens", err))
+			return
+		}
+		if err := helpers.UpdateAllTokens(c, h.users, token, refreshToken, foundUser.User_id, session); err != nil {
+			apperror.Respond(ctx, apperror.Internal("error occured while saving the session", err))
 			return
 		}
 
-		ctx.JSON(http.StatusOK, foundUser)
+		ctx.JSON(http.StatusOK, loginResponse{UserView: newUserView(foundUser), Token: token, Refresh_token: refreshToken})
 	}
 }
 
-func HashPassword(password string) string {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 14)
+type refreshRequest struct {
+	Refresh_token *string `json:"refresh_token" validate:"required"`
+}
+
+func (h *UserHandler) RefreshToken() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		c, cancel := requestContext(ctx)
+		defer cancel()
+		var body refreshRequest
+
+		if err := ctx.ShouldBindJSON(&body); err != nil {
+			apperror.Respond(ctx, apperror.Invalid(err))
+			return
+		}
+		if validationErr := validate.Struct(body); validationErr != nil {
+			apperror.Respond(ctx, apperror.Invalid(validationErr))
+			return
+		}
+		// Only a genuine refresh token issued by us is accepted here
+		claims, msg := helpers.ValidateToken(*body.Refresh_token)
+		if msg != "" {
+			apperror.Respond(ctx, apperror.Unauthorized(msg))
+			return
+		}
+		if claims.Token_type != helpers.RefreshToken {
+			apperror.Respond(ctx, apperror.Unauthorized("a refresh token is required"))
+			return
+		}
+
+		foundUser, err := h.users.FindById(c, claims.Uid)
+		if err != nil {
+			apperror.Respond(ctx, apperror.Unauthorized("user not found"))
+			return
+		}
+		// The same checks as for access tokens, the terminal of a PIN session included
+		if msg := helpers.SessionProblem(c, h.devices, foundUser, claims); msg != "" {
+			apperror.Respond(ctx, apperror.Unauthorized(msg))
+			return
+		}
+		session := helpers.FindSession(foundUser, claims.Session_id)
+		// A validly signed token that is not the current one was already rotated away,
+		// so someone is replaying it: cut off the whole session
+		if session.Refresh_token != *body.Refresh_token {
+			if _, err := h.users.RevokeSession(c, foundUser.User_id, session.Session_id); err != nil {
+				apperror.Respond(ctx, apperror.Internal("error occured while revoking the session", err))
+				return
+			}
+			apperror.Respond(ctx, apperror.Unauthorized("refresh token reuse detected, session revoked"))
+			return
+		}
+
+		token, refreshToken, err := helpers.GenerateAllTokens(foundUser, *session)
+		if err != nil {
+			apperror.Respond(ctx, apperror.Internal("error occured while generating tokens", err))
+			return
+		}
+		rotated, err := helpers.RotateRefreshToken(c, h.users, foundUser.User_id, *session, *body.Refresh_token, token, refreshToken)
+		if err != nil {
+			apperror.Respond(ctx, apperror.Internal("error occured while rotating tokens", err))
+			return
+		}
+		// Another request won the race with the same refresh token, treat it as reuse as well
+		if !rotated {
+			if _, err := h.users.RevokeSession(c, foundUser.User_id, session.Session_id); err != nil {
+				apperror.Respond(ctx, apperror.Internal("error occured while revoking the session", err))
+				return
+			}
+			apperror.Respond(ctx, apperror.Unauthorized("refresh token reuse detected, session revoked"))
+			return
+		}
+
+		ctx.JSON(http.StatusOK, gin.H{"token": token, "refresh_token": refreshToken})
+	}
+}
+
+func (h *UserHandler) Logout() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		c, cancel := requestContext(ctx)
+		defer cancel()
+		// Only the session the token belongs to is closed, other devices stay logged in
+		if _, err := h.users.RevokeSession(c, ctx.GetString("uid"), ctx.GetString("session_id")); err != nil {
+			apperror.Respond(ctx, apperror.Internal("error occured while logging out", err))
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"message": "logged out"})
+	}
+}
+
+func (h *UserHandler) LogoutAll() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		c, cancel := requestContext(ctx)
+		defer cancel()
+		if _, err := h.users.RevokeAllSessions(c, ctx.GetString("uid")); err != nil {
+			apperror.Respond(ctx, apperror.Internal("error occured while logging out", err))
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"message": "logged out of all sessions"})
+	}
+}
+
+func (h *UserHandler) GetUserSessions() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		c, cancel := requestContext(ctx)
+		defer cancel()
+		user, err := h.users.FindById(c, ctx.Param("user_id"))
+		if err != nil {
+			apperror.Respond(ctx, apperror.NotFound("user not found"))
+			return
+		}
+		sessions := user.Sessions
+		if sessions == nil {
+			sessions = []models.Session{}
+		}
+		ctx.JSON(http.StatusOK, sessions)
+	}
+}
+
+func (h *UserHandler) RevokeUserSession() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		c, cancel := requestContext(ctx)
+		defer cancel()
+		found, err := h.users.RevokeSession(c, ctx.Param("user_id"), ctx.Param("session_id"))
+		if err != nil {
+			apperror.Respond(ctx, apperror.Internal("error occured while revoking the session", err))
+			return
+		}
+		if !found {
+			apperror.Respond(ctx, apperror.NotFound("session not found"))
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"message": "session revoked"})
+	}
+}
+
+func (h *UserHandler) RevokeUserSessions() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		c, cancel := requestContext(ctx)
+		defer cancel()
+		found, err := h.users.RevokeAllSessions(c, ctx.Param("user_id"))
+		if err != nil {
+			apperror.Respond(ctx, apperror.Internal("error occured while revoking the sessions", err))
+			return
+		}
+		if !found {
+			apperror.Respond(ctx, apperror.NotFound("user not found"))
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"message": "all sessions revoked"})
+	}
+}
+
+func (h *UserHandler) GetUserLockout() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		c, cancel := requestContext(ctx)
+		defer cancel()
+		var user models.User
+		user, err := h.users.FindById(c, ctx.Param("user_id"))
+		if err != nil {
+			apperror.Respond(ctx, apperror.NotFound("user not found"))
+			return
+		}
+
+		attempt, err := h.loginAttempts.FindByKey(c, helpers.EmailAttemptKey(*user.Email))
+		if err != nil && err != repository.ErrNotFound {
+			apperror.Respond(ctx, apperror.Internal("error occured while fetching login attempts", err))
+			return
+		}
+		locked := attempt.Locked_until != nil && attempt.Locked_until.After(time.Now())
+		ctx.JSON(http.StatusOK, gin.H{
+			"user_id":      user.User_id,
+			"email":        user.Email,
+			"locked":       locked,
+			"locked_until": attempt.Locked_until,
+			"failures":     attempt.Failures,
+			"lockouts":     attempt.Lockouts,
+		})
+	}
+}
+
+func (h *UserHandler) UnlockUser() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		c, cancel := requestContext(ctx)
+		defer cancel()
+		var user models.User
+		user, err := h.users.FindById(c, ctx.Param("user_id"))
+		if err != nil {
+			apperror.Respond(ctx, apperror.NotFound("user not found"))
+			return
+		}
+		if err := h.loginAttempts.Delete(c, helpers.EmailAttemptKey(*user.Email)); err != nil {
+			apperror.Respond(ctx, apperror.Internal("error occured while unlocking the user", err))
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"message": "user unlocked"})
+	}
+}
+
+func (h *UserHandler) UpdateUserRole() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		c, cancel := requestContext(ctx)
+		defer cancel()
+		var user models.User
+		userId := ctx.Param("user_id")
+
+		if err := ctx.ShouldBindJSON(&user); err != nil {
+			apperror.Respond(ctx, apperror.Invalid(err))
+			return
+		}
+		if user.User_type == nil {
+			apperror.Respond(ctx, apperror.Validation("user_type is required"))
+			return
+		}
+		if err := validate.StructPartial(user, "User_type"); err != nil {
+			apperror.Respond(ctx, apperror.Invalid(err))
+			return
+		}
+		// An admin demoting themselves could leave the restaurant without any admin
+		if userId == ctx.GetString("uid") && *user.User_type != models.RoleAdmin {
+			apperror.Respond(ctx, apperror.Validation("admins cannot change their own role"))
+			return
+		}
+
+		updated_at, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		err := h.users.Update(c, userId, bson.D{
+			{Key: "user_type", Value: user.User_type},
+			{Key: "updated_at", Value: updated_at},
+		})
+		if err == repository.ErrNotFound {
+			apperror.Respond(ctx, apperror.NotFound("user not found"))
+			return
+		}
+		if err != nil {
+			apperror.Respond(ctx, apperror.Internal("user role update failed", err))
+			return
+		}
+		// Tokens still carry the old role, so make the user log in again
+		if _, err := h.users.RevokeAllSessions(c, userId); err != nil {
+			apperror.Respond(ctx, apperror.Internal("error occured while revoking the sessions", err))
+			return
+		}
+		if user, err = h.users.FindById(c, userId); err != nil {
+			apperror.Respond(ctx, apperror.Internal("error occured while fetching the user", err))
+			return
+		}
+		ctx.JSON(http.StatusOK, newUserView(user))
+	}
+}
+
+// targetUserId is the user a /users/:user_id route works on, /users/me routes work on the caller
+func targetUserId(ctx *gin.Context) string {
+	if userId := ctx.Param("user_id"); userId != "" {
+		return userId
+	}
+	return ctx.GetString("uid")
+}
+
+// Cost of the password hashes, tests lower it to run fast
+var passwordCost = 14
+
+func HashPassword(password string) (string, error) {
+	bytes, err := bcrypt.GenerateFromPassword([]byte(password), passwordCost)
 	if err != nil {
-		log.Panic(err)
+		return "", err
 	}
 
-	return string(bytes)
+	return string(bytes), nil
+}
+
+var (
+	dummyHash     string
+	dummyHashOnce sync.Once
+)
+
+// unknownUserHash returns a bcrypt hash, as costly as those of the users, of a random password
+// nobody knows. Logins of unknown emails are checked against it.
+func unknownUserHash() string {
+	dummyHashOnce.Do(func() {
+		hash, err := bcrypt.GenerateFromPassword([]byte(primitive.NewObjectID().Hex()), passwordCost)
+		if err != nil {
+			slog.Error("could not hash the password of unknown users", "error", err)
+		}
+		dummyHash = string(hash)
+	})
+	return dummyHash
 }
 
 func VerifyPassword(userPassword string, providedPassword string) (bool, string) {
@@ -0,0 +1,510 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/PranavMasekar/restaurant-management/config"
+	"github.com/PranavMasekar/restaurant-management/helpers"
+	"github.com/PranavMasekar/restaurant-management/middleware"
+	"github.com/PranavMasekar/restaurant-management/models"
+	"github.com/PranavMasekar/restaurant-management/repository"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func init() {
+	passwordCost = bcrypt.MinCost
+}
+
+// configureKeys signs the tokens of the test with an HS256 secret
+func configureKeys(t *testing.T) {
+	t.Helper()
+	auth := config.Default().Auth
+	auth.Secret_key = strings.Repeat("k", config.MinSecretLength)
+	if err := helpers.Configure(auth); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRefreshToken(t *testing.T) {
+	configureKeys(t)
+	c := context.Background()
+	repos := repository.NewMemoryRepositories()
+	email, first, last := "ann@example.com", "Ann", "Lee"
+	user := models.User{ID: primitive.NewObjectID(), Email: &email, First_name: &first, Last_name: &last}
+	user.User_id = user.ID.Hex()
+	if err := repos.Users.Create(c, user); err != nil {
+		t.Fatal(err)
+	}
+	device := func(revoked bool) string {
+		name := "Bar terminal"
+		device := models.Device{ID: primitive.NewObjectID(), Name: &name, Revoked: revoked}
+		device.Device_id = device.ID.Hex()
+		if err := repos.Devices.Create(c, device); err != nil {
+			t.Fatal(err)
+		}
+		return device.Device_id
+	}
+	login := func(session models.Session) string {
+		token, refreshToken, err := helpers.GenerateAllTokens(user, session)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := helpers.UpdateAllTokens(c, repos.Users, token, refreshToken, user.User_id, session); err != nil {
+			t.Fatal(err)
+		}
+		return refreshToken
+	}
+
+	handler := NewUserHandler(repos.Users, repos.Devices, repos.UserTokens, repos.LoginAttempts, &failingMailer{}, "")
+	router := gin.New()
+	router.POST("/users/refresh", handler.RefreshToken())
+
+	rotated := login(helpers.NewSession(false))
+	serve(t, router, http.MethodPost, "/users/refresh", gin.H{"refresh_token": rotated}, nil)
+
+	tests := []struct {
+		name         string
+		refreshToken string
+		status       int
+		error        string
+	}{
+		{"password login", login(helpers.NewSession(false)), http.StatusOK, ""},
+		{"PIN login on an active terminal", login(helpers.NewTerminalSession(device(false))), http.StatusOK, ""},
+		{"PIN login on a revoked terminal", login(helpers.NewTerminalSession(device(true))), http.StatusUnauthorized, "device has been revoked"},
+		{"rotated refresh token", rotated, http.StatusUnauthorized, "refresh token reuse detected"},
+		{"not a token", "not-a-token", http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body map[string]interface{}
+			code := serve(t, router, http.MethodPost, "/users/refresh", gin.H{"refresh_token": tt.refreshToken}, &body)
+			if code != tt.status {
+				t.Fatalf("status = %d, want %d: %v", code, tt.status, body)
+			}
+			if message, _ := body["error"].(string); !strings.Contains(message, tt.error) {
+				t.Fatalf("error = %q, want %q", message, tt.error)
+			}
+			if tt.status == http.StatusOK && (body["token"] == nil || body["refresh_token"] == tt.refreshToken) {
+				t.Fatalf("refresh did not rotate the tokens: %v", body)
+			}
+		})
+	}
+}
+
+func TestBootstrapCreatesASingleAdmin(t *testing.T) {
+	configureKeys(t)
+	repos := repository.NewMemoryRepositories()
+	handler := NewUserHandler(repos.Users, repos.Devices, repos.UserTokens, repos.LoginAttempts, &failingMailer{}, "")
+	router := gin.New()
+	router.POST("/users/bootstrap", handler.Bootstrap())
+	router.POST("/users/signup", handler.SignUp())
+
+	account := func(i int) gin.H {
+		return gin.H{"first_name": "Ann", "last_name": "Lee", "password": "correct horse battery",
+			"email": fmt.Sprintf("staff%d@example.com", i), "phone": fmt.Sprintf("555000%d", i)}
+	}
+	// Concurrent bootstraps of an empty installation, a single one may win
+	codes := make(chan int, 8)
+	var wg sync.WaitGroup
+	for i := 0; i < cap(codes); i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			codes <- serve(t, router, http.MethodPost, "/users/bootstrap", account(i), nil)
+		}(i)
+	}
+	wg.Wait()
+	close(codes)
+	created := 0
+	for code := range codes {
+		switch code {
+		case http.StatusOK:
+			created++
+		case http.StatusForbidden:
+		default:
+			t.Fatalf("POST /users/bootstrap = %d", code)
+		}
+	}
+	if count, _ := repos.Users.Count(context.Background()); created != 1 || count != 1 {
+		t.Fatalf("%d bootstraps succeeded and %d users exist, want 1", created, count)
+	}
+
+	var staff UserView
+	if code := serve(t, router, http.MethodPost, "/users/signup", account(9), &staff); code != http.StatusOK {
+		t.Fatalf("POST /users/signup = %d", code)
+	}
+	if staff.User_type != models.RoleWaiter {
+		t.Fatalf("signup created a %s, want a %s", staff.User_type, models.RoleWaiter)
+	}
+}
+
+func TestLoginThrottlesThePeerBehindForwardedHeaders(t *testing.T) {
+	tests := []struct {
+		name    string
+		proxies []string
+		locked  bool
+	}{
+		// Rotating X-Forwarded-For must not give each failure a fresh IP
+		{"no trusted proxy", config.Default().Http.Trusted_proxies, true},
+		{"behind a trusted load balancer", []string{"192.0.2.0/24"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repos := repository.NewMemoryRepositories()
+			handler := NewUserHandler(repos.Users, repos.Devices, repos.UserTokens, repos.LoginAttempts, &failingMailer{}, "")
+			router := gin.New()
+			if err := router.SetTrustedProxies(tt.proxies); err != nil {
+				t.Fatal(err)
+			}
+			router.POST("/users/login", handler.Login())
+
+			login := func(i int) int {
+				body := fmt.Sprintf(`{"email":"guest%d@example.com","password":"guess"}`, i)
+				req := httptest.NewRequest(http.MethodPost, "/users/login", strings.NewReader(body))
+				req.Header.Set("Content-Type", "application/json")
+				req.Header.Set("X-Forwarded-For", fmt.Sprintf("203.0.113.%d", i))
+				req.RemoteAddr = "192.0.2.10:41000"
+				rec := httptest.NewRecorder()
+				router.ServeHTTP(rec, req)
+				return rec.Code
+			}
+			for i := 0; i < 20; i++ {
+				if code := login(i); code != http.StatusUnauthorized {
+					t.Fatalf("failure %d: status = %d, want %d", i, code, http.StatusUnauthorized)
+				}
+			}
+			if locked := login(20) == http.StatusTooManyRequests; locked != tt.locked {
+				t.Fatalf("peer locked after 20 failures = %v, want %v", locked, tt.locked)
+			}
+		})
+	}
+}
+
+func TestLoginAnswersUnknownEmailsLikeWrongPasswords(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	password, err := HashPassword("correct horse battery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	email, name := "ann@example.com", "Ann"
+	user := models.User{ID: primitive.NewObjectID(), Email: &email, First_name: &name, Last_name: &name, Password: &password}
+	user.User_id = user.ID.Hex()
+	if err := repos.Users.Create(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+	handler := NewUserHandler(repos.Users, repos.Devices, repos.UserTokens, repos.LoginAttempts, &failingMailer{}, "")
+	router := gin.New()
+	router.POST("/users/login", handler.Login())
+
+	var wrongPassword, unknownEmail map[string]interface{}
+	wrongCode := serve(t, router, http.MethodPost, "/users/login", gin.H{"email": email, "password": "guess"}, &wrongPassword)
+	unknownCode := serve(t, router, http.MethodPost, "/users/login", gin.H{"email": "bob@example.com", "password": "guess"}, &unknownEmail)
+	if wrongCode != http.StatusUnauthorized || unknownCode != wrongCode || fmt.Sprint(unknownEmail) != fmt.Sprint(wrongPassword) {
+		t.Fatalf("unknown email = %d %v, wrong password = %d %v", unknownCode, unknownEmail, wrongCode, wrongPassword)
+	}
+	// Unknown emails wait for a bcrypt check as long as the registered ones
+	if cost, err := bcrypt.Cost([]byte(unknownUserHash())); err != nil || cost != passwordCost {
+		t.Fatalf("unknown emails are checked at cost %d (%v), want %d", cost, err, passwordCost)
+	}
+}
+
+// sessionRouter serves the login, refresh and logout routes of the handler, with the
+// authentication main puts in front of them, and GET /users/me to try access tokens on
+func sessionRouter(repos repository.Repositories) *gin.Engine {
+	handler := NewUserHandler(repos.Users, repos.Devices, repos.UserTokens, repos.LoginAttempts, &failingMailer{}, "")
+	auth := middleware.NewAuthenticator(repos.Users, repos.Devices, false)
+	router := gin.New()
+	router.POST("/users/login", handler.Login())
+	router.POST("/users/refresh", handler.RefreshToken())
+	router.GET("/users/me", auth.Authentication(), handler.GetUser())
+	router.POST("/users/me/password", auth.Authentication(), handler.ChangePassword())
+	router.POST("/users/logout", auth.EnrollmentAuthentication(), handler.Logout())
+	router.POST("/users/logout-all", auth.EnrollmentAuthentication(), handler.LogoutAll())
+	return router
+}
+
+// tokens are what a login or a refresh hands out
+type tokens struct {
+	Token         string `json:"token"`
+	Refresh_token string `json:"refresh_token"`
+}
+
+// serveAs runs a request like serve, authenticated with the access token
+func serveAs(t *testing.T, router *gin.Engine, method, target, token string, body interface{}, out interface{}) int {
+	t.Helper()
+	var payload strings.Builder
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req := httptest.NewRequest(method, target, strings.NewReader(payload.String()))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if out != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			t.Fatalf("%s %s: cannot decode %q: %v", method, target, rec.Body.String(), err)
+		}
+	}
+	return rec.Code
+}
+
+// seedStaff stores a waiter who logs in with ann@example.com and the password
+func seedStaff(t *testing.T, repos repository.Repositories, password string) {
+	t.Helper()
+	hash, err := HashPassword(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	email, name, phone := "ann@example.com", "Ann", "5550001"
+	user := models.User{ID: primitive.NewObjectID(), Email: &email, First_name: &name, Last_name: &name, Phone: &phone, Password: &hash}
+	user.User_id = user.ID.Hex()
+	if err := repos.Users.Create(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func login(t *testing.T, router *gin.Engine, password string) tokens {
+	t.Helper()
+	var out tokens
+	if code := serve(t, router, http.MethodPost, "/users/login", gin.H{"email": "ann@example.com", "password": password}, &out); code != http.StatusOK {
+		t.Fatalf("login = %d", code)
+	}
+	return out
+}
+
+func TestRefreshTokenReuseRevokesTheSession(t *testing.T) {
+	configureKeys(t)
+	repos := repository.NewMemoryRepositories()
+	seedStaff(t, repos, "correct horse battery")
+	router := sessionRouter(repos)
+	refresh := func(refreshToken string) (tokens, int) {
+		var out tokens
+		code := serve(t, router, http.MethodPost, "/users/refresh", gin.H{"refresh_token": refreshToken}, &out)
+		return out, code
+	}
+
+	first, other := login(t, router, "correct horse battery"), login(t, router, "correct horse battery")
+	rotated, code := refresh(first.Refresh_token)
+	if code != http.StatusOK || rotated.Refresh_token == first.Refresh_token {
+		t.Fatalf("refresh = %d, want a new refresh token", code)
+	}
+	// The first refresh token was rotated away, presenting it again is a replay
+	if _, code := refresh(first.Refresh_token); code != http.StatusUnauthorized {
+		t.Fatalf("replayed refresh token = %d, want %d", code, http.StatusUnauthorized)
+	}
+
+	tests := []struct {
+		name  string
+		check func() int
+		want  int
+	}{
+		{"the current refresh token of the session", func() int { _, code := refresh(rotated.Refresh_token); return code }, http.StatusUnauthorized},
+		{"the access token of the session", func() int { return serveAs(t, router, http.MethodGet, "/users/me", rotated.Token, nil, nil) }, http.StatusUnauthorized},
+		{"the access token of another session", func() int { return serveAs(t, router, http.MethodGet, "/users/me", other.Token, nil, nil) }, http.StatusOK},
+		{"the refresh token of another session", func() int { _, code := refresh(other.Refresh_token); return code }, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := tt.check(); code != tt.want {
+				t.Fatalf("status = %d, want %d", code, tt.want)
+			}
+		})
+	}
+}
+
+func TestLogoutAndPasswordChangeRevokeTokens(t *testing.T) {
+	configureKeys(t)
+	tests := []struct {
+		name string
+		// action is taken with the first of two sessions, it returns the tokens it hands out
+		action func(router *gin.Engine, first tokens) (tokens, int)
+		// first and second are the statuses /users/me answers to the access tokens afterwards
+		first, second int
+		// newSession tells whether the action logs the caller back in
+		newSession bool
+	}{
+		{"logout", func(router *gin.Engine, first tokens) (tokens, int) {
+			return tokens{}, serveAs(t, router, http.MethodPost, "/users/logout", first.Token, nil, nil)
+		}, http.StatusUnauthorized, http.StatusOK, false},
+		{"logout of all sessions", func(router *gin.Engine, first tokens) (tokens, int) {
+			return tokens{}, serveAs(t, router, http.MethodPost, "/users/logout-all", first.Token, nil, nil)
+		}, http.StatusUnauthorized, http.StatusUnauthorized, false},
+		{"password change", func(router *gin.Engine, first tokens) (tokens, int) {
+			var out tokens
+			body := gin.H{"current_password": "correct horse battery", "new_password": "battery staple"}
+			return out, serveAs(t, router, http.MethodPost, "/users/me/password", first.Token, body, &out)
+		}, http.StatusUnauthorized, http.StatusUnauthorized, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repos := repository.NewMemoryRepositories()
+			seedStaff(t, repos, "correct horse battery")
+			router := sessionRouter(repos)
+			first, second := login(t, router, "correct horse battery"), login(t, router, "correct horse battery")
+
+			issued, code := tt.action(router, first)
+			if code != http.StatusOK {
+				t.Fatalf("%s = %d", tt.name, code)
+			}
+			if code := serveAs(t, router, http.MethodGet, "/users/me", first.Token, nil, nil); code != tt.first {
+				t.Fatalf("access token of the first session = %d, want %d", code, tt.first)
+			}
+			if code := serveAs(t, router, http.MethodGet, "/users/me", second.Token, nil, nil); code != tt.second {
+				t.Fatalf("access token of the second session = %d, want %d", code, tt.second)
+			}
+			refresh := serve(t, router, http.MethodPost, "/users/refresh", gin.H{"refresh_token": first.Refresh_token}, nil)
+			if refresh != http.StatusUnauthorized {
+				t.Fatalf("refresh token of the first session = %d, want %d", refresh, http.StatusUnauthorized)
+			}
+			if tt.newSession {
+				if code := serveAs(t, router, http.MethodGet, "/users/me", issued.Token, nil, nil); code != http.StatusOK {
+					t.Fatalf("access token handed out = %d, want %d", code, http.StatusOK)
+				}
+				login(t, router, "battery staple")
+			}
+		})
+	}
+}
+
+func TestGetUsersFilters(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	day := func(d int) time.Time { return time.Date(2024, time.March, d, 12, 0, 0, 0, time.UTC) }
+	deactivated := day(20)
+	role := func(role string) *string { return &role }
+	seeded := []struct {
+		first, email string
+		role         *string
+		created      time.Time
+		deactivated  *time.Time
+	}{
+		{"Ann", "ann@example.com", nil, day(1), nil},
+		{"Bob", "bob@example.com", role(models.RoleWaiter), day(2), nil},
+		{"Carl", "carl@kitchen.example.com", role(models.RoleKitchen), day(3), nil},
+		{"Dana", "dana@example.com", role(models.RoleManager), day(4), &deactivated},
+		{"Joanna", "jo.anna@example.com", role(models.RoleCashier), day(5), nil},
+	}
+	for _, s := range seeded {
+		first, last, email, password := s.first, "Smith", s.email, "secret"
+		user := models.User{ID: primitive.NewObjectID(), First_name: &first, Last_name: &last, Email: &email, Password: &password,
+			User_type: s.role, Created_at: s.created, Deactivated_at: s.deactivated}
+		user.User_id = user.ID.Hex()
+		if err := repos.Users.Create(context.Background(), user); err != nil {
+			t.Fatal(err)
+		}
+	}
+	handler := NewUserHandler(repos.Users, repos.Devices, repos.UserTokens, repos.LoginAttempts, &failingMailer{}, "")
+	router := gin.New()
+	router.GET("/users", handler.GetUsers())
+
+	tests := []struct {
+		query  string
+		status int
+		want   []string
+	}{
+		{"", http.StatusOK, []string{"Joanna", "Dana", "Carl", "Bob", "Ann"}},
+		// Accounts without a role are waiters
+		{"role=waiter", http.StatusOK, []string{"Bob", "Ann"}},
+		{"role=KITCHEN", http.StatusOK, []string{"Carl"}},
+		{"name=ANN&sort=first_name", http.StatusOK, []string{"Ann", "Joanna"}},
+		// The search is literal, the dot is no wildcard
+		{"email=jo.an", http.StatusOK, []string{"Joanna"}},
+		{"email=ann.example", http.StatusOK, nil},
+		{"status=active&sort=first_name", http.StatusOK, []string{"Ann", "Bob", "Carl", "Joanna"}},
+		{"status=deactivated", http.StatusOK, []string{"Dana"}},
+		// A bare date up to which to list includes the whole day
+		{"created_from=2024-03-02&created_to=2024-03-04&sort=created_at", http.StatusOK, []string{"Bob", "Carl", "Dana"}},
+		{"status=gone", http.StatusBadRequest, nil},
+		{"created_from=yesterday", http.StatusBadRequest, nil},
+		{"sort=password", http.StatusBadRequest, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			var out struct {
+				Total_count int64             `json:"total_count"`
+				User_items  []json.RawMessage `json:"user_items"`
+			}
+			code := serve(t, router, http.MethodGet, "/users?"+tt.query, nil, &out)
+			if code != tt.status {
+				t.Fatalf("status = %d, want %d", code, tt.status)
+			}
+			if code != http.StatusOK {
+				return
+			}
+			var names []string
+			for _, raw := range out.User_items {
+				if strings.Contains(strings.ToLower(string(raw)), "password") {
+					t.Fatalf("listed user has a password: %s", raw)
+				}
+				var user UserView
+				if err := json.Unmarshal(raw, &user); err != nil {
+					t.Fatal(err)
+				}
+				names = append(names, *user.First_name)
+			}
+			if fmt.Sprint(names) != fmt.Sprint(tt.want) || out.Total_count != int64(len(tt.want)) {
+				t.Fatalf("users = %v (total %d), want %v", names, out.Total_count, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetUsersPages(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	for i := 0; i < 5; i++ {
+		first, email := fmt.Sprintf("User%d", i), fmt.Sprintf("user%d@example.com", i)
+		user := models.User{ID: primitive.NewObjectID(), First_name: &first, Email: &email, Created_at: time.Unix(int64(i), 0)}
+		user.User_id = user.ID.Hex()
+		if err := repos.Users.Create(context.Background(), user); err != nil {
+			t.Fatal(err)
+		}
+	}
+	handler := NewUserHandler(repos.Users, repos.Devices, repos.UserTokens, repos.LoginAttempts, &failingMailer{}, "")
+	router := gin.New()
+	router.GET("/users", handler.GetUsers())
+
+	var seen []string
+	target := "/users?sort=created_at&limit=2"
+	for pages := 0; target != ""; pages++ {
+		if pages > 3 {
+			t.Fatal("the cursors never end")
+		}
+		var out struct {
+			Total_count int64      `json:"total_count"`
+			Total_pages int64      `json:"total_pages"`
+			Next_cursor *string    `json:"next_cursor"`
+			User_items  []UserView `json:"user_items"`
+		}
+		if code := serve(t, router, http.MethodGet, target, nil, &out); code != http.StatusOK {
+			t.Fatalf("GET %s = %d", target, code)
+		}
+		if out.Total_count != 5 || out.Total_pages != 3 {
+			t.Fatalf("total_count = %d, total_pages = %d, want 5 and 3", out.Total_count, out.Total_pages)
+		}
+		for _, user := range out.User_items {
+			seen = append(seen, *user.First_name)
+		}
+		target = ""
+		if out.Next_cursor != nil {
+			target = "/users?sort=created_at&limit=2&cursor=" + *out.Next_cursor
+		}
+	}
+	if fmt.Sprint(seen) != "[User0 User1 User2 User3 User4]" {
+		t.Fatalf("pages listed %v", seen)
+	}
+	if code := serve(t, router, http.MethodGet, "/users?cursor=bogus", nil, nil); code != http.StatusBadRequest {
+		t.Fatalf("bogus cursor = %d, want %d", code, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,123 @@
+package database
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/PranavMasekar/restaurant-management/metrics"
+	"github.com/PranavMasekar/restaurant-management/tracing"
+	"go.mongodb.org/mongo-driver/event"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Commands slower than this are logged even when debug logging is off
+const slowCommand = 100 * time.Millisecond
+
+// A command between its started and finished events
+type runningCommand struct {
+	collection string
+	span       trace.Span
+}
+
+// commandMonitor logs, times and traces the MongoDB commands. Logs use the context of the operation
+// that sent the command, so every command a request runs carries its request_id, and its span is
+// a child of the request span.
+func commandMonitor() *event.CommandMonitor {
+	// Only the started event names the collection and has the caller's context, keep both until
+	// the command finishes
+	var commands sync.Map
+
+	finish := func(requestID int64) runningCommand {
+		command, _ := commands.LoadAndDelete(requestID)
+		running, _ := command.(runningCommand)
+		return running
+	}
+
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, e *event.CommandStartedEvent) {
+			var command runningCommand
+			// Collection commands hold the collection name, like {find: "food"}
+			command.collection, _ = e.Command.Lookup(e.CommandName).StringValueOK()
+
+			// Commands outside of a traced operation, like the handshakes and the startup
+			// ping, would only make root spans of their own
+			if trace.SpanContextFromContext(ctx).IsValid() {
+				attributes := []attribute.KeyValue{
+					semconv.DBSystemMongoDB,
+					semconv.DBNamespace(e.DatabaseName),
+					semconv.DBOperationName(e.CommandName),
+				}
+				name := e.CommandName
+				if command.collection != "" {
+					attributes = append(attributes, semconv.DBCollectionName(command.collection))
+					name += " " + command.collection
+				}
+				// The stages of a pipeline tell which lookup an aggregation is spending its time on
+				if pipeline, err := e.Command.LookupErr("pipeline"); err == nil {
+					attributes = append(attributes, semconv.DBQueryText(pipeline.String()))
+				}
+				_, command.span = tracing.Tracer().Start(ctx, name,
+					trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attributes...))
+			}
+			if command.collection != "" || command.span != nil {
+				commands.Store(e.RequestID, command)
+			}
+		},
+		Succeeded: func(ctx context.Context, e *event.CommandSucceededEvent) {
+			duration := time.Duration(e.DurationNanos)
+			command := finish(e.RequestID)
+			if command.span != nil {
+				command.span.End()
+			}
+			name := command.collection
+			metrics.MongoCommandDuration.WithLabelValues(e.CommandName, name, "ok").Observe(duration.Seconds())
+
+			level := slog.LevelDebug
+			if duration >= slowCommand {
+				level = slog.LevelInfo
+			}
+			slog.Log(ctx, level, "mongo command",
+				"command", e.CommandName, "collection", name, "duration_ms", float64(duration.Microseconds())/1000)
+		},
+		Failed: func(ctx context.Context, e *event.CommandFailedEvent) {
+			duration := time.Duration(e.DurationNanos)
+			command := finish(e.RequestID)
+			if command.span != nil {
+				command.span.SetStatus(codes.Error, e.Failure)
+				command.span.End()
+			}
+			name := command.collection
+			metrics.MongoCommandDuration.WithLabelValues(e.CommandName, name, "error").Observe(duration.Seconds())
+
+			slog.WarnContext(ctx, "mongo command failed",
+				"command", e.CommandName, "collection", name, "duration_ms", float64(duration.Microseconds())/1000, "error", e.Failure)
+		},
+	}
+}
+
+// poolMonitor keeps the connection pool gauges up to date
+func poolMonitor() *event.PoolMonitor {
+	open := metrics.MongoPoolConnections.WithLabelValues("open")
+	inUse := metrics.MongoPoolConnections.WithLabelValues("in_use")
+	return &event.PoolMonitor{
+		Event: func(e *event.PoolEvent) {
+			switch e.Type {
+			case event.ConnectionCreated:
+				open.Inc()
+			case event.ConnectionClosed:
+				open.Dec()
+			case event.GetSucceeded:
+				inUse.Inc()
+			case event.ConnectionReturned:
+				inUse.Dec()
+			case event.GetFailed:
+				metrics.MongoPoolCheckoutFailures.WithLabelValues(e.Reason).Inc()
+			}
+		},
+	}
+}
@@ -0,0 +1,72 @@
+package database
+
+import (
+	"context"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestCommandMonitorTracesCommandsOfTracedRequests(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(provider)
+
+	requestCtx, request := otel.Tracer("test").Start(context.Background(), "GET /foods")
+	defer request.End()
+	find, _ := bson.Marshal(bson.D{{Key: "find", Value: "food"}})
+	aggregate, _ := bson.Marshal(bson.D{{Key: "aggregate", Value: "orderItem"}, {Key: "pipeline", Value: bson.A{bson.M{"$match": bson.M{}}}}})
+
+	tests := []struct {
+		name      string
+		ctx       context.Context
+		command   bson.Raw
+		operation string
+		failure   string
+		span      string
+	}{
+		{"find", requestCtx, find, "find", "", "find food"},
+		{"failed aggregation", requestCtx, aggregate, "aggregate", "pipeline too long", "aggregate orderItem"},
+		// Handshakes and the startup ping belong to no request
+		{"outside of a request", context.Background(), find, "find", "", ""},
+	}
+	monitor := commandMonitor()
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := len(recorder.Ended())
+			requestID := int64(i + 1)
+			monitor.Started(tt.ctx, &event.CommandStartedEvent{Command: tt.command, DatabaseName: "restaurant", CommandName: tt.operation, RequestID: requestID})
+			finished := event.CommandFinishedEvent{CommandName: tt.operation, RequestID: requestID}
+			if tt.failure != "" {
+				monitor.Failed(tt.ctx, &event.CommandFailedEvent{CommandFinishedEvent: finished, Failure: tt.failure})
+			} else {
+				monitor.Succeeded(tt.ctx, &event.CommandSucceededEvent{CommandFinishedEvent: finished})
+			}
+
+			spans := recorder.Ended()[before:]
+			if tt.span == "" {
+				if len(spans) != 0 {
+					t.Fatalf("traced %d spans, want none", len(spans))
+				}
+				return
+			}
+			if len(spans) != 1 {
+				t.Fatalf("traced %d spans, want 1", len(spans))
+			}
+			span := spans[0]
+			if span.Name() != tt.span || span.SpanKind() != trace.SpanKindClient || span.Parent().SpanID() != request.SpanContext().SpanID() {
+				t.Fatalf("span = %s (%v, parent %v), want the client span %s under the request", span.Name(), span.SpanKind(), span.Parent().SpanID(), tt.span)
+			}
+			if failed := span.Status().Code == codes.Error; failed != (tt.failure != "") {
+				t.Fatalf("span status = %v, want failed %v", span.Status(), tt.failure != "")
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/PranavMasekar/restaurant-management/config"
+)
+
+// Nothing listens on port 1, every attempt fails once its connect timeout is over
+var unreachable = config.Mongo{Uri: "mongodb://127.0.0.1:1/?connect=direct", Database: "test", Connect_timeout: 50 * time.Millisecond}
+
+func TestConnectGivesUpAfterItsAttempts(t *testing.T) {
+	cfg := unreachable
+	cfg.Startup_attempts = 1
+	start := time.Now()
+	if _, err := Connect(context.Background(), cfg); err == nil {
+		t.Fatal("Connect() to nothing succeeded")
+	}
+	// A single attempt does not wait for a retry
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("Connect() took %v for a single attempt", elapsed)
+	}
+}
+
+func TestConnectStopsRetryingWhenCancelled(t *testing.T) {
+	cfg := unreachable
+	cfg.Startup_attempts = 5
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := Connect(ctx, cfg); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Connect() = %v, want %v", err, context.DeadlineExceeded)
+	}
+	// The first retry waits a second, cancelling cuts it short
+	if elapsed := time.Since(start); elapsed > 900*time.Millisecond {
+		t.Fatalf("Connect() returned %v after it was cancelled", elapsed)
+	}
+}
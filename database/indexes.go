@@ -0,0 +1,35 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Collections whose lists are paginated with keyset cursors on created_at and _id
+var keysetCollections = []string{"order", "orderItem", "invoice"}
+
+// EnsureIndexes creates the indexes the list queries and the login throttling rely on. Creating an
+// existing index is a no-op.
+func EnsureIndexes(db *mongo.Database) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	for _, name := range keysetCollections {
+		_, err := db.Collection(name).Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys: bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	// One counter per throttled key, concurrent first failures must not each insert their own
+	_, err := db.Collection("loginAttempt").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "key", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
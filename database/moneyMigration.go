@@ -0,0 +1,59 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/PranavMasekar/restaurant-management/money"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Fields that held prices as plain numbers before they were money.Money
+var moneyFields = []struct{ collection, field string }{
+	{"food", "price"},
+	{"orderItem", "unit_price"},
+}
+
+// MigrateMoney rewrites the prices still stored as plain numbers as {amount: Decimal128, currency}
+// in money.DefaultCurrency, rounded to the cent. Migrated documents no longer match, so it can run
+// at every start. It returns the number of documents rewritten.
+func MigrateMoney(db *mongo.Database) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	var migrated int64
+	for _, target := range moneyFields {
+		collection := db.Collection(target.collection)
+		legacy := bson.D{{Key: target.field, Value: bson.D{{Key: "$type", Value: bson.A{"double", "int", "long", "decimal"}}}}}
+		cursor, err := collection.Find(ctx, legacy, options.Find().SetProjection(bson.D{{Key: target.field, Value: 1}}))
+		if err != nil {
+			return migrated, err
+		}
+		for cursor.Next(ctx) {
+			id := cursor.Current.Lookup("_id")
+			stored := cursor.Current.Lookup(target.field)
+			var price money.Money
+			if err = price.UnmarshalBSONValue(stored.Type, stored.Value); err != nil {
+				cursor.Close(ctx)
+				return migrated, err
+			}
+			// Matching the old value leaves alone a price changed since it was read
+			result, err := collection.UpdateOne(ctx,
+				bson.D{{Key: "_id", Value: id}, {Key: target.field, Value: stored}},
+				bson.D{{Key: "$set", Value: bson.D{{Key: target.field, Value: price}}}})
+			if err != nil {
+				cursor.Close(ctx)
+				return migrated, err
+			}
+			migrated += result.ModifiedCount
+		}
+		err = cursor.Err()
+		cursor.Close(ctx)
+		if err != nil {
+			return migrated, err
+		}
+	}
+	return migrated, nil
+}
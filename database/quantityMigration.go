@@ -0,0 +1,50 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/PranavMasekar/restaurant-management/models"
+	"github.com/PranavMasekar/restaurant-management/money"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MigrateQuantities rewrites the order items whose quantity is still a S, M or L size: they get
+// a quantity of 1 and the size as a free modifier of a "size" group. Migrated items no longer
+// match, so it can run at every start. It returns the number of order items rewritten.
+func MigrateQuantities(db *mongo.Database) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	collection := db.Collection("orderItem")
+	legacy := bson.D{{Key: "quantity", Value: bson.D{{Key: "$type", Value: "string"}}}}
+	cursor, err := collection.Find(ctx, legacy, options.Find().SetProjection(bson.D{{Key: "quantity", Value: 1}}))
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var migrated int64
+	for cursor.Next(ctx) {
+		id := cursor.Current.Lookup("_id")
+		size := cursor.Current.Lookup("quantity").StringValue()
+		modifiers := []models.SelectedModifier{{
+			Group_id:    "size",
+			Option_id:   size,
+			Group_name:  "Size",
+			Name:        size,
+			Price_delta: money.New(0, money.DefaultCurrency),
+		}}
+		// Matching the old value leaves alone an item changed since it was read
+		result, err := collection.UpdateOne(ctx,
+			bson.D{{Key: "_id", Value: id}, {Key: "quantity", Value: size}},
+			bson.D{{Key: "$set", Value: bson.D{{Key: "quantity", Value: 1}, {Key: "modifiers", Value: modifiers}}}})
+		if err != nil {
+			return migrated, err
+		}
+		migrated += result.ModifiedCount
+	}
+	return migrated, cursor.Err()
+}
@@ -0,0 +1,40 @@
+package helpers
+
+import (
+	"net/url"
+
+	"github.com/PranavMasekar/restaurant-management/repository"
+	"github.com/gin-gonic/gin"
+)
+
+// CursorResponse is the body of a keyset paginated list, the items are listed under key. The
+// links repeat the current request with the cursor of the next and the previous page.
+func CursorResponse(ctx *gin.Context, p repository.Pagination, key string, page repository.KeysetPage, items interface{}) gin.H {
+	links := gin.H{"next": nil, "prev": nil}
+	cursors := gin.H{"next_cursor": nil, "prev_cursor": nil}
+	for name, cursor := range map[string]*repository.KeysetCursor{"next": page.Next, "prev": page.Prev} {
+		if cursor == nil {
+			continue
+		}
+		encoded := cursor.Encode()
+		cursors[name+"_cursor"] = encoded
+		links[name] = pageLink(ctx, encoded)
+	}
+	return gin.H{
+		"per_page":    p.Per_page,
+		"next_cursor": cursors["next_cursor"],
+		"prev_cursor": cursors["prev_cursor"],
+		"links":       links,
+		key:           items,
+	}
+}
+
+func pageLink(ctx *gin.Context, cursor string) string {
+	link := url.URL{Path: ctx.Request.URL.Path}
+	query := ctx.Request.URL.Query()
+	query.Set("cursor", cursor)
+	query.Del("page")
+	query.Del("startIndex")
+	link.RawQuery = query.Encode()
+	return link.String()
+}
@@ -0,0 +1,53 @@
+package helpers
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/PranavMasekar/restaurant-management/repository"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCursorResponse(t *testing.T) {
+	next := repository.KeysetCursor{Created_at: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC), ID: primitive.NewObjectID()}
+	prev := repository.KeysetCursor{Created_at: next.Created_at, ID: primitive.NewObjectID(), Backward: true}
+	tests := []struct {
+		name       string
+		page       repository.KeysetPage
+		next, prev *repository.KeysetCursor
+	}{
+		{"single page", repository.KeysetPage{}, nil, nil},
+		{"first page", repository.KeysetPage{Next: &next}, &next, nil},
+		{"middle page", repository.KeysetPage{Next: &next, Prev: &prev}, &next, &prev},
+		{"last page", repository.KeysetPage{Prev: &prev}, nil, &prev},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := listContext("filter[order_id]=42&limit=2&page=3&startIndex=4&cursor=old")
+			body := CursorResponse(ctx, repository.Pagination{Per_page: 2}, "order_items", tt.page, []string{"item"})
+			links := body["links"].(gin.H)
+			for name, want := range map[string]*repository.KeysetCursor{"next": tt.next, "prev": tt.prev} {
+				if want == nil {
+					if body[name+"_cursor"] != nil || links[name] != nil {
+						t.Fatalf("%s = %v, want none", name, body[name+"_cursor"])
+					}
+					continue
+				}
+				encoded, _ := body[name+"_cursor"].(string)
+				decoded, err := repository.DecodeKeysetCursor(encoded)
+				if err != nil || decoded.ID != want.ID || decoded.Backward != want.Backward {
+					t.Fatalf("%s_cursor = %q, want %v", name, encoded, *want)
+				}
+				// The link repeats the request with the new cursor, without the offset parameters
+				link, _ := url.Parse(links[name].(string))
+				query := link.Query()
+				if link.Path != "/foods" || query.Get("cursor") != encoded || query.Get("filter[order_id]") != "42" ||
+					query.Get("limit") != "2" || query.Has("page") || query.Has("startIndex") {
+					t.Fatalf("%s link = %q", name, links[name])
+				}
+			}
+		})
+	}
+}
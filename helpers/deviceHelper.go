@@ -0,0 +1,46 @@
+package helpers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+
+	"github.com/PranavMasekar/restaurant-management/models"
+	"github.com/PranavMasekar/restaurant-management/repository"
+)
+
+// GenerateDeviceSecret returns the secret a terminal authenticates with and the hash to store
+func GenerateDeviceSecret() (secret string, hash string, err error) {
+	raw := make([]byte, 32)
+	if _, err = rand.Read(raw); err != nil {
+		return "", "", err
+	}
+	secret = base64.RawURLEncoding.EncodeToString(raw)
+	return secret, HashDeviceSecret(secret), nil
+}
+
+func HashDeviceSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// VerifyDevice returns the device when the secret matches and the device was not revoked
+func VerifyDevice(c context.Context, devices repository.DeviceRepository, deviceId string, secret string) (device models.Device, ok bool) {
+	device, err := devices.FindById(c, deviceId)
+	if err != nil || device.Revoked {
+		return device, false
+	}
+	if subtle.ConstantTimeCompare([]byte(device.Secret_hash), []byte(HashDeviceSecret(secret))) != 1 {
+		return device, false
+	}
+	return device, true
+}
+
+// deviceIsActive tells whether tokens issued on the device may still be used
+func deviceIsActive(c context.Context, devices repository.DeviceRepository, deviceId string) bool {
+	device, err := devices.FindById(c, deviceId)
+	return err == nil && !device.Revoked
+}
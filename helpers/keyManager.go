@@ -0,0 +1,266 @@
+package helpers
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/PranavMasekar/restaurant-management/config"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// SigningKey is one key tokens are signed or verified with.
+// Keys without a private part are only used to verify tokens issued before a rotation.
+type SigningKey struct {
+	Kid     string
+	Method  jwt.SigningMethod
+	Private interface{}
+	Public  interface{}
+}
+
+// KeyManager holds every key tokens may currently be verified with and the one new tokens are signed with.
+// Rotating keys means adding the new key, making it active and keeping the old one around
+// (its public part is enough) until the last token it signed has expired.
+type KeyManager struct {
+	mu sync.RWMutex
+	// kid of the key used for signing
+	active string
+	// kid assumed for tokens issued before tokens carried a kid header
+	legacy string
+	keys   map[string]*SigningKey
+}
+
+// JWK is the public part of a signing key as published in the JWKS document
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Crv string `json:"crv,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// Keys signs and verifies the tokens. It has no key until Configure loads the configured ones.
+var Keys *KeyManager = NewKeyManager()
+
+func NewKeyManager() *KeyManager {
+	return &KeyManager{keys: map[string]*SigningKey{}}
+}
+
+// Add registers a key for verification, replacing any key with the same kid
+func (m *KeyManager) Add(key *SigningKey) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.keys[key.Kid] = key
+}
+
+// Remove retires a key, tokens signed with it are rejected from now on
+func (m *KeyManager) Remove(kid string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if kid == m.active {
+		return fmt.Errorf("key %q is used for signing and cannot be removed", kid)
+	}
+	delete(m.keys, kid)
+	return nil
+}
+
+// SetActive selects the key new tokens are signed with
+func (m *KeyManager) SetActive(kid string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key, ok := m.keys[kid]
+	if !ok {
+		return fmt.Errorf("unknown key %q", kid)
+	}
+	if key.Private == nil {
+		return fmt.Errorf("key %q has no private key and cannot sign tokens", kid)
+	}
+	m.active = kid
+	return nil
+}
+
+// SetLegacy selects the key tokens without a kid header are verified with
+func (m *KeyManager) SetLegacy(kid string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.legacy = kid
+}
+
+// Sign signs the claims with the active key and names that key in the kid header
+func (m *KeyManager) Sign(claims jwt.Claims) (string, error) {
+	m.mu.RLock()
+	key, ok := m.keys[m.active]
+	m.mu.RUnlock()
+	if !ok {
+		return "", errors.New("no signing key configured")
+	}
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.Kid
+	return token.SignedString(key.Private)
+}
+
+// Keyfunc looks up the key a token was signed with, for use with jwt.Parse
+func (m *KeyManager) Keyfunc(token *jwt.Token) (interface{}, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		kid = m.legacy
+	}
+	key, ok := m.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	// Never let the token pick the algorithm, otherwise a public key could be used as an HMAC secret
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+	}
+	return key.Public, nil
+}
+
+// JWKS returns the public keys other services need to verify our tokens.
+// HMAC keys are secrets and are never published.
+func (m *KeyManager) JWKS() JWKS {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	set := JWKS{Keys: []JWK{}}
+	for _, key := range m.keys {
+		switch public := key.Public.(type) {
+		case *rsa.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				Kty: "RSA",
+				Kid: key.Kid,
+				Use: "sig",
+				Alg: key.Method.Alg(),
+				N:   base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				Kty: "OKP",
+				Kid: key.Kid,
+				Use: "sig",
+				Alg: key.Method.Alg(),
+				Crv: "Ed25519",
+				X:   base64.RawURLEncoding.EncodeToString(public),
+			})
+		}
+	}
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].Kid < set.Keys[j].Kid })
+	return set
+}
+
+// LoadKeys builds the key manager from the auth settings:
+//
+//	Secret_key    HS256 secret (SECRET_KEY), also used for tokens issued before kid headers existed
+//	Hmac_kid      kid of the Secret_key key (JWT_HMAC_KID), "hs256" by default
+//	Keys_dir      directory of PEM files named <kid>.pem holding RSA or Ed25519 keys (JWT_KEYS_DIR);
+//	              private keys sign and verify, public keys only verify
+//	Active_kid    kid of the key new tokens are signed with (JWT_ACTIVE_KID)
+func LoadKeys(cfg config.Auth) (*KeyManager, error) {
+	m := NewKeyManager()
+
+	if secret := cfg.Secret_key; secret != "" {
+		if len(secret) < config.MinSecretLength {
+			return nil, fmt.Errorf("SECRET_KEY must be at least %d bytes long", config.MinSecretLength)
+		}
+		kid := cfg.Hmac_kid
+		if kid == "" {
+			kid = "hs256"
+		}
+		m.Add(&SigningKey{Kid: kid, Method: jwt.SigningMethodHS256, Private: []byte(secret), Public: []byte(secret)})
+		m.SetLegacy(kid)
+	}
+
+	if dir := cfg.Keys_dir; dir != "" {
+		files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			data, err := ioutil.ReadFile(file)
+			if err != nil {
+				return nil, err
+			}
+			kid := strings.TrimSuffix(filepath.Base(file), ".pem")
+			key, err := ParseKey(kid, data)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", file, err)
+			}
+			m.Add(key)
+		}
+	}
+
+	active := cfg.Active_kid
+	if active == "" {
+		// Without an explicit choice there must be exactly one key able to sign
+		var signers []string
+		for kid, key := range m.keys {
+			if key.Private != nil {
+				signers = append(signers, kid)
+			}
+		}
+		if len(signers) != 1 {
+			return nil, errors.New("set SECRET_KEY or JWT_KEYS_DIR, and JWT_ACTIVE_KID when more than one signing key is available")
+		}
+		active = signers[0]
+	}
+	if err := m.SetActive(active); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// ParseKey reads a PEM encoded RSA or Ed25519 key, either private or public
+func ParseKey(kid string, data []byte) (*SigningKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		parsed, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch key := parsed.(type) {
+	case *rsa.PrivateKey:
+		return &SigningKey{Kid: kid, Method: jwt.SigningMethodRS256, Private: key, Public: &key.PublicKey}, nil
+	case *rsa.PublicKey:
+		return &SigningKey{Kid: kid, Method: jwt.SigningMethodRS256, Public: key}, nil
+	case ed25519.PrivateKey:
+		return &SigningKey{Kid: kid, Method: jwt.SigningMethodEdDSA, Private: key, Public: key.Public().(ed25519.PublicKey)}, nil
+	case ed25519.PublicKey:
+		return &SigningKey{Kid: kid, Method: jwt.SigningMethodEdDSA, Public: key}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %T", parsed)
+}
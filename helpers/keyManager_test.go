@@ -0,0 +1,227 @@
+package helpers
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PranavMasekar/restaurant-management/config"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+var hmacSecret = []byte(strings.Repeat("s", config.MinSecretLength))
+
+// newRSAKey generates a 2048 bit RSA key
+func newRSAKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// testKeys returns a manager with an HS256 key, also the legacy one, an RS256 and an EdDSA key
+func testKeys(t *testing.T) (*KeyManager, *rsa.PrivateKey, ed25519.PrivateKey) {
+	t.Helper()
+	rsaKey := newRSAKey(t)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := NewKeyManager()
+	m.Add(&SigningKey{Kid: "hs256", Method: jwt.SigningMethodHS256, Private: hmacSecret, Public: hmacSecret})
+	m.Add(&SigningKey{Kid: "rsa-1", Method: jwt.SigningMethodRS256, Private: rsaKey, Public: &rsaKey.PublicKey})
+	m.Add(&SigningKey{Kid: "ed-1", Method: jwt.SigningMethodEdDSA, Private: edKey, Public: edKey.Public()})
+	m.SetLegacy("hs256")
+	if err := m.SetActive("rsa-1"); err != nil {
+		t.Fatal(err)
+	}
+	return m, rsaKey, edKey
+}
+
+// signed signs claims valid for a minute with method and key, naming kid unless it is empty
+func signed(t *testing.T, method jwt.SigningMethod, key interface{}, kid string) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, jwt.StandardClaims{ExpiresAt: time.Now().Add(time.Minute).Unix()})
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	s, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestKeyfunc(t *testing.T) {
+	m, rsaKey, edKey := testKeys(t)
+	publicPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(&rsaKey.PublicKey)})
+
+	tests := []struct {
+		name  string
+		token string
+		valid bool
+	}{
+		{"HS256 under its kid", signed(t, jwt.SigningMethodHS256, hmacSecret, "hs256"), true},
+		{"HS256 without a kid falls back to the legacy key", signed(t, jwt.SigningMethodHS256, hmacSecret, ""), true},
+		{"RS256 under its kid", signed(t, jwt.SigningMethodRS256, rsaKey, "rsa-1"), true},
+		{"EdDSA under its kid", signed(t, jwt.SigningMethodEdDSA, edKey, "ed-1"), true},
+		{"RS256 token naming the HS256 key", signed(t, jwt.SigningMethodRS256, rsaKey, "hs256"), false},
+		{"RS256 token without a kid", signed(t, jwt.SigningMethodRS256, rsaKey, ""), false},
+		{"HS256 token naming the RSA key", signed(t, jwt.SigningMethodHS256, hmacSecret, "rsa-1"), false},
+		// The public key is no secret, it must not verify an HMAC
+		{"HS256 token keyed with the RSA public key", signed(t, jwt.SigningMethodHS256, publicPEM, "rsa-1"), false},
+		{"EdDSA token naming the RSA key", signed(t, jwt.SigningMethodEdDSA, edKey, "rsa-1"), false},
+		{"unknown kid", signed(t, jwt.SigningMethodHS256, hmacSecret, "hs512"), false},
+		{"HS256 signed with another secret", signed(t, jwt.SigningMethodHS256, []byte("another secret"), "hs256"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := jwt.Parse(tt.token, m.Keyfunc)
+			if (err == nil) != tt.valid {
+				t.Fatalf("Parse() = %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestKeyfuncWithoutLegacyKey(t *testing.T) {
+	m := NewKeyManager()
+	m.Add(&SigningKey{Kid: "hs256", Method: jwt.SigningMethodHS256, Private: hmacSecret, Public: hmacSecret})
+	if _, err := jwt.Parse(signed(t, jwt.SigningMethodHS256, hmacSecret, ""), m.Keyfunc); err == nil {
+		t.Fatal("a token without a kid was verified, want it refused when no legacy key is set")
+	}
+}
+
+func TestRotation(t *testing.T) {
+	m, _, _ := testKeys(t)
+	before, err := m.Sign(jwt.StandardClaims{ExpiresAt: time.Now().Add(time.Minute).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Rotate to the EdDSA key, the RSA one stays for the tokens it signed
+	if err := m.SetActive("ed-1"); err != nil {
+		t.Fatal(err)
+	}
+	after, err := m.Sign(jwt.StandardClaims{ExpiresAt: time.Now().Add(time.Minute).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		token, kid string
+	}{{before, "rsa-1"}, {after, "ed-1"}} {
+		token, err := jwt.Parse(tt.token, m.Keyfunc)
+		if err != nil {
+			t.Fatalf("token of %s not verified during the rotation: %v", tt.kid, err)
+		}
+		if token.Header["kid"] != tt.kid {
+			t.Fatalf("token signed by %v, want %s", token.Header["kid"], tt.kid)
+		}
+	}
+
+	if err := m.Remove("ed-1"); err == nil {
+		t.Fatal("the active key was removed")
+	}
+	if err := m.Remove("rsa-1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := jwt.Parse(before, m.Keyfunc); err == nil {
+		t.Fatal("a token of a retired key was verified")
+	}
+	if _, err := jwt.Parse(after, m.Keyfunc); err != nil {
+		t.Fatalf("token of the active key not verified: %v", err)
+	}
+
+	m.Add(&SigningKey{Kid: "rsa-public", Method: jwt.SigningMethodRS256, Public: &newRSAKey(t).PublicKey})
+	if err := m.SetActive("rsa-public"); err == nil {
+		t.Fatal("a public key was made the signing key")
+	}
+}
+
+func TestJWKSPublishesNoSecret(t *testing.T) {
+	m, _, _ := testKeys(t)
+	set := m.JWKS()
+	var kids []string
+	for _, key := range set.Keys {
+		if key.Kty == "oct" || key.Kid == "hs256" {
+			t.Fatalf("JWKS publishes the HMAC key %+v", key)
+		}
+		kids = append(kids, key.Kid+":"+key.Kty+":"+key.Alg)
+	}
+	if got := strings.Join(kids, ","); got != "ed-1:OKP:EdDSA,rsa-1:RSA:RS256" {
+		t.Fatalf("JWKS keys = %s", got)
+	}
+}
+
+func TestLoadKeys(t *testing.T) {
+	dir := t.TempDir()
+	private, err := x509.MarshalPKCS8PrivateKey(newRSAKey(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	public := x509.MarshalPKCS1PublicKey(&newRSAKey(t).PublicKey)
+	write := func(name string, block *pem.Block) string {
+		sub := filepath.Join(dir, name)
+		if err := os.Mkdir(sub, 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(sub, name+".pem"), pem.EncodeToMemory(block), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return sub
+	}
+	privateDir := write("rsa-2", &pem.Block{Type: "PRIVATE KEY", Bytes: private})
+	publicDir := write("rsa-1", &pem.Block{Type: "RSA PUBLIC KEY", Bytes: public})
+	secret := string(hmacSecret)
+
+	tests := []struct {
+		name    string
+		auth    config.Auth
+		active  string
+		problem string
+	}{
+		{"secret only", config.Auth{Secret_key: secret}, "hs256", ""},
+		{"secret under its own kid", config.Auth{Secret_key: secret, Hmac_kid: "legacy"}, "legacy", ""},
+		{"secret too short", config.Auth{Secret_key: "short"}, "", "at least"},
+		{"private key only", config.Auth{Keys_dir: privateDir}, "rsa-2", ""},
+		{"secret and a public key", config.Auth{Secret_key: secret, Keys_dir: publicDir}, "hs256", ""},
+		{"two signers and no choice", config.Auth{Secret_key: secret, Keys_dir: privateDir}, "", "JWT_ACTIVE_KID"},
+		{"two signers and a choice", config.Auth{Secret_key: secret, Keys_dir: privateDir, Active_kid: "rsa-2"}, "rsa-2", ""},
+		{"public key chosen to sign", config.Auth{Secret_key: secret, Keys_dir: publicDir, Active_kid: "rsa-1"}, "", "no private key"},
+		{"unknown key chosen", config.Auth{Secret_key: secret, Active_kid: "rsa-9"}, "", "unknown key"},
+		{"no key", config.Auth{}, "", "SECRET_KEY"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := LoadKeys(tt.auth)
+			if tt.problem != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.problem) {
+					t.Fatalf("LoadKeys() = %v, want an error containing %q", err, tt.problem)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			token, err := m.Sign(jwt.StandardClaims{ExpiresAt: time.Now().Add(time.Minute).Unix()})
+			if err != nil {
+				t.Fatal(err)
+			}
+			parsed, err := jwt.Parse(token, m.Keyfunc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if parsed.Header["kid"] != tt.active {
+				t.Fatalf("token signed by %v, want %s", parsed.Header["kid"], tt.active)
+			}
+		})
+	}
+}
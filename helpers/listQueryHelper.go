@@ -0,0 +1,197 @@
+package helpers
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PranavMasekar/restaurant-management/repository"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// FieldKind tells how the query string value of a filter is converted before it reaches MongoDB
+type FieldKind int
+
+const (
+	StringField FieldKind = iota
+	NumberField
+	BoolField
+	TimeField
+	// MoneyField filters and sorts on the amount of a money.Money, compared as a decimal
+	MoneyField
+)
+
+// ListSpec whitelists what the clients of a list endpoint can filter, sort and select.
+// Anything not listed is rejected, so the query string never reaches MongoDB as is.
+// Keyset lists are paginated with cursors on created_at and _id and can only be sorted by created_at.
+type ListSpec struct {
+	Filters      map[string]FieldKind
+	Sorts        []string
+	Fields       []string
+	Id_field     string
+	Default_sort string
+	Keyset       bool
+}
+
+// Operators of ?filter[field][op]=value, a plain ?filter[field]=value is eq
+var filterOperators = map[string]string{
+	"eq":  "$eq",
+	"ne":  "$ne",
+	"gt":  "$gt",
+	"gte": "$gte",
+	"lt":  "$lt",
+	"lte": "$lte",
+	"in":  "$in",
+}
+
+var filterParam = regexp.MustCompile(`^filter\[(\w+)\](?:\[(\w+)\])?$`)
+
+// ParseListQuery turns ?filter[menu_id]=..&sort=-created_at&fields=name,price&limit=&cursor=
+// into the query and the page a list endpoint has to fetch
+func ParseListQuery(ctx *gin.Context, spec ListSpec) (repository.ListQuery, repository.Pagination, error) {
+	var query repository.ListQuery
+	pagination, err := PaginationFromQuery(ctx, spec.Keyset)
+	if err != nil {
+		return query, pagination, err
+	}
+	if query.Filter, err = spec.filter(ctx); err != nil {
+		return query, pagination, err
+	}
+	if query.Sort, err = SortFromQuery(ctx.DefaultQuery("sort", spec.Default_sort), spec.Sorts...); err != nil {
+		return query, pagination, err
+	}
+	for i := range query.Sort {
+		query.Sort[i].Key = spec.path(query.Sort[i].Key)
+	}
+	if query.Projection, err = spec.projection(ctx.Query("fields")); err != nil {
+		return query, pagination, err
+	}
+	return query, pagination, nil
+}
+
+func (spec ListSpec) filter(ctx *gin.Context) (bson.D, error) {
+	conditions := map[string]bson.D{}
+	for param, values := range ctx.Request.URL.Query() {
+		match := filterParam.FindStringSubmatch(param)
+		if match == nil {
+			if strings.HasPrefix(param, "filter") {
+				return nil, fmt.Errorf("malformed filter %q", param)
+			}
+			continue
+		}
+		field, op := match[1], match[2]
+		kind, ok := spec.Filters[field]
+		if !ok {
+			return nil, fmt.Errorf("cannot filter by %q", field)
+		}
+		if op == "" {
+			op = "eq"
+		}
+		operator, ok := filterOperators[op]
+		if !ok {
+			return nil, fmt.Errorf("unknown filter operator %q", op)
+		}
+
+		var value interface{}
+		var err error
+		if op == "in" {
+			var list bson.A
+			for _, item := range strings.Split(values[0], ",") {
+				converted, err := filterValue(kind, item)
+				if err != nil {
+					return nil, fmt.Errorf("filter[%s]: %v", field, err)
+				}
+				list = append(list, converted)
+			}
+			value = list
+		} else if value, err = filterValue(kind, values[0]); err != nil {
+			return nil, fmt.Errorf("filter[%s]: %v", field, err)
+		}
+		conditions[field] = append(conditions[field], bson.E{Key: operator, Value: value})
+	}
+
+	// Keep the generated query stable whatever the order of the parameters
+	fields := make([]string, 0, len(conditions))
+	for field := range conditions {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	filter := bson.D{}
+	for _, field := range fields {
+		filter = append(filter, bson.E{Key: spec.path(field), Value: conditions[field]})
+	}
+	return filter, nil
+}
+
+// path is where the value of field is stored, money fields are documents holding an amount
+func (spec ListSpec) path(field string) string {
+	if spec.Filters[field] == MoneyField {
+		return field + ".amount"
+	}
+	return field
+}
+
+func filterValue(kind FieldKind, value string) (interface{}, error) {
+	switch kind {
+	case NumberField:
+		number, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a number", value)
+		}
+		return number, nil
+	case BoolField:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a boolean", value)
+		}
+		return b, nil
+	case MoneyField:
+		amount, err := primitive.ParseDecimal128(value)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an amount", value)
+		}
+		return amount, nil
+	case TimeField:
+		at, err := ParseQueryTime(value)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a RFC 3339 time or a 2006-01-02 date", value)
+		}
+		return at, nil
+	}
+	return value, nil
+}
+
+// projection keeps only the requested fields, the id field of the resource is always returned
+func (spec ListSpec) projection(fields string) (bson.D, error) {
+	if fields == "" {
+		return nil, nil
+	}
+	projection := bson.D{}
+	if spec.Id_field != "" {
+		projection = append(projection, bson.E{Key: spec.Id_field, Value: 1})
+	}
+	for _, field := range strings.Split(fields, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" || field == spec.Id_field {
+			continue
+		}
+		if !containsField(spec.Fields, field) {
+			return nil, fmt.Errorf("cannot select field %q", field)
+		}
+		projection = append(projection, bson.E{Key: field, Value: 1})
+	}
+	return projection, nil
+}
+
+// ParseQueryTime accepts a RFC 3339 time or a bare 2006-01-02 date
+func ParseQueryTime(value string) (time.Time, error) {
+	if at, err := time.Parse(time.RFC3339, value); err == nil {
+		return at, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
@@ -0,0 +1,104 @@
+package helpers
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+var testListSpec = ListSpec{
+	Filters: map[string]FieldKind{
+		"name":       StringField,
+		"price":      MoneyField,
+		"in_stock":   BoolField,
+		"guests":     NumberField,
+		"created_at": TimeField,
+	},
+	Sorts:        []string{"name", "price"},
+	Fields:       []string{"name", "price"},
+	Id_field:     "food_id",
+	Default_sort: "name",
+}
+
+func listContext(query string) *gin.Context {
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest("GET", "/foods?"+query, nil)
+	return ctx
+}
+
+func TestParseListQuery(t *testing.T) {
+	price, _ := primitive.ParseDecimal128("12.5")
+	tests := []struct {
+		name       string
+		query      string
+		filter     bson.D
+		sort       bson.D
+		projection bson.D
+	}{
+		{"defaults", "", bson.D{}, bson.D{{Key: "name", Value: 1}, {Key: "_id", Value: 1}}, nil},
+		{"plain filter is eq", "filter[name]=Soup", bson.D{{Key: "name", Value: bson.D{{Key: "$eq", Value: "Soup"}}}}, nil, nil},
+		{"money filters compare the amount", "filter[price][lte]=12.5",
+			bson.D{{Key: "price.amount", Value: bson.D{{Key: "$lte", Value: price}}}}, nil, nil},
+		{"in splits the list", "filter[guests][in]=2,4",
+			bson.D{{Key: "guests", Value: bson.D{{Key: "$in", Value: bson.A{2.0, 4.0}}}}}, nil, nil},
+		{"filters are sorted by field", "filter[name][ne]=Soup&filter[in_stock]=true", bson.D{
+			{Key: "in_stock", Value: bson.D{{Key: "$eq", Value: true}}},
+			{Key: "name", Value: bson.D{{Key: "$ne", Value: "Soup"}}},
+		}, nil, nil},
+		{"money sorts on the amount", "sort=-price", bson.D{}, bson.D{{Key: "price.amount", Value: -1}, {Key: "_id", Value: 1}}, nil},
+		{"the id field is always selected", "fields=price", bson.D{}, nil, bson.D{{Key: "food_id", Value: 1}, {Key: "price", Value: 1}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, _, err := ParseListQuery(listContext(tt.query), testListSpec)
+			if err != nil {
+				t.Fatalf("ParseListQuery(%q) failed: %v", tt.query, err)
+			}
+			if !reflect.DeepEqual(query.Filter, tt.filter) {
+				t.Errorf("filter = %v, want %v", query.Filter, tt.filter)
+			}
+			if tt.sort != nil && !reflect.DeepEqual(query.Sort, tt.sort) {
+				t.Errorf("sort = %v, want %v", query.Sort, tt.sort)
+			}
+			if !reflect.DeepEqual(query.Projection, tt.projection) {
+				t.Errorf("projection = %v, want %v", query.Projection, tt.projection)
+			}
+		})
+	}
+}
+
+func TestParseListQueryRejects(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		error string
+	}{
+		{"field not whitelisted", "filter[password]=x", `cannot filter by "password"`},
+		{"operator injection", "filter[name][$where]=1", "malformed filter"},
+		{"unknown operator", "filter[name][regex]=.*", `unknown filter operator "regex"`},
+		{"nested field", "filter[name.first]=x", "malformed filter"},
+		{"not a number", "filter[guests][gt]=many", "is not a number"},
+		{"not a boolean", "filter[in_stock]=maybe", "is not a boolean"},
+		{"not an amount", "filter[price]=cheap", "is not an amount"},
+		{"not a time", "filter[created_at][gte]=yesterday", "is not a RFC 3339 time"},
+		{"sort not whitelisted", "sort=password", `cannot sort by "password"`},
+		{"field not selectable", "fields=name,password", `cannot select field "password"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := ParseListQuery(listContext(tt.query), testListSpec)
+			if err == nil || !strings.Contains(err.Error(), tt.error) {
+				t.Fatalf("ParseListQuery(%q) = %v, want an error containing %q", tt.query, err, tt.error)
+			}
+		})
+	}
+}
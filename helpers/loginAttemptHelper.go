@@ -0,0 +1,115 @@
+package helpers
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/PranavMasekar/restaurant-management/repository"
+)
+
+// Login throttling: an email is locked after maxEmailFailures failures within failureWindow, a client IP
+// after maxIPFailures. Each lockout lasts twice as long as the previous one, from baseLockout up to maxLockout.
+const (
+	maxEmailFailures = 5
+	maxIPFailures    = 20
+	failureWindow    = 15 * time.Minute
+	baseLockout      = time.Minute
+	maxLockout       = time.Hour
+)
+
+// Password reset requests are throttled the same way, each one counting as a failure: an email
+// after maxResetEmailRequests requests within failureWindow, a client IP after maxResetIPRequests.
+const (
+	maxResetEmailRequests = 3
+	maxResetIPRequests    = 10
+)
+
+func EmailAttemptKey(email string) string {
+	return "email:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func IPAttemptKey(ip string) string {
+	return "ip:" + ip
+}
+
+// LoginLockedUntil returns until when logins for the email or from the IP are refused,
+// or the zero time when neither is locked
+func LoginLockedUntil(c context.Context, attempts repository.LoginAttemptRepository, email string, ip string) (time.Time, error) {
+	return lockedUntil(c, attempts, EmailAttemptKey(email), IPAttemptKey(ip))
+}
+
+// RecordLoginFailure counts a failed login against both the email and the IP,
+// an empty email only counts against the IP
+func RecordLoginFailure(c context.Context, attempts repository.LoginAttemptRepository, email string, ip string) error {
+	if email != "" {
+		if err := recordFailure(c, attempts, EmailAttemptKey(email), maxEmailFailures); err != nil {
+			return err
+		}
+	}
+	return recordFailure(c, attempts, IPAttemptKey(ip), maxIPFailures)
+}
+
+// RecordLoginSuccess forgets the failures of the email. The IP keeps its count,
+// one valid account must not let an attacker keep guessing the others.
+func RecordLoginSuccess(c context.Context, attempts repository.LoginAttemptRepository, email string) error {
+	return attempts.Delete(c, EmailAttemptKey(email))
+}
+
+// resetKey keeps the counts of the reset requests apart from those of the failed logins
+func resetKey(key string) string {
+	return "reset:" + key
+}
+
+// ResetLockedUntil returns until when password reset requests for the email or from the IP
+// are refused, or the zero time when neither is locked
+func ResetLockedUntil(c context.Context, attempts repository.LoginAttemptRepository, email string, ip string) (time.Time, error) {
+	return lockedUntil(c, attempts, resetKey(EmailAttemptKey(email)), resetKey(IPAttemptKey(ip)))
+}
+
+// RecordResetRequest counts a password reset request against both the email and the IP, whether
+// or not the email is registered
+func RecordResetRequest(c context.Context, attempts repository.LoginAttemptRepository, email string, ip string) error {
+	if err := recordFailure(c, attempts, resetKey(EmailAttemptKey(email)), maxResetEmailRequests); err != nil {
+		return err
+	}
+	return recordFailure(c, attempts, resetKey(IPAttemptKey(ip)), maxResetIPRequests)
+}
+
+func lockedUntil(c context.Context, attempts repository.LoginAttemptRepository, keys ...string) (time.Time, error) {
+	var until time.Time
+	locked, err := attempts.Locked(c, keys, time.Now())
+	if err != nil {
+		return until, err
+	}
+	for _, attempt := range locked {
+		if attempt.Locked_until.After(until) {
+			until = *attempt.Locked_until
+		}
+	}
+	return until, nil
+}
+
+func recordFailure(c context.Context, attempts repository.LoginAttemptRepository, key string, maxFailures int) error {
+	now := time.Now()
+	attempt, err := attempts.RecordFailure(c, key, now, failureWindow)
+	if err != nil {
+		return err
+	}
+	if attempt.Failures < maxFailures {
+		return nil
+	}
+	return attempts.Lock(c, key, now.Add(lockoutDuration(attempt.Lockouts)))
+}
+
+// lockoutDuration doubles with every earlier lockout
+func lockoutDuration(lockouts int) time.Duration {
+	duration := baseLockout
+	for i := 0; i < lockouts && duration < maxLockout; i++ {
+		duration *= 2
+	}
+	if duration > maxLockout {
+		duration = maxLockout
+	}
+	return duration
+}
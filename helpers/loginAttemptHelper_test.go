@@ -0,0 +1,149 @@
+package helpers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/PranavMasekar/restaurant-management/repository"
+)
+
+func TestLockoutDuration(t *testing.T) {
+	tests := []struct {
+		lockouts int
+		want     time.Duration
+	}{
+		{0, time.Minute},
+		{1, 2 * time.Minute},
+		{2, 4 * time.Minute},
+		{5, 32 * time.Minute},
+		{6, time.Hour},
+		{50, time.Hour},
+	}
+	for _, tt := range tests {
+		if got := lockoutDuration(tt.lockouts); got != tt.want {
+			t.Fatalf("lockoutDuration(%d) = %v, want %v", tt.lockouts, got, tt.want)
+		}
+	}
+}
+
+func TestLoginLockouts(t *testing.T) {
+	c := context.Background()
+	const email, ip = "Ann@Example.com", "203.0.113.7"
+	tests := []struct {
+		name string
+		// earlier are failures of the email and the IP recorded that long ago
+		earlier  time.Duration
+		failures []string
+		locked   time.Duration
+	}{
+		{"fewer failures than the email allows", 0, repeat(email, maxEmailFailures-1), 0},
+		{"the email is locked a minute", 0, repeat(email, maxEmailFailures), baseLockout},
+		{"the email is case insensitive", 0, append(repeat(email, maxEmailFailures-1), " ann@example.COM "), baseLockout},
+		{"failures of other emails from the IP", 0, distinct(maxIPFailures - 1), 0},
+		{"the IP is locked after its failures", 0, distinct(maxIPFailures), baseLockout},
+		{"failures outside the window are forgotten", failureWindow + time.Minute, repeat(email, 1), 0},
+		{"failures inside the window count", failureWindow - time.Minute, repeat(email, 1), baseLockout},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := repository.NewMemoryRepositories().LoginAttempts
+			if tt.earlier > 0 {
+				for i := 0; i < maxEmailFailures-1; i++ {
+					if _, err := attempts.RecordFailure(c, EmailAttemptKey(email), time.Now().Add(-tt.earlier), failureWindow); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			for _, failed := range tt.failures {
+				if err := RecordLoginFailure(c, attempts, failed, ip); err != nil {
+					t.Fatal(err)
+				}
+			}
+			until, err := LoginLockedUntil(c, attempts, email, ip)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.locked == 0 && !until.IsZero() {
+				t.Fatalf("locked until %v, want unlocked", until)
+			}
+			if wait := time.Until(until); tt.locked > 0 && (wait > tt.locked || wait < tt.locked-time.Second) {
+				t.Fatalf("locked for %v, want %v", wait, tt.locked)
+			}
+		})
+	}
+}
+
+func TestLockoutsDoubleUntilAnHour(t *testing.T) {
+	c := context.Background()
+	attempts := repository.NewMemoryRepositories().LoginAttempts
+	key := EmailAttemptKey("ann@example.com")
+	for i, want := range []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 8 * time.Minute, 16 * time.Minute, 32 * time.Minute, time.Hour, time.Hour} {
+		for j := 0; j < maxEmailFailures; j++ {
+			if err := recordFailure(c, attempts, key, maxEmailFailures); err != nil {
+				t.Fatal(err)
+			}
+		}
+		attempt, err := attempts.FindByKey(c, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if wait := time.Until(*attempt.Locked_until); wait > want || wait < want-time.Second {
+			t.Fatalf("lockout %d lasts %v, want %v", i+1, wait, want)
+		}
+	}
+}
+
+func TestLoginSuccessClearsTheEmailOnly(t *testing.T) {
+	c := context.Background()
+	attempts := repository.NewMemoryRepositories().LoginAttempts
+	const email, ip = "ann@example.com", "203.0.113.7"
+	for i := 0; i < maxEmailFailures-1; i++ {
+		if err := RecordLoginFailure(c, attempts, email, ip); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := RecordLoginSuccess(c, attempts, email); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := attempts.FindByKey(c, EmailAttemptKey(email)); err != repository.ErrNotFound {
+		t.Fatalf("failures of the email kept after a login (%v)", err)
+	}
+	if attempt, err := attempts.FindByKey(c, IPAttemptKey(ip)); err != nil || attempt.Failures != maxEmailFailures-1 {
+		t.Fatalf("IP has %d failures (%v), want %d", attempt.Failures, err, maxEmailFailures-1)
+	}
+}
+
+func TestExpiredLockIsLifted(t *testing.T) {
+	c := context.Background()
+	attempts := repository.NewMemoryRepositories().LoginAttempts
+	key := EmailAttemptKey("ann@example.com")
+	if _, err := attempts.RecordFailure(c, key, time.Now(), failureWindow); err != nil {
+		t.Fatal(err)
+	}
+	if err := attempts.Lock(c, key, time.Now().Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if until, err := LoginLockedUntil(c, attempts, "ann@example.com", "203.0.113.7"); err != nil || !until.IsZero() {
+		t.Fatalf("locked until %v (%v), want unlocked", until, err)
+	}
+}
+
+// repeat returns the email n times
+func repeat(email string, n int) []string {
+	emails := make([]string, n)
+	for i := range emails {
+		emails[i] = email
+	}
+	return emails
+}
+
+// distinct returns n different emails, none of them reaching its own limit
+func distinct(n int) []string {
+	emails := make([]string, n)
+	for i := range emails {
+		emails[i] = fmt.Sprintf("guest%d@example.com", i)
+	}
+	return emails
+}
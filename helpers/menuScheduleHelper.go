@@ -0,0 +1,92 @@
+package helpers
+
+import (
+	"time"
+
+	"github.com/PranavMasekar/restaurant-management/models"
+)
+
+// Layout of the start and end times of the menu schedules
+const ClockLayout = "15:04"
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// ParseClock returns the minutes since midnight of a time of day like 07:30
+func ParseClock(value string) (int, error) {
+	clock, err := time.Parse(ClockLayout, value)
+	if err != nil {
+		return 0, err
+	}
+	return clock.Hour()*60 + clock.Minute(), nil
+}
+
+// MenuLocation is the timezone the dates and the schedule of menu are evaluated in
+func MenuLocation(menu models.Menu) *time.Location {
+	if menu.Timezone == nil || *menu.Timezone == "" {
+		return time.UTC
+	}
+	location, err := time.LoadLocation(*menu.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return location
+}
+
+// MenuActiveAt tells whether menu can be ordered from at the instant at: between its start and
+// end dates, and within one of the windows of its schedule when it has one
+func MenuActiveAt(menu models.Menu, at time.Time) bool {
+	if menu.Start_Date != nil && at.Before(*menu.Start_Date) {
+		return false
+	}
+	if menu.End_Date != nil && !at.Before(*menu.End_Date) {
+		return false
+	}
+	if len(menu.Schedule) == 0 {
+		return true
+	}
+	local := at.In(MenuLocation(menu))
+	for _, window := range menu.Schedule {
+		if inWindow(window, local) {
+			return true
+		}
+	}
+	return false
+}
+
+// inWindow tells whether the local time falls in window. The part of an overnight window
+// after midnight belongs to the day it started on.
+func inWindow(window models.MenuSchedule, local time.Time) bool {
+	start, err := ParseClock(window.Start_time)
+	if err != nil {
+		return false
+	}
+	end, err := ParseClock(window.End_time)
+	if err != nil {
+		return false
+	}
+	minute := local.Hour()*60 + local.Minute()
+	if start < end {
+		return onDay(window, local.Weekday()) && minute >= start && minute < end
+	}
+	if minute >= start {
+		return onDay(window, local.Weekday())
+	}
+	return minute < end && onDay(window, local.AddDate(0, 0, -1).Weekday())
+}
+
+func onDay(window models.MenuSchedule, day time.Weekday) bool {
+	for _, name := range window.Days {
+		if weekday, ok := weekdays[name]; ok && weekday == day {
+			return true
+		}
+	}
+	return false
+}
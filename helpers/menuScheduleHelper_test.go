@@ -0,0 +1,75 @@
+package helpers
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/PranavMasekar/restaurant-management/models"
+)
+
+func TestMenuActiveAt(t *testing.T) {
+	paris := "Europe/Paris"
+	utc := func(value string) time.Time {
+		at, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return at
+	}
+	start, end := utc("2024-03-01T00:00:00Z"), utc("2024-04-01T00:00:00Z")
+	breakfast := models.MenuSchedule{Days: []string{"mon", "tue", "wed", "thu", "fri"}, Start_time: "07:00", End_time: "11:00"}
+	lateNight := models.MenuSchedule{Days: []string{"fri", "sat"}, Start_time: "22:00", End_time: "02:00"}
+	sunday := models.MenuSchedule{Days: []string{"sun"}, Start_time: "07:00", End_time: "11:00"}
+
+	tests := []struct {
+		name string
+		menu models.Menu
+		at   string
+		want bool
+	}{
+		{"no dates nor schedule", models.Menu{}, "2024-03-15T03:00:00Z", true},
+		{"before the start date", models.Menu{Start_Date: &start}, "2024-02-29T23:59:59Z", false},
+		{"on the start date", models.Menu{Start_Date: &start}, "2024-03-01T00:00:00Z", true},
+		{"the end date is excluded", models.Menu{End_Date: &end}, "2024-04-01T00:00:00Z", false},
+		{"just before the end date", models.Menu{End_Date: &end}, "2024-03-31T23:59:59Z", true},
+
+		// 2024-03-15 is a Friday, 2024-03-16 a Saturday
+		{"weekday in the window", models.Menu{Schedule: []models.MenuSchedule{breakfast}}, "2024-03-15T07:00:00Z", true},
+		{"the end time is excluded", models.Menu{Schedule: []models.MenuSchedule{breakfast}}, "2024-03-15T11:00:00Z", false},
+		{"weekday out of the set", models.Menu{Schedule: []models.MenuSchedule{breakfast}}, "2024-03-16T08:00:00Z", false},
+		{"any of the windows", models.Menu{Schedule: []models.MenuSchedule{breakfast, lateNight}}, "2024-03-16T23:00:00Z", true},
+		{"schedule and dates both apply", models.Menu{End_Date: &start, Schedule: []models.MenuSchedule{breakfast}}, "2024-03-15T08:00:00Z", false},
+
+		{"overnight window before midnight", models.Menu{Schedule: []models.MenuSchedule{lateNight}}, "2024-03-15T23:30:00Z", true},
+		{"overnight window after midnight belongs to the day before", models.Menu{Schedule: []models.MenuSchedule{lateNight}}, "2024-03-16T01:30:00Z", true},
+		{"overnight window ends", models.Menu{Schedule: []models.MenuSchedule{lateNight}}, "2024-03-16T02:00:00Z", false},
+		{"after midnight of a day out of the set", models.Menu{Schedule: []models.MenuSchedule{lateNight}}, "2024-03-15T01:30:00Z", false},
+		{"sunday morning after a saturday night", models.Menu{Schedule: []models.MenuSchedule{lateNight}}, "2024-03-17T01:00:00Z", true},
+
+		// Paris moves from UTC+1 to UTC+2 on 2024-03-31 at 02:00
+		{"timezone before the DST change", models.Menu{Timezone: &paris, Schedule: []models.MenuSchedule{sunday}}, "2024-03-24T06:30:00Z", true},
+		{"same UTC time after the DST change", models.Menu{Timezone: &paris, Schedule: []models.MenuSchedule{sunday}}, "2024-03-31T06:30:00Z", true},
+		{"opening before the DST change", models.Menu{Timezone: &paris, Schedule: []models.MenuSchedule{sunday}}, "2024-03-24T05:30:00Z", false},
+		{"opening after the DST change", models.Menu{Timezone: &paris, Schedule: []models.MenuSchedule{sunday}}, "2024-03-31T05:30:00Z", true},
+		{"closing after the DST change", models.Menu{Timezone: &paris, Schedule: []models.MenuSchedule{sunday}}, "2024-03-31T09:00:00Z", false},
+		{"overnight window on the night of the DST change", models.Menu{Timezone: &paris, Schedule: []models.MenuSchedule{lateNight}}, "2024-03-31T00:30:00Z", true},
+		{"overnight window closes when 02:00 is skipped", models.Menu{Timezone: &paris, Schedule: []models.MenuSchedule{lateNight}}, "2024-03-31T01:00:00Z", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MenuActiveAt(tt.menu, utc(tt.at)); got != tt.want {
+				t.Fatalf("MenuActiveAt(%s) = %v, want %v", tt.at, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMenuLocationFallsBackToUTC(t *testing.T) {
+	for _, timezone := range []string{"", "Mars/Olympus_Mons"} {
+		zone := timezone
+		if got := MenuLocation(models.Menu{Timezone: &zone}); got != time.UTC {
+			t.Fatalf("MenuLocation(%q) = %v, want UTC", timezone, got)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package helpers
+
+import (
+	"fmt"
+
+	"github.com/PranavMasekar/restaurant-management/models"
+	"github.com/PranavMasekar/restaurant-management/money"
+)
+
+// SelectionBounds is how many options of group an order item has to pick, at least and at most
+func SelectionBounds(group models.ModifierGroup) (int, int) {
+	least, most := group.Min_selections, group.Max_selections
+	if group.Required && least < 1 {
+		least = 1
+	}
+	if most == 0 || most > len(group.Options) {
+		most = len(group.Options)
+	}
+	return least, most
+}
+
+// ModifierGroupsProblem checks what the validator cannot of the modifier groups of a food priced
+// in currency. It returns the rejected field and why, "" when the groups are fine.
+func ModifierGroupsProblem(groups []models.ModifierGroup, currency string) (string, string) {
+	groupIds := map[string]bool{}
+	for i, group := range groups {
+		field := fmt.Sprintf("modifier_groups[%d]", i)
+		if groupIds[group.Group_id] {
+			return field + ".group_id", "is used by another group"
+		}
+		groupIds[group.Group_id] = true
+
+		if group.Max_selections > 0 && group.Min_selections > group.Max_selections {
+			return field + ".min_selections", "must be at most max_selections"
+		}
+		if least, _ := SelectionBounds(group); least > len(group.Options) {
+			return field + ".min_selections", "must be at most the number of options"
+		}
+
+		optionIds := map[string]bool{}
+		for j, option := range group.Options {
+			optionField := fmt.Sprintf("%s.options[%d]", field, j)
+			if optionIds[option.Option_id] {
+				return optionField + ".option_id", "is used by another option of the group"
+			}
+			optionIds[option.Option_id] = true
+			// The delta is added to the price of the food
+			if option.Price_delta != nil && option.Price_delta.Currency != currency {
+				return optionField + ".price_delta", "must be in " + currency + ", the currency of the food"
+			}
+		}
+	}
+	return "", ""
+}
+
+// SelectModifiers checks the modifiers picked for an order item of food against its groups and
+// copies their names and prices. It returns why the selection is refused, "" when it is valid.
+func SelectModifiers(food models.Food, picked []models.SelectedModifier) ([]models.SelectedModifier, string) {
+	selected := []models.SelectedModifier{}
+	counts := map[string]int{}
+	seen := map[string]bool{}
+	for _, pick := range picked {
+		group := findGroup(food, pick.Group_id)
+		if group == nil {
+			return nil, fmt.Sprintf("%q is not a modifier group of this food", pick.Group_id)
+		}
+		option := findOption(*group, pick.Option_id)
+		if option == nil {
+			return nil, fmt.Sprintf("%q is not an option of %s", pick.Option_id, group.Name)
+		}
+		if seen[group.Group_id+"/"+option.Option_id] {
+			return nil, fmt.Sprintf("%s is picked more than once", option.Name)
+		}
+		seen[group.Group_id+"/"+option.Option_id] = true
+		counts[group.Group_id]++
+
+		// A free option stored with a null delta is read back as the zero Money, without a currency
+		delta := money.New(0, food.Price.Currency)
+		if option.Price_delta != nil && option.Price_delta.Currency != "" {
+			delta = *option.Price_delta
+		}
+		selected = append(selected, models.SelectedModifier{
+			Group_id:    group.Group_id,
+			Option_id:   option.Option_id,
+			Group_name:  group.Name,
+			Name:        option.Name,
+			Price_delta: delta,
+		})
+	}
+
+	for _, group := range food.Modifier_groups {
+		least, most := SelectionBounds(group)
+		if counts[group.Group_id] < least {
+			return nil, fmt.Sprintf("pick at least %d of %s", least, group.Name)
+		}
+		if counts[group.Group_id] > most {
+			return nil, fmt.Sprintf("pick at most %d of %s", most, group.Name)
+		}
+	}
+	return selected, ""
+}
+
+func findGroup(food models.Food, groupId string) *models.ModifierGroup {
+	for i := range food.Modifier_groups {
+		if food.Modifier_groups[i].Group_id == groupId {
+			return &food.Modifier_groups[i]
+		}
+	}
+	return nil
+}
+
+func findOption(group models.ModifierGroup, optionId string) *models.ModifierOption {
+	for i := range group.Options {
+		if group.Options[i].Option_id == optionId {
+			return &group.Options[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package helpers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/PranavMasekar/restaurant-management/models"
+	"github.com/PranavMasekar/restaurant-management/money"
+)
+
+func TestSelectionBounds(t *testing.T) {
+	options := []models.ModifierOption{{Option_id: "a"}, {Option_id: "b"}, {Option_id: "c"}}
+	tests := []struct {
+		name        string
+		group       models.ModifierGroup
+		least, most int
+	}{
+		{"optional, any number", models.ModifierGroup{Options: options}, 0, 3},
+		{"required picks at least one", models.ModifierGroup{Required: true, Options: options}, 1, 3},
+		{"required keeps a higher minimum", models.ModifierGroup{Required: true, Min_selections: 2, Options: options}, 2, 3},
+		{"maximum", models.ModifierGroup{Max_selections: 1, Options: options}, 0, 1},
+		{"maximum above the options", models.ModifierGroup{Max_selections: 5, Options: options}, 0, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if least, most := SelectionBounds(tt.group); least != tt.least || most != tt.most {
+				t.Fatalf("SelectionBounds = %d, %d, want %d, %d", least, most, tt.least, tt.most)
+			}
+		})
+	}
+}
+
+func TestSelectModifiers(t *testing.T) {
+	usd := func(minor int64) *money.Money {
+		m := money.New(minor, "USD")
+		return &m
+	}
+	price := money.New(1000, "USD")
+	food := models.Food{Price: &price, Modifier_groups: []models.ModifierGroup{
+		{Group_id: "size", Name: "Size", Required: true, Max_selections: 1, Options: []models.ModifierOption{
+			{Option_id: "regular", Name: "Regular"},
+			{Option_id: "large", Name: "Large", Price_delta: usd(150)},
+		}},
+		{Group_id: "extras", Name: "Extras", Max_selections: 2, Options: []models.ModifierOption{
+			{Option_id: "cheese", Name: "Cheese", Price_delta: usd(50)},
+			{Option_id: "bacon", Name: "Bacon", Price_delta: usd(100)},
+			{Option_id: "egg", Name: "Egg", Price_delta: usd(80)},
+		}},
+		{Group_id: "remove", Name: "Remove", Options: []models.ModifierOption{
+			{Option_id: "onion", Name: "No onion", Price_delta: usd(-20)},
+			// A free option stored with a null delta
+			{Option_id: "pickles", Name: "No pickles", Price_delta: &money.Money{}},
+		}},
+	}}
+	pick := func(pairs ...string) []models.SelectedModifier {
+		var picked []models.SelectedModifier
+		for i := 0; i < len(pairs); i += 2 {
+			picked = append(picked, models.SelectedModifier{Group_id: pairs[i], Option_id: pairs[i+1], Name: "sent by the client"})
+		}
+		return picked
+	}
+
+	tests := []struct {
+		name    string
+		picked  []models.SelectedModifier
+		deltas  []int64
+		problem string
+	}{
+		{"required group only", pick("size", "regular"), []int64{0}, ""},
+		{"options of several groups", pick("size", "large", "extras", "cheese", "extras", "bacon", "remove", "onion"), []int64{150, 50, 100, -20}, ""},
+		{"free option stored with a null delta", pick("size", "regular", "remove", "pickles"), []int64{0, 0}, ""},
+		{"required group left out", pick("extras", "cheese"), nil, "pick at least 1 of Size"},
+		{"nothing picked", nil, nil, "pick at least 1 of Size"},
+		{"too many of a group", pick("size", "regular", "size", "large"), nil, "pick at most 1 of Size"},
+		{"too many extras", pick("size", "regular", "extras", "cheese", "extras", "bacon", "extras", "egg"), nil, "pick at most 2 of Extras"},
+		{"same option twice", pick("size", "regular", "extras", "cheese", "extras", "cheese"), nil, "Cheese is picked more than once"},
+		{"unknown group", pick("size", "regular", "sauce", "ketchup"), nil, `"sauce" is not a modifier group`},
+		{"unknown option", pick("size", "huge"), nil, `"huge" is not an option of Size`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selected, problem := SelectModifiers(food, tt.picked)
+			if tt.problem != "" {
+				if !strings.Contains(problem, tt.problem) {
+					t.Fatalf("problem = %q, want %q", problem, tt.problem)
+				}
+				return
+			}
+			if problem != "" || len(selected) != len(tt.deltas) {
+				t.Fatalf("SelectModifiers = %v, %q, want %d modifiers", selected, problem, len(tt.deltas))
+			}
+			for i, modifier := range selected {
+				// Names and prices come from the food, not from the client
+				if modifier.Price_delta != money.New(tt.deltas[i], "USD") || modifier.Name == "sent by the client" || modifier.Group_name == "" {
+					t.Fatalf("modifier %d = %+v, want a delta of %d", i, modifier, tt.deltas[i])
+				}
+			}
+		})
+	}
+}
+
+func TestModifierGroupsProblem(t *testing.T) {
+	eur, usd := money.New(50, "EUR"), money.New(50, "USD")
+	option := func(id string, delta *money.Money) models.ModifierOption {
+		return models.ModifierOption{Option_id: id, Name: id, Price_delta: delta}
+	}
+	group := func(id string, options ...models.ModifierOption) models.ModifierGroup {
+		return models.ModifierGroup{Group_id: id, Name: id, Options: options}
+	}
+	tests := []struct {
+		name     string
+		groups   []models.ModifierGroup
+		currency string
+		field    string
+	}{
+		{"no groups", nil, "USD", ""},
+		{"deltas in the currency of the food", []models.ModifierGroup{group("size", option("large", &usd), option("regular", nil))}, "USD", ""},
+		{"food priced in another currency", []models.ModifierGroup{group("size", option("large", &eur))}, "EUR", ""},
+		{"delta in another currency", []models.ModifierGroup{group("size", option("large", &eur))}, "USD", "modifier_groups[0].options[0].price_delta"},
+		{"same group twice", []models.ModifierGroup{group("size", option("a", nil)), group("size", option("b", nil))}, "USD", "modifier_groups[1].group_id"},
+		{"same option twice", []models.ModifierGroup{group("size", option("a", nil), option("a", nil))}, "USD", "modifier_groups[0].options[1].option_id"},
+		{"minimum above the maximum", []models.ModifierGroup{{Group_id: "size", Min_selections: 2, Max_selections: 1,
+			Options: []models.ModifierOption{option("a", nil), option("b", nil)}}}, "USD", "modifier_groups[0].min_selections"},
+		{"minimum above the options", []models.ModifierGroup{{Group_id: "size", Min_selections: 2,
+			Options: []models.ModifierOption{option("a", nil)}}}, "USD", "modifier_groups[0].min_selections"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			field, problem := ModifierGroupsProblem(tt.groups, tt.currency)
+			if field != tt.field || (problem == "") != (tt.field == "") {
+				t.Fatalf("ModifierGroupsProblem = %q, %q, want the field %q", field, problem, tt.field)
+			}
+		})
+	}
+}
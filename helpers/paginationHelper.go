@@ -0,0 +1,122 @@
+package helpers
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/PranavMasekar/restaurant-management/repository"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Page sizes of the list endpoints
+const (
+	DefaultPerPage = 10
+	MaxPerPage     = 100
+)
+
+// PaginationFromQuery reads ?limit= (or the older ?recordPerPage=) and either an opaque ?cursor=
+// returned by a previous page, a ?startIndex= offset or a ?page= number, in that order of precedence.
+// The cursor of keyset paginated lists is a KeysetCursor, they have no page numbers.
+func PaginationFromQuery(ctx *gin.Context, keyset bool) (repository.Pagination, error) {
+	perPage, err := strconv.Atoi(ctx.DefaultQuery("limit", ctx.Query("recordPerPage")))
+	if err != nil || perPage < 1 {
+		perPage = DefaultPerPage
+	}
+	if perPage > MaxPerPage {
+		perPage = MaxPerPage
+	}
+	page, err := strconv.Atoi(ctx.Query("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	startIndex, err := strconv.Atoi(ctx.Query("startIndex"))
+	if err != nil || startIndex < 0 {
+		startIndex = (page - 1) * perPage
+	}
+	if keyset {
+		var cursor *repository.KeysetCursor
+		if value := ctx.Query("cursor"); value != "" {
+			if cursor, err = repository.DecodeKeysetCursor(value); err != nil {
+				return repository.Pagination{}, err
+			}
+		}
+		return repository.Pagination{Page: 1, Per_page: perPage, Cursor: cursor}, nil
+	}
+	if cursor := ctx.Query("cursor"); cursor != "" {
+		if startIndex, err = decodeOffsetCursor(cursor); err != nil {
+			return repository.Pagination{}, err
+		}
+	}
+	return repository.Pagination{Page: startIndex/perPage + 1, Per_page: perPage, Start_index: startIndex}, nil
+}
+
+// SortFromQuery turns ?sort=-created_at,first_name into a sort document. Only the listed fields
+// can be sorted on, the _id is always added last so pages stay stable.
+func SortFromQuery(value string, allowed ...string) (bson.D, error) {
+	var sort bson.D
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		order := 1
+		if strings.HasPrefix(field, "-") {
+			order = -1
+			field = field[1:]
+		}
+		if !containsField(allowed, field) {
+			return nil, fmt.Errorf("cannot sort by %q", field)
+		}
+		sort = append(sort, bson.E{Key: field, Value: order})
+	}
+	return append(sort, bson.E{Key: "_id", Value: 1}), nil
+}
+
+// ListResponse is the body of an offset paginated list, the items are listed under key.
+// The next_cursor is only set while there are more items to fetch.
+func ListResponse(p repository.Pagination, key string, total int64, items interface{}) gin.H {
+	totalPages := (total + int64(p.Per_page) - 1) / int64(p.Per_page)
+	var nextCursor *string
+	if next := p.Start_index + p.Per_page; int64(next) < total {
+		cursor := encodeOffsetCursor(next)
+		nextCursor = &cursor
+	}
+	return gin.H{
+		"total_count": total,
+		"page":        p.Page,
+		"per_page":    p.Per_page,
+		"total_pages": totalPages,
+		"next_cursor": nextCursor,
+		key:           items,
+	}
+}
+
+// The cursors of offset paginated lists only hide the offset, clients must not build them
+func encodeOffsetCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte("offset:" + strconv.Itoa(offset)))
+}
+
+func decodeOffsetCursor(cursor string) (int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || !strings.HasPrefix(string(raw), "offset:") {
+		return 0, errors.New("invalid cursor")
+	}
+	offset, err := strconv.Atoi(strings.TrimPrefix(string(raw), "offset:"))
+	if err != nil || offset < 0 {
+		return 0, errors.New("invalid cursor")
+	}
+	return offset, nil
+}
+
+func containsField(fields []string, field string) bool {
+	for _, f := range fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
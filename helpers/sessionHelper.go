@@ -0,0 +1,92 @@
+package helpers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/PranavMasekar/restaurant-management/models"
+	"github.com/PranavMasekar/restaurant-management/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// NewSession starts a login session, mfa tells whether the login passed a second factor
+func NewSession(mfa bool) models.Session {
+	now, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	return models.Session{
+		Session_id: primitive.NewObjectID().Hex(),
+		Mfa:        mfa,
+		Created_at: now,
+		Updated_at: now,
+		Expires_at: now.Add(RefreshTokenTTL),
+	}
+}
+
+// NewTerminalSession starts a PIN login session on a registered POS terminal.
+// Its tokens are short-lived and limited to the POS scope.
+func NewTerminalSession(deviceId string) models.Session {
+	session := NewSession(false)
+	session.Scope = ScopePOS
+	session.Device_id = deviceId
+	session.Expires_at = session.Created_at.Add(PinTokenTTL)
+	return session
+}
+
+// RotateRefreshToken swaps the refresh token of a session, but only while oldRefreshToken is still
+// the current one. It returns false when another request already rotated it or the session was revoked.
+func RotateRefreshToken(c context.Context, users repository.UserRepository, userId string, session models.Session, oldRefreshToken string, signedToken string, signedRefreshToken string) (bool, error) {
+	updated_at, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	session.Refresh_token = signedRefreshToken
+	session.Updated_at = updated_at
+	session.Expires_at = updated_at.Add(refreshTokenTTL(session.Scope))
+	return users.RotateRefreshToken(c, userId, session, oldRefreshToken, signedToken)
+}
+
+// CheckSession verifies that the tokens behind claims have not been revoked since they were issued:
+// the user must still exist, the token version must match and the session must still be active
+func CheckSession(c context.Context, users repository.UserRepository, devices repository.DeviceRepository, claims *SignedDetails) (msg string) {
+	user, err := users.FindById(c, claims.Uid)
+	if err == repository.ErrNotFound {
+		msg = fmt.Sprintf("user no longer exists")
+		return
+	}
+	if err != nil {
+		msg = fmt.Sprintf("error occured while checking the session")
+		return
+	}
+	return SessionProblem(c, devices, user, claims)
+}
+
+// SessionProblem applies the checks of CheckSession to a user that was already read, it returns
+// why the tokens behind claims cannot be used anymore, "" when they still can
+func SessionProblem(c context.Context, devices repository.DeviceRepository, user models.User, claims *SignedDetails) (msg string) {
+	if user.Deactivated_at != nil {
+		msg = fmt.Sprintf("account has been deactivated")
+		return
+	}
+	if claims.Token_version != user.Token_version {
+		msg = fmt.Sprintf("token has been revoked")
+		return
+	}
+	session := FindSession(user, claims.Session_id)
+	if session == nil || session.Revoked {
+		msg = fmt.Sprintf("session has been revoked")
+		return
+	}
+	// Revoking a terminal logs out everyone who used their PIN on it
+	if session.Device_id != "" && !deviceIsActive(c, devices, session.Device_id) {
+		msg = fmt.Sprintf("device has been revoked")
+		return
+	}
+	return msg
+}
+
+// FindSession returns the session with the given id, or nil when the user has no such session
+func FindSession(user models.User, sessionId string) *models.Session {
+	for i := range user.Sessions {
+		if user.Sessions[i].Session_id == sessionId {
+			return &user.Sessions[i]
+		}
+	}
+	return nil
+}
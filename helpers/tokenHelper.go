@@ -3,67 +3,107 @@ package helpers
 import (
 	"context"
 	"fmt"
-	"log"
-	"os"
 	"time"
 
-	"github.com/PranavMasekar/restaurant-management/database"
-	"github.com/dgrijalva/jwt-go"
-	"go.mongodb.org/mongo-driver/bson"
+	"github.com/PranavMasekar/restaurant-management/config"
+	"github.com/PranavMasekar/restaurant-management/models"
+	"github.com/PranavMasekar/restaurant-management/repository"
+	"github.com/golang-jwt/jwt/v4"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-type SignedDetails struct {
-	Email      string
-	First_name string
-	Last_name  string
-	Uid        string
-	User_type  string
-	jwt.StandardClaims
+// Values of SignedDetails.Token_type
+const (
+	AccessToken  = "access"
+	RefreshToken = "refresh"
+)
+
+// Lifetimes of the issued tokens, PIN logins on POS terminals get a much shorter one.
+// Configure replaces the defaults with the configured ones.
+var (
+	AccessTokenTTL  = config.Default().Auth.Access_token_ttl
+	RefreshTokenTTL = config.Default().Auth.Refresh_token_ttl
+	PinTokenTTL     = config.Default().Auth.Pin_token_ttl
+)
+
+// Configure applies the authentication settings: the signing keys, the token lifetimes and the
+// two-factor policy. main calls it once at startup, before serving any request.
+func Configure(cfg config.Auth) error {
+	keys, err := LoadKeys(cfg)
+	if err != nil {
+		return err
+	}
+	Keys = keys
+	AccessTokenTTL, RefreshTokenTTL, PinTokenTTL = cfg.Access_token_ttl, cfg.Refresh_token_ttl, cfg.Pin_token_ttl
+	totpIssuer, twoFactorRoles = cfg.Totp_issuer, cfg.Totp_required_roles
+	return nil
 }
 
-var userCollection *mongo.Collection = database.OpenCollection(database.Client, "user")
+// ScopePOS limits a token to the routes a shared POS terminal needs. Tokens without a scope have full access.
+const ScopePOS = "pos"
 
-var SECRET_KEY string = os.Getenv("SECRET_KEY")
+type SignedDetails struct {
+	Email         string
+	First_name    string
+	Last_name     string
+	Uid           string
+	User_type     string
+	Session_id    string
+	Token_type    string
+	Token_version int
+	Mfa           bool
+	Scope         string
+	jwt.StandardClaims
+}
 
-func GenerateAllTokens(email string, firstName string, lastName string, userId string) (signedToken string, signedRefreshToken string, err error) {
+// GenerateAllTokens issues the access and refresh token of a session of the user
+func GenerateAllTokens(user models.User, session models.Session) (signedToken string, signedRefreshToken string, err error) {
 	// Creating Token claims
 	claims := &SignedDetails{
-		Email:      email,
-		First_name: firstName,
-		Last_name:  lastName,
-		Uid:        userId,
+		Email:         *user.Email,
+		First_name:    *user.First_name,
+		Last_name:     *user.Last_name,
+		Uid:           user.User_id,
+		User_type:     UserType(user),
+		Session_id:    session.Session_id,
+		Token_type:    AccessToken,
+		Token_version: user.Token_version,
+		Mfa:           session.Mfa,
+		Scope:         session.Scope,
 		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Local().Add(time.Hour * time.Duration(24)).Unix(),
+			Id:        primitive.NewObjectID().Hex(),
+			ExpiresAt: time.Now().Local().Add(accessTokenTTL(session.Scope)).Unix(),
 		},
 	}
-	// Creating Refresh Token claims
+	// Creating Refresh Token claims, the id makes every rotated refresh token unique
 	refreshClaims := &SignedDetails{
+		Uid:           user.User_id,
+		Session_id:    session.Session_id,
+		Token_type:    RefreshToken,
+		Token_version: user.Token_version,
 		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Local().Add(time.Hour * time.Duration(168)).Unix(),
+			Id:        primitive.NewObjectID().Hex(),
+			ExpiresAt: time.Now().Local().Add(refreshTokenTTL(session.Scope)).Unix(),
 		},
 	}
 
-	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(SECRET_KEY))
-	refreshToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, refreshClaims).SignedString([]byte(SECRET_KEY))
-
+	token, err := Keys.Sign(claims)
 	if err != nil {
-		log.Panic(err)
-		return
+		return "", "", err
+	}
+	refreshToken, err := Keys.Sign(refreshClaims)
+	if err != nil {
+		return "", "", err
 	}
 
-	return token, refreshToken, err
+	return token, refreshToken, nil
 }
 
 func ValidateToken(signedToken string) (claims *SignedDetails, msg string) {
 	token, err := jwt.ParseWithClaims(
 		signedToken,
 		&SignedDetails{},
-		func(t *jwt.Token) (interface{}, error) {
-			return []byte(SECRET_KEY), nil
-		},
+		Keys.Keyfunc,
 	)
 
 	if err != nil {
@@ -72,9 +112,8 @@ func ValidateToken(signedToken string) (claims *SignedDetails, msg string) {
 	}
 	claims, ok := token.Claims.(*SignedDetails)
 
-	if !ok {
-		fmt.Sprintf("token is invalid")
-		msg = err.Error()
+	if !ok || !token.Valid {
+		msg = fmt.Sprintf("token is invalid")
 		return
 	}
 	if claims.ExpiresAt < time.Now().Local().Unix() {
@@ -84,36 +123,34 @@ func ValidateToken(signedToken string) (claims *SignedDetails, msg string) {
 	return claims, msg
 }
 
-func UpdateAllTokens(signedToken string, signedRefreshToken string, user_id string) {
-	var c, cancel = context.WithTimeout(context.Background(), 100*time.Second)
-	var updateObj primitive.D
-	// Add token and refresh token
-	updateObj = append(updateObj, bson.E{Key: "token", Value: signedToken})
-	updateObj = append(updateObj, bson.E{Key: "refresh_token", Value: signedRefreshToken})
-
+// UpdateAllTokens stores the tokens of a new login on the user along with its session
+func UpdateAllTokens(c context.Context, users repository.UserRepository, signedToken string, signedRefreshToken string, user_id string, session models.Session) error {
 	updated_at, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
-	updateObj = append(updateObj, bson.E{Key: "updated_at", Value: updated_at})
-
-	upsert := true
+	// Keep track of the refresh token of this login so it can be rotated later
+	session.Refresh_token = signedRefreshToken
+	session.Updated_at = updated_at
+	session.Expires_at = updated_at.Add(refreshTokenTTL(session.Scope))
+	return users.SaveSession(c, user_id, session, signedToken)
+}
 
-	filter := bson.M{"user_id": user_id}
-	opt := options.UpdateOptions{
-		Upsert: &upsert,
+func accessTokenTTL(scope string) time.Duration {
+	if scope == ScopePOS {
+		return PinTokenTTL
 	}
-	// Update in DB
-	_, err := userCollection.UpdateOne(
-		c,
-		filter,
-		bson.D{
-			{Key: "$set", Value: updateObj},
-		},
-		&opt,
-	)
+	return AccessTokenTTL
+}
 
-	defer cancel()
+func refreshTokenTTL(scope string) time.Duration {
+	if scope == ScopePOS {
+		return PinTokenTTL
+	}
+	return RefreshTokenTTL
+}
 
-	if err != nil {
-		log.Panic(err)
-		return
+// UserType returns the role of the user, treating accounts created before roles existed as waiters
+func UserType(user models.User) string {
+	if user.User_type == nil || *user.User_type == "" {
+		return models.RoleWaiter
 	}
+	return *user.User_type
 }
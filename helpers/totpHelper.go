@@ -0,0 +1,118 @@
+package helpers
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/PranavMasekar/restaurant-management/config"
+)
+
+// TOTP parameters from RFC 6238, the defaults every authenticator app understands
+const (
+	totpPeriod = 30
+	totpDigits = 6
+	// Codes from the step before and after the current one are accepted to absorb clock drift
+	totpSkew = 1
+	// Number of single-use recovery codes handed out when 2FA is enabled
+	RecoveryCodeCount = 10
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+var totpIssuer = config.Default().Auth.Totp_issuer
+
+// Roles whose members cannot use the API without a second factor
+var twoFactorRoles = config.Default().Auth.Totp_required_roles
+
+// TwoFactorRequired tells whether users with the role must log in with a second factor
+func TwoFactorRequired(userType string) bool {
+	for _, role := range twoFactorRoles {
+		if strings.TrimSpace(role) == userType {
+			return true
+		}
+	}
+	return false
+}
+
+// GenerateTOTPSecret returns a new random base32 encoded secret
+func GenerateTOTPSecret() (string, error) {
+	raw := make([]byte, 20)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(raw), nil
+}
+
+// TOTPURI builds the otpauth:// URI authenticator apps read from a QR code
+func TOTPURI(secret string, account string) string {
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", totpIssuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprint(totpDigits))
+	params.Set("period", fmt.Sprint(totpPeriod))
+	label := url.PathEscape(totpIssuer + ":" + account)
+	return "otpauth://totp/" + label + "?" + params.Encode()
+}
+
+// ValidateTOTP checks the code against the secret and returns the time step it belongs to,
+// callers store that step to refuse the same code a second time
+func ValidateTOTP(secret string, code string, at time.Time) (step int64, ok bool) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(strings.TrimSpace(secret)))
+	if err != nil {
+		return 0, false
+	}
+	code = strings.TrimSpace(code)
+	current := at.Unix() / totpPeriod
+	for i := current - totpSkew; i <= current+totpSkew; i++ {
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, i)), []byte(code)) == 1 {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+func totpCode(key []byte, step int64) string {
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+	// Dynamic truncation from RFC 4226
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%uint32(math.Pow10(totpDigits)))
+}
+
+// GenerateRecoveryCodes returns the codes to show the user once and the hashes to store
+func GenerateRecoveryCodes() (codes []string, hashes []string, err error) {
+	for i := 0; i < RecoveryCodeCount; i++ {
+		raw := make([]byte, 6)
+		if _, err = rand.Read(raw); err != nil {
+			return nil, nil, err
+		}
+		code := strings.ToLower(totpEncoding.EncodeToString(raw))
+		// Split in two halves so it is easier to type
+		code = code[:5] + "-" + code[5:]
+		codes = append(codes, code)
+		hashes = append(hashes, HashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+func HashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,116 @@
+package helpers
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// The shared secret of the SHA1 test vectors of RFC 6238, "12345678901234567890" in base32
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPMatchesTheRFCVectors(t *testing.T) {
+	// RFC 6238 Appendix B lists 8 digit codes, the 6 digit ones are their last digits
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+	for _, tt := range tests {
+		want := tt.code[len(tt.code)-totpDigits:]
+		step, ok := ValidateTOTP(rfcSecret, want, time.Unix(tt.unix, 0))
+		if !ok || step != tt.unix/totpPeriod {
+			t.Fatalf("ValidateTOTP(%s) at %d = %d, %v, want step %d", want, tt.unix, step, ok, tt.unix/totpPeriod)
+		}
+	}
+}
+
+func TestValidateTOTPWindow(t *testing.T) {
+	// 081804 is the code of the step holding 1111111109
+	issued := time.Unix(1111111109, 0)
+	tests := []struct {
+		name   string
+		secret string
+		code   string
+		at     time.Time
+		ok     bool
+	}{
+		{"same step", rfcSecret, "081804", issued, true},
+		{"one step late", rfcSecret, "081804", issued.Add(totpPeriod * time.Second), true},
+		{"one step early", rfcSecret, "081804", issued.Add(-totpPeriod * time.Second), true},
+		{"two steps late", rfcSecret, "081804", issued.Add(2 * totpPeriod * time.Second), false},
+		{"two steps early", rfcSecret, "081804", issued.Add(-2 * totpPeriod * time.Second), false},
+		{"lowercase secret and padded code", strings.ToLower(rfcSecret), " 081804 ", issued, true},
+		{"wrong code", rfcSecret, "081805", issued, false},
+		{"empty code", rfcSecret, "", issued, false},
+		{"8 digit code", rfcSecret, "07081804", issued, false},
+		{"secret not in base32", "not base32!", "081804", issued, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := ValidateTOTP(tt.secret, tt.code, tt.at)
+			if ok != tt.ok {
+				t.Fatalf("ValidateTOTP = %d, %v, want %v", step, ok, tt.ok)
+			}
+			// The step of the code is returned, not the current one, so a replay is caught
+			if ok && step != issued.Unix()/totpPeriod {
+				t.Fatalf("step = %d, want %d", step, issued.Unix()/totpPeriod)
+			}
+		})
+	}
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil || len(key) != 20 {
+		t.Fatalf("secret %q decodes to %d bytes (%v), want 20", secret, len(key), err)
+	}
+	if code := totpCode(key, 1); len(code) != totpDigits {
+		t.Fatalf("code %q has %d digits", code, len(code))
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, hashes, err := GenerateRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != RecoveryCodeCount || len(hashes) != RecoveryCodeCount {
+		t.Fatalf("%d codes and %d hashes, want %d", len(codes), len(hashes), RecoveryCodeCount)
+	}
+	seen := map[string]bool{}
+	for i, code := range codes {
+		if seen[code] {
+			t.Fatalf("code %q handed out twice", code)
+		}
+		seen[code] = true
+		if hashes[i] != HashRecoveryCode(code) || strings.Contains(hashes[i], code) {
+			t.Fatalf("hash %q does not match the code %q", hashes[i], code)
+		}
+		// The way it is typed back does not matter
+		typed := strings.ToUpper(strings.ReplaceAll(code, "-", "")) + " "
+		if HashRecoveryCode(typed) != hashes[i] {
+			t.Fatalf("code %q typed as %q is not recognized", code, typed)
+		}
+	}
+}
+
+func TestTwoFactorRequired(t *testing.T) {
+	defer func(roles []string) { twoFactorRoles = roles }(twoFactorRoles)
+	twoFactorRoles = []string{"ADMIN", " MANAGER"}
+	for role, want := range map[string]bool{"ADMIN": true, "MANAGER": true, "WAITER": false, "": false} {
+		if got := TwoFactorRequired(role); got != want {
+			t.Fatalf("TwoFactorRequired(%q) = %v, want %v", role, got, want)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package helpers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/PranavMasekar/restaurant-management/models"
+	"github.com/PranavMasekar/restaurant-management/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// How long a mailed token can be used
+const (
+	PasswordResetTTL     = time.Hour
+	EmailVerificationTTL = 48 * time.Hour
+)
+
+// CreateUserToken issues a new single-use token for the user, to be mailed to email, and returns
+// it in clear text. Any earlier unused token with the same purpose stops working.
+func CreateUserToken(c context.Context, tokens repository.UserTokenRepository, userId string, email string, purpose string, ttl time.Duration) (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	created_at, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	userToken := models.UserToken{
+		ID:         primitive.NewObjectID(),
+		Token_hash: hashUserToken(token),
+		Purpose:    purpose,
+		User_id:    userId,
+		Email:      email,
+		Expires_at: created_at.Add(ttl),
+		Created_at: created_at,
+	}
+	if err := tokens.Replace(c, userToken); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// ConsumeUserToken marks the token as used and returns it, with the user and the address it was
+// issued to. It returns repository.ErrNotFound when the token is unknown, expired or already used.
+func ConsumeUserToken(c context.Context, tokens repository.UserTokenRepository, token string, purpose string) (models.UserToken, error) {
+	return tokens.Consume(c, hashUserToken(token), purpose, time.Now())
+}
+
+// MailedTo tells whether the token was mailed to the current address of the user, only then
+// does using it prove that the user owns that address
+func MailedTo(token models.UserToken, user models.User) bool {
+	return token.Email != "" && user.Email != nil && strings.EqualFold(token.Email, *user.Email)
+}
+
+func hashUserToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
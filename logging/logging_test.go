@@ -0,0 +1,64 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+)
+
+func TestNewStampsTheContextIDs(t *testing.T) {
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want map[string]string
+	}{
+		{"outside of requests", context.Background(), map[string]string{}},
+		{"request", WithRequestID(context.Background(), "req-1"), map[string]string{"request_id": "req-1"}},
+		{"authenticated request", WithUserID(WithRequestID(context.Background(), "req-1"), "u-1"), map[string]string{"request_id": "req-1", "user_id": "u-1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			New(&out, "info").With("component", "test").InfoContext(tt.ctx, "hello")
+			var line map[string]interface{}
+			if err := json.Unmarshal(out.Bytes(), &line); err != nil {
+				t.Fatal(err)
+			}
+			for _, key := range []string{"request_id", "user_id"} {
+				got, _ := line[key].(string)
+				if got != tt.want[key] {
+					t.Fatalf("%s = %q, want %q in %s", key, got, tt.want[key], out.String())
+				}
+			}
+			if line["component"] != "test" {
+				t.Fatalf("attributes of the logger were lost: %s", out.String())
+			}
+		})
+	}
+}
+
+func TestNewLevel(t *testing.T) {
+	tests := []struct {
+		level   string
+		enabled slog.Level
+		dropped slog.Level
+	}{
+		{"debug", slog.LevelDebug, slog.LevelDebug - 1},
+		{"warn", slog.LevelWarn, slog.LevelInfo},
+		{"error", slog.LevelError, slog.LevelWarn},
+		// An unknown level falls back to info
+		{"chatty", slog.LevelInfo, slog.LevelDebug},
+	}
+	for _, tt := range tests {
+		logger := New(&bytes.Buffer{}, tt.level)
+		if !logger.Enabled(context.Background(), tt.enabled) || logger.Enabled(context.Background(), tt.dropped) {
+			t.Errorf("New(%q) enables %v: %v, %v: %v", tt.level, tt.enabled, logger.Enabled(context.Background(), tt.enabled),
+				tt.dropped, logger.Enabled(context.Background(), tt.dropped))
+		}
+	}
+	if a, b := NewRequestID(), NewRequestID(); len(a) != 32 || a == b {
+		t.Fatalf("NewRequestID() = %q, %q, want distinct 32 character IDs", a, b)
+	}
+}
@@ -0,0 +1,48 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/PranavMasekar/restaurant-management/logging"
+)
+
+// LogMailer does not deliver anything, it appends every message to the file at Path
+// or logs it when Path is empty. The application log is shipped and read by more people than
+// the mailbox would be, so the tokens of the mailed links are redacted there.
+type LogMailer struct {
+	Path string
+	From string
+	mu   sync.Mutex
+}
+
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	if m.Path == "" {
+		slog.InfoContext(ctx, "mail", "from", m.From, "to", msg.To, "subject", msg.Subject, "body", redactTokens(msg.Body))
+		return nil
+	}
+	entry := fmt.Sprintf("--- %s\nFrom: %s\nTo: %s\nX-Request-ID: %s\nSubject: %s\n\n%s\n",
+		time.Now().Format(time.RFC3339), m.From, msg.To, logging.RequestID(ctx), msg.Subject, msg.Body)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	file, err := os.OpenFile(m.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.WriteString(entry)
+	return err
+}
+
+// Query parameters holding the one-time tokens of the reset and verification links
+var tokenParam = regexp.MustCompile(`([?&]token=)[^&\s]+`)
+
+func redactTokens(body string) string {
+	return tokenParam.ReplaceAllString(body, "${1}REDACTED")
+}
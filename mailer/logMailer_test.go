@@ -0,0 +1,46 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const resetBody = "Use the link below.\n\nhttps://app.example.com/reset-password?token=s3cr3t-t0k3n&lang=en\n"
+
+func TestLogMailerRedactsTokensFromTheApplicationLog(t *testing.T) {
+	var logged bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logged, nil)))
+	defer slog.SetDefault(previous)
+
+	mailer := &LogMailer{From: "noreply@example.com"}
+	if err := mailer.Send(context.Background(), Message{To: "ann@example.com", Subject: "Reset", Body: resetBody}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(logged.String(), "s3cr3t-t0k3n") {
+		t.Fatalf("the token was logged: %s", logged.String())
+	}
+	if !strings.Contains(logged.String(), "reset-password?token=REDACTED&lang=en") {
+		t.Fatalf("the link was not kept: %s", logged.String())
+	}
+}
+
+func TestLogMailerKeepsTheLinksInItsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mail.log")
+	mailer := &LogMailer{Path: path, From: "noreply@example.com"}
+	if err := mailer.Send(context.Background(), Message{To: "ann@example.com", Subject: "Reset", Body: resetBody}); err != nil {
+		t.Fatal(err)
+	}
+	written, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(written), "?token=s3cr3t-t0k3n&lang=en") {
+		t.Fatalf("the file lost the link: %s", written)
+	}
+}
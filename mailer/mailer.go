@@ -0,0 +1,33 @@
+package mailer
+
+import (
+	"context"
+
+	"github.com/PranavMasekar/restaurant-management/config"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers transactional mail such as password resets and email verifications
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// FromConfig picks the mailer of the mail driver: "smtp" sends real mail, anything else writes
+// messages to the log file (or the application log) for local development and tests
+func FromConfig(cfg config.Mail) Mailer {
+	if cfg.Driver == "smtp" {
+		return &SMTPMailer{
+			Host:     cfg.Smtp_host,
+			Port:     cfg.Smtp_port,
+			Username: cfg.Smtp_username,
+			Password: cfg.Smtp_password,
+			From:     cfg.From,
+		}
+	}
+	return &LogMailer{Path: cfg.Log_file, From: cfg.From}
+}
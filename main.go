@@ -1,35 +1,146 @@
 package main
 
 import (
+	"context"
+	"log/slog"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	// Menu schedules are evaluated in their timezone, the container image has no zoneinfo
+	_ "time/tzdata"
 
+	"github.com/PranavMasekar/restaurant-management/config"
+	"github.com/PranavMasekar/restaurant-management/controllers"
 	"github.com/PranavMasekar/restaurant-management/database"
+	"github.com/PranavMasekar/restaurant-management/helpers"
+	"github.com/PranavMasekar/restaurant-management/logging"
+	"github.com/PranavMasekar/restaurant-management/mailer"
 	"github.com/PranavMasekar/restaurant-management/middleware"
+	"github.com/PranavMasekar/restaurant-management/money"
+	"github.com/PranavMasekar/restaurant-management/repository"
 	"github.com/PranavMasekar/restaurant-management/routes"
+	"github.com/PranavMasekar/restaurant-management/tracing"
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
-var foodCollection *mongo.Collection = database.OpenCollection(database.Client, "food")
-
 func main() {
-	port := os.Getenv("PORT")
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		slog.Error("invalid configuration", "error", err)
+		os.Exit(1)
+	}
+	logging.Setup(cfg.Log_level)
+	if cfg.Log_level != "debug" {
+		gin.SetMode(gin.ReleaseMode)
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		slog.Error("could not set up tracing", "error", err)
+		os.Exit(1)
+	}
+
+	money.DefaultCurrency = cfg.Currency
+	controllers.RequestTimeout = cfg.Http.Request_timeout
+	if err := helpers.Configure(cfg.Auth); err != nil {
+		slog.Error("could not load the signing keys", "error", err)
+		os.Exit(1)
+	}
+
+	client, err := database.Connect(context.Background(), cfg.Mongo)
+	if err != nil {
+		slog.Error("could not connect to mongodb", "error", err)
+		os.Exit(1)
+	}
+	db := client.Database(cfg.Mongo.Database)
 
-	if port == "" {
-		port = "8000"
+	if err := database.EnsureIndexes(db); err != nil {
+		slog.Error("could not create the database indexes", "error", err)
 	}
+	if migrated, err := database.MigrateMoney(db); err != nil {
+		slog.Error("could not convert the prices to money", "error", err, "migrated", migrated)
+	} else if migrated > 0 {
+		slog.Info("converted prices to money", "migrated", migrated, "currency", cfg.Currency)
+	}
+	if migrated, err := database.MigrateQuantities(db); err != nil {
+		slog.Error("could not convert the order item sizes to modifiers", "error", err, "migrated", migrated)
+	} else if migrated > 0 {
+		slog.Info("converted order item sizes to modifiers", "migrated", migrated)
+	}
+
+	repos := repository.NewMongoRepositories(db)
+	health := controllers.NewHealthHandler(client, cfg.Mongo.Ping_timeout)
+	auth := middleware.NewAuthenticator(repos.Users, repos.Devices, cfg.Auth.Legacy_token_header)
+	users := controllers.NewUserHandler(repos.Users, repos.Devices, repos.UserTokens, repos.LoginAttempts, mailer.FromConfig(cfg.Mail), cfg.App_base_url)
 
 	router := gin.New()
-	router.Use(gin.Logger())
-	routes.UserRoutes(router)
-	router.Use(middleware.Authentication())
-
-	routes.FoodRoutes(router)
-	routes.MenuRoutes(router)
-	routes.TableRoutes(router)
-	routes.OrderRoutes(router)
-	routes.OrderItemRoutes(router)
-	routes.InvoiceRoutes(router)
-
-	router.Run(":" + port)
+	// The client IP keys the login throttling, it may only come from the headers of known proxies
+	if err := router.SetTrustedProxies(cfg.Http.Trusted_proxies); err != nil {
+		slog.Error("invalid trusted proxies", "error", err)
+		os.Exit(1)
+	}
+	router.Use(middleware.RequestID())
+	router.Use(middleware.Tracing())
+	router.Use(middleware.Logger())
+	router.Use(middleware.Metrics())
+	router.Use(middleware.Recovery())
+	router.Use(middleware.Cors(cfg.Cors))
+	routes.HealthRoutes(router, health)
+	routes.MetricsRoutes(router)
+	routes.UserRoutes(router, users, auth)
+	routes.KeyRoutes(router)
+	router.Use(auth.Authentication())
+
+	routes.FoodRoutes(router, controllers.NewFoodHandler(repos.Foods, repos.Menus))
+	routes.MenuRoutes(router, controllers.NewMenuHandler(repos.Menus, repos.Foods))
+	routes.TableRoutes(router, controllers.NewTableHandler(repos.Tables))
+	routes.OrderRoutes(router, controllers.NewOrderHandler(repos.Orders, repos.Tables))
+	routes.OrderItemRoutes(router, controllers.NewOrderItemHandler(repos.OrderItems, repos.Orders, repos.Tables, repos.Foods, repos.Menus))
+	routes.InvoiceRoutes(router, controllers.NewInvoiceHandler(repos.Invoices, repos.Orders, repos.OrderItems))
+	routes.DeviceRoutes(router, controllers.NewDeviceHandler(repos.Devices))
+
+	server := &http.Server{
+		Addr:              ":" + cfg.Port,
+		Handler:           router,
+		ReadTimeout:       cfg.Http.Read_timeout,
+		ReadHeaderTimeout: cfg.Http.Read_timeout,
+		WriteTimeout:      cfg.Http.Write_timeout,
+		IdleTimeout:       cfg.Http.Idle_timeout,
+	}
+
+	// Ctrl+C locally, SIGTERM when Kubernetes or Docker stop the container
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		slog.Info("listening", "addr", server.Addr)
+		serverErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serverErr:
+		if err != http.ErrServerClosed {
+			slog.Error("server stopped", "error", err)
+		}
+	case <-ctx.Done():
+		slog.Info("shutting down, waiting for in-flight requests")
+	}
+	stop()
+	health.Drain()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Http.Shutdown_timeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Error("could not finish every request", "error", err)
+	}
+	if err := client.Disconnect(shutdownCtx); err != nil {
+		slog.Error("could not disconnect from mongodb", "error", err)
+	}
+	// Last, so that the spans of the requests that just finished are exported too
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		slog.Error("could not flush the traces", "error", err)
+	}
+	slog.Info("stopped")
 }
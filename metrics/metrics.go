@@ -0,0 +1,81 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Buckets in seconds, from a cached lookup to the slowest aggregation worth telling apart
+var latencyBuckets = []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// HTTP traffic, labelled with the route pattern rather than the path to keep the cardinality bounded
+var (
+	HttpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests handled, by method, route and status code.",
+	}, []string{"method", "route", "status"})
+
+	HttpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Time spent answering HTTP requests, by method and route.",
+		Buckets: latencyBuckets,
+	}, []string{"method", "route"})
+
+	HttpRequestsInFlight = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "http_requests_in_flight",
+		Help: "HTTP requests currently being handled.",
+	})
+)
+
+// MongoDB commands and the connection pool of the driver
+var (
+	MongoCommandDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "mongodb_command_duration_seconds",
+		Help:    "Time MongoDB commands took, by command, collection and outcome.",
+		Buckets: latencyBuckets,
+	}, []string{"command", "collection", "status"})
+
+	MongoPoolConnections = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "mongodb_pool_connections",
+		Help: "Connections of the MongoDB pool, open ones and those checked out by an operation.",
+	}, []string{"state"})
+
+	MongoPoolCheckoutFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "mongodb_pool_checkout_failures_total",
+		Help: "Operations that could not get a connection from the pool, by reason.",
+	}, []string{"reason"})
+)
+
+// Business counters
+var (
+	OrdersCreated = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "restaurant_orders_created_total",
+		Help: "Orders created.",
+	})
+
+	InvoicesPaid = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "restaurant_invoices_paid_total",
+		Help: "Invoices marked as paid, by payment method.",
+	}, []string{"payment_method"})
+
+	Revenue = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "restaurant_revenue_total",
+		Help: "Amount of the paid invoices, by payment method.",
+	}, []string{"payment_method"})
+)
+
+// Payment methods reported under their own label, any other one is counted as "other" so that
+// the number of series stays bounded
+var paymentMethods = map[string]bool{"CARD": true, "CASH": true}
+
+// InvoicePaid counts a payment of amount made with method, which may be empty
+func InvoicePaid(method string, amount float64) {
+	switch {
+	case method == "":
+		method = "UNKNOWN"
+	case !paymentMethods[method]:
+		method = "other"
+	}
+	InvoicesPaid.WithLabelValues(method).Inc()
+	Revenue.WithLabelValues(method).Add(amount)
+}
@@ -0,0 +1,30 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestInvoicePaidBoundsThePaymentMethods(t *testing.T) {
+	tests := []struct {
+		method string
+		label  string
+	}{
+		{"CARD", "CARD"},
+		{"CASH", "CASH"},
+		{"", "UNKNOWN"},
+		{"BITCOIN", "other"},
+		{"card; DROP", "other"},
+	}
+	for _, tt := range tests {
+		before := testutil.ToFloat64(InvoicesPaid.WithLabelValues(tt.label))
+		InvoicePaid(tt.method, 12.5)
+		if got := testutil.ToFloat64(InvoicesPaid.WithLabelValues(tt.label)); got != before+1 {
+			t.Errorf("InvoicePaid(%q) counted %v under %q, want 1", tt.method, got-before, tt.label)
+		}
+	}
+	if got := testutil.ToFloat64(Revenue.WithLabelValues("other")); got != 25 {
+		t.Errorf("revenue of the other methods = %v, want 25", got)
+	}
+}
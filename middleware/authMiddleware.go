@@ -1,25 +1,85 @@
 package middleware
 
 import (
+	"context"
+	"fmt"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/PranavMasekar/restaurant-management/apperror"
 	"github.com/PranavMasekar/restaurant-management/helpers"
+	"github.com/PranavMasekar/restaurant-management/logging"
+	"github.com/PranavMasekar/restaurant-management/repository"
 	"github.com/gin-gonic/gin"
 )
 
-func Authentication() gin.HandlerFunc {
+// Realm advertised in the WWW-Authenticate challenge
+const realm = "restaurant"
+
+// Authenticator checks the access tokens against the sessions of the users and the terminals
+// they were issued on. legacyTokenHeader keeps accepting the token from the old custom "token"
+// header, set AUTH_LEGACY_TOKEN_HEADER=false once every client sends Authorization: Bearer.
+type Authenticator struct {
+	users             repository.UserRepository
+	devices           repository.DeviceRepository
+	legacyTokenHeader bool
+}
+
+func NewAuthenticator(users repository.UserRepository, devices repository.DeviceRepository, legacyTokenHeader bool) *Authenticator {
+	return &Authenticator{users: users, devices: devices, legacyTokenHeader: legacyTokenHeader}
+}
+
+// Authentication lets through requests carrying a valid access token. Users whose role requires
+// two-factor authentication also need a token from a login that passed the second factor.
+func (a *Authenticator) Authentication() gin.HandlerFunc {
+	return a.authenticate(true)
+}
+
+// EnrollmentAuthentication accepts tokens from logins without a second factor even when the role
+// requires one, so that those users can still enroll in two-factor authentication or log out
+func (a *Authenticator) EnrollmentAuthentication() gin.HandlerFunc {
+	return a.authenticate(false)
+}
+
+func (a *Authenticator) authenticate(enforceTwoFactor bool) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		// Get the token from the header of request
-		clientToken := ctx.Request.Header.Get("token")
+		clientToken, malformed := extractToken(ctx.Request, a.legacyTokenHeader)
+		if malformed {
+			invalidRequest(ctx, "the Authorization header must be Bearer followed by the token")
+			return
+		}
 		if clientToken == "" {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "No authorization header provided"})
-			ctx.Abort()
+			unauthorized(ctx, "", "No authorization header provided")
 			return
 		}
 		claims, err := helpers.ValidateToken(clientToken)
-
 		if err != "" {
-			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err})
+			unauthorized(ctx, "invalid_token", err)
+			return
+		}
+		// Refresh tokens are only good for /users/refresh
+		if claims.Token_type != helpers.AccessToken {
+			unauthorized(ctx, "invalid_token", "an access token is required")
+			return
+		}
+
+		// A token stays valid until it expires, so check the user was not logged out or removed since
+		c, cancel := context.WithTimeout(ctx.Request.Context(), 10*time.Second)
+		msg := helpers.CheckSession(c, a.users, a.devices, claims)
+		cancel()
+		if msg != "" {
+			unauthorized(ctx, "invalid_token", msg)
+			return
+		}
+
+		if enforceTwoFactor && !claims.Mfa && helpers.TwoFactorRequired(claims.User_type) {
+			appErr := apperror.Forbidden("two-factor authentication is required for your role").WithCode("two_factor_enrollment_required")
+			body := appErr.Body()
+			// Kept for clients written before the error codes existed
+			body["two_factor_enrollment_required"] = true
+			ctx.AbortWithStatusJSON(appErr.Status, body)
 			return
 		}
 
@@ -27,6 +87,51 @@ func Authentication() gin.HandlerFunc {
 		ctx.Set("first_name", claims.First_name)
 		ctx.Set("last_name", claims.Last_name)
 		ctx.Set("uid", claims.Uid)
+		ctx.Request = ctx.Request.WithContext(logging.WithUserID(ctx.Request.Context(), claims.Uid))
+		ctx.Set("user_type", claims.User_type)
+		ctx.Set("session_id", claims.Session_id)
+		ctx.Set("mfa", claims.Mfa)
+		ctx.Set("scope", claims.Scope)
 		ctx.Next()
 	}
 }
+
+// extractToken returns the bearer token of the request, or an empty string when there is none.
+// malformed is true when an Authorization header was sent but does not hold a bearer token, like
+// Basic credentials or a bare "Bearer". The legacy "token" header is only looked at when no
+// Authorization header was sent.
+func extractToken(r *http.Request, legacyTokenHeader bool) (token string, malformed bool) {
+	if authorization := r.Header.Get("Authorization"); authorization != "" {
+		parts := strings.SplitN(authorization, " ", 2)
+		if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") {
+			return "", true
+		}
+		token = strings.TrimSpace(parts[1])
+		return token, token == ""
+	}
+	if legacyTokenHeader {
+		return r.Header.Get("token"), false
+	}
+	return "", false
+}
+
+// unauthorized stops the request with a 401 and a RFC 6750 challenge.
+// The error code is left out when the request carried no credentials at all.
+func unauthorized(ctx *gin.Context, code string, msg string) {
+	ctx.Header("WWW-Authenticate", challenge(code, msg))
+	apperror.Respond(ctx, apperror.Unauthorized(msg))
+}
+
+// invalidRequest stops a request whose credentials cannot be read with a 400, as RFC 6750 asks
+func invalidRequest(ctx *gin.Context, msg string) {
+	ctx.Header("WWW-Authenticate", challenge("invalid_request", msg))
+	apperror.Respond(ctx, apperror.Validation(msg).WithCode("invalid_request"))
+}
+
+func challenge(code string, msg string) string {
+	if code == "" {
+		return fmt.Sprintf("Bearer realm=%q", realm)
+	}
+	description := strings.ReplaceAll(msg, `"`, `'`)
+	return fmt.Sprintf("Bearer realm=%q, error=%q, error_description=%q", realm, code, description)
+}
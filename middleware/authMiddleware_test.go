@@ -0,0 +1,164 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/PranavMasekar/restaurant-management/config"
+	"github.com/PranavMasekar/restaurant-management/helpers"
+	"github.com/PranavMasekar/restaurant-management/models"
+	"github.com/PranavMasekar/restaurant-management/repository"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestExtractToken(t *testing.T) {
+	tests := []struct {
+		name          string
+		authorization string
+		legacy        string
+		token         string
+		malformed     bool
+	}{
+		{"bearer", "Bearer abc.def", "", "abc.def", false},
+		{"scheme is case insensitive", "bearer abc.def", "", "abc.def", false},
+		{"surrounding spaces", "Bearer   abc.def ", "", "abc.def", false},
+		{"no credentials", "", "", "", false},
+		{"legacy header", "", "abc.def", "abc.def", false},
+		{"authorization wins over the legacy header", "Bearer abc.def", "old", "abc.def", false},
+		{"basic credentials", "Basic dXNlcjpwYXNz", "", "", true},
+		{"bare bearer", "Bearer", "", "", true},
+		{"bearer without a token", "Bearer   ", "", "", true},
+		{"token without a scheme", "abc.def", "", "", true},
+		{"malformed header ignores the legacy one", "Basic dXNlcjpwYXNz", "abc.def", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/foods", nil)
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+			if tt.legacy != "" {
+				r.Header.Set("token", tt.legacy)
+			}
+			token, malformed := extractToken(r, true)
+			if token != tt.token || malformed != tt.malformed {
+				t.Fatalf("extractToken = %q, %v, want %q, %v", token, malformed, tt.token, tt.malformed)
+			}
+		})
+	}
+}
+
+func TestAuthenticationChallenges(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	repos := repository.NewMemoryRepositories()
+	router := gin.New()
+	router.GET("/foods", NewAuthenticator(repos.Users, repos.Devices, false).Authentication(), func(ctx *gin.Context) {
+		ctx.Status(http.StatusOK)
+	})
+
+	tests := []struct {
+		name          string
+		authorization string
+		status        int
+		error         string
+	}{
+		{"no credentials", "", http.StatusUnauthorized, ""},
+		{"basic credentials", "Basic dXNlcjpwYXNz", http.StatusBadRequest, "invalid_request"},
+		{"bare bearer", "Bearer", http.StatusBadRequest, "invalid_request"},
+		{"not a token", "Bearer not-a-token", http.StatusUnauthorized, "invalid_token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/foods", nil)
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, r)
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.status)
+			}
+			challenge := rec.Header().Get("WWW-Authenticate")
+			if !strings.HasPrefix(challenge, `Bearer realm="restaurant"`) {
+				t.Fatalf("challenge = %q", challenge)
+			}
+			want := `error="` + tt.error + `"`
+			if tt.error == "" {
+				want = ""
+			}
+			if strings.Contains(challenge, "error=") != (want != "") || !strings.Contains(challenge, want) {
+				t.Fatalf("challenge = %q, want error %q", challenge, tt.error)
+			}
+		})
+	}
+}
+
+func TestAuthenticationEnforcesTwoFactorPerRole(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	auth := config.Default().Auth
+	auth.Secret_key = strings.Repeat("k", config.MinSecretLength)
+	auth.Totp_required_roles = []string{models.RoleAdmin, models.RoleManager}
+	if err := helpers.Configure(auth); err != nil {
+		t.Fatal(err)
+	}
+	c := context.Background()
+	repos := repository.NewMemoryRepositories()
+	authenticator := NewAuthenticator(repos.Users, repos.Devices, false)
+	router := gin.New()
+	ok := func(ctx *gin.Context) { ctx.Status(http.StatusOK) }
+	router.GET("/foods", authenticator.Authentication(), ok)
+	router.POST("/users/2fa/setup", authenticator.EnrollmentAuthentication(), ok)
+
+	// login stores a user of the role and returns the access token of a login, with or without
+	// a second factor
+	login := func(role string, mfa bool) string {
+		email, name := primitive.NewObjectID().Hex()+"@example.com", "Ann"
+		user := models.User{ID: primitive.NewObjectID(), Email: &email, First_name: &name, Last_name: &name, User_type: &role}
+		user.User_id = user.ID.Hex()
+		if err := repos.Users.Create(c, user); err != nil {
+			t.Fatal(err)
+		}
+		session := helpers.NewSession(mfa)
+		access, refresh, err := helpers.GenerateAllTokens(user, session)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := helpers.UpdateAllTokens(c, repos.Users, access, refresh, user.User_id, session); err != nil {
+			t.Fatal(err)
+		}
+		return access
+	}
+	manager := login(models.RoleManager, false)
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		token  string
+		status int
+	}{
+		{"manager without a second factor", http.MethodGet, "/foods", manager, http.StatusForbidden},
+		{"admin without a second factor", http.MethodGet, "/foods", login(models.RoleAdmin, false), http.StatusForbidden},
+		{"manager with a second factor", http.MethodGet, "/foods", login(models.RoleManager, true), http.StatusOK},
+		{"waiter without a second factor", http.MethodGet, "/foods", login(models.RoleWaiter, false), http.StatusOK},
+		{"manager enrolling in 2FA", http.MethodPost, "/users/2fa/setup", manager, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.target, nil)
+			r.Header.Set("Authorization", "Bearer "+tt.token)
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, r)
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body.String())
+			}
+			if tt.status == http.StatusForbidden && !strings.Contains(rec.Body.String(), "two_factor_enrollment_required") {
+				t.Fatalf("body = %s, want the two_factor_enrollment_required code", rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/PranavMasekar/restaurant-management/config"
+	"github.com/gin-gonic/gin"
+)
+
+// Cors answers preflight requests and sets the CORS headers for the allowed origins.
+// Requests from other origins go through untouched, browsers then refuse the response.
+func Cors(cfg config.Cors) gin.HandlerFunc {
+	anyOrigin := false
+	origins := map[string]bool{}
+	for _, origin := range cfg.Allowed_origins {
+		if origin == "*" {
+			anyOrigin = true
+		}
+		origins[strings.TrimRight(origin, "/")] = true
+	}
+	methods := strings.Join(cfg.Allowed_methods, ", ")
+	headers := strings.Join(cfg.Allowed_headers, ", ")
+	maxAge := strconv.Itoa(int(cfg.Max_age.Seconds()))
+
+	return func(ctx *gin.Context) {
+		origin := ctx.GetHeader("Origin")
+		if origin == "" || !(anyOrigin || origins[origin]) {
+			ctx.Next()
+			return
+		}
+
+		header := ctx.Writer.Header()
+		header.Add("Vary", "Origin")
+		// Credentials are never shared with "*", the origin is echoed back instead
+		if anyOrigin && !cfg.Allow_credentials {
+			header.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			header.Set("Access-Control-Allow-Origin", origin)
+		}
+		if cfg.Allow_credentials {
+			header.Set("Access-Control-Allow-Credentials", "true")
+		}
+		header.Set("Access-Control-Expose-Headers", "WWW-Authenticate, "+RequestIDHeader)
+
+		if ctx.Request.Method == http.MethodOptions && ctx.GetHeader("Access-Control-Request-Method") != "" {
+			header.Set("Access-Control-Allow-Methods", methods)
+			header.Set("Access-Control-Allow-Headers", headers)
+			header.Set("Access-Control-Max-Age", maxAge)
+			ctx.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+		ctx.Next()
+	}
+}
@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"log/slog"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/PranavMasekar/restaurant-management/logging"
+	"github.com/gin-gonic/gin"
+)
+
+// Header carrying the correlation ID, taken from the client when it sends one
+const RequestIDHeader = "X-Request-ID"
+
+// Request IDs from clients are only trusted when they cannot mess up the logs
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// RequestID gives every request a correlation ID, echoes it in the response and puts it on
+// the request context, where the logger, MongoDB commands and outgoing mail pick it up
+func RequestID() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		requestID := ctx.GetHeader(RequestIDHeader)
+		if !validRequestID.MatchString(requestID) {
+			requestID = logging.NewRequestID()
+		}
+		ctx.Header(RequestIDHeader, requestID)
+		ctx.Request = ctx.Request.WithContext(logging.WithRequestID(ctx.Request.Context(), requestID))
+		ctx.Next()
+	}
+}
+
+// Logger writes one structured line per request once it has been answered. The request and
+// user IDs come from the request context, Authentication adds the user to it.
+func Logger() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		start := time.Now()
+		ctx.Next()
+
+		status := ctx.Writer.Status()
+		level := slog.LevelInfo
+		switch {
+		case status >= 500:
+			level = slog.LevelError
+		case status >= 400:
+			level = slog.LevelWarn
+		}
+		attrs := []slog.Attr{
+			slog.String("method", ctx.Request.Method),
+			slog.String("route", ctx.FullPath()),
+			slog.String("path", ctx.Request.URL.Path),
+			slog.Int("status", status),
+			slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.Int("bytes", ctx.Writer.Size()),
+			slog.String("client_ip", ctx.ClientIP()),
+		}
+		if len(ctx.Errors) > 0 {
+			errs := make([]string, len(ctx.Errors))
+			for i, err := range ctx.Errors {
+				errs[i] = err.Error()
+			}
+			attrs = append(attrs, slog.String("error", strings.Join(errs, "; ")))
+		}
+		slog.LogAttrs(ctx.Request.Context(), level, "request", attrs...)
+	}
+}
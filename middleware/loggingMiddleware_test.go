@@ -0,0 +1,114 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/PranavMasekar/restaurant-management/logging"
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequestID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name   string
+		header string
+		kept   bool
+	}{
+		{"from the client", "req-42.a_b", true},
+		{"none", "", false},
+		{"spaces", "req 42", false},
+		{"line break", "req\nlevel=error", false},
+		{"too long", strings.Repeat("a", 65), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var inContext string
+			router := gin.New()
+			router.Use(RequestID())
+			router.GET("/foods", func(ctx *gin.Context) {
+				inContext = logging.RequestID(ctx.Request.Context())
+			})
+			req := httptest.NewRequest(http.MethodGet, "/foods", nil)
+			if tt.header != "" {
+				req.Header.Set(RequestIDHeader, tt.header)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			echoed := rec.Header().Get(RequestIDHeader)
+			if echoed == "" || echoed != inContext {
+				t.Fatalf("echoed %q, the request context holds %q", echoed, inContext)
+			}
+			if (echoed == tt.header) != tt.kept {
+				t.Fatalf("request ID = %q for header %q, want it kept %v", echoed, tt.header, tt.kept)
+			}
+		})
+	}
+}
+
+func TestLogger(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var out bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(logging.New(&out, "info"))
+
+	router := gin.New()
+	router.Use(RequestID(), Logger())
+	router.GET("/foods/:food_id", func(ctx *gin.Context) {
+		switch ctx.Param("food_id") {
+		case "missing":
+			ctx.Error(errors.New("food not found"))
+			ctx.Status(http.StatusNotFound)
+		case "broken":
+			ctx.Error(errors.New("cursor died"))
+			ctx.Status(http.StatusInternalServerError)
+		default:
+			ctx.String(http.StatusOK, "ok")
+		}
+	})
+
+	tests := []struct {
+		path  string
+		level string
+		error string
+	}{
+		{"/foods/1", "INFO", ""},
+		{"/foods/missing", "WARN", "food not found"},
+		{"/foods/broken", "ERROR", "cursor died"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			out.Reset()
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set(RequestIDHeader, "req-1")
+			router.ServeHTTP(httptest.NewRecorder(), req)
+
+			var line map[string]interface{}
+			if err := json.Unmarshal(out.Bytes(), &line); err != nil {
+				t.Fatalf("logged %q: %v", out.String(), err)
+			}
+			want := map[string]interface{}{
+				"msg": "request", "level": tt.level, "request_id": "req-1", "method": "GET",
+				"route": "/foods/:food_id", "path": tt.path,
+			}
+			for key, value := range want {
+				if line[key] != value {
+					t.Fatalf("%s = %v, want %v in %s", key, line[key], value, out.String())
+				}
+			}
+			if errorText, _ := line["error"].(string); errorText != tt.error {
+				t.Fatalf("error = %q, want %q", errorText, tt.error)
+			}
+			if _, ok := line["latency_ms"]; !ok {
+				t.Fatalf("no latency in %s", out.String())
+			}
+		})
+	}
+}
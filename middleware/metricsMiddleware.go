@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/PranavMasekar/restaurant-management/metrics"
+	"github.com/gin-gonic/gin"
+)
+
+// Metrics counts and times the requests per route. Paths without a route share the
+// "unmatched" label so that scanners cannot create a series per URL.
+func Metrics() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		start := time.Now()
+		metrics.HttpRequestsInFlight.Inc()
+		defer metrics.HttpRequestsInFlight.Dec()
+
+		ctx.Next()
+
+		route := ctx.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		metrics.HttpRequests.WithLabelValues(ctx.Request.Method, route, strconv.Itoa(ctx.Writer.Status())).Inc()
+		metrics.HttpRequestDuration.WithLabelValues(ctx.Request.Method, route).Observe(time.Since(start).Seconds())
+	}
+}
@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"runtime/debug"
+	"syscall"
+
+	"github.com/PranavMasekar/restaurant-management/apperror"
+	"github.com/gin-gonic/gin"
+)
+
+// Recovery turns a panic in a handler into a 500 response in the usual error envelope,
+// so one bad request cannot take the server down. The stack trace is logged.
+func Recovery() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			// A client that went away is not worth a stack trace, and cannot be answered anyway
+			if err, ok := recovered.(error); ok && brokenConnection(err) {
+				slog.WarnContext(ctx.Request.Context(), "client disconnected", "path", ctx.Request.URL.Path, "error", err)
+				ctx.Abort()
+				return
+			}
+			slog.ErrorContext(ctx.Request.Context(), "panic while handling the request",
+				"path", ctx.Request.URL.Path, "panic", fmt.Sprint(recovered), "stack", string(debug.Stack()))
+			if ctx.Writer.Written() {
+				ctx.Abort()
+				return
+			}
+			apperror.Respond(ctx, apperror.Internal("something went wrong, please try again", nil))
+		}()
+		ctx.Next()
+	}
+}
+
+func brokenConnection(err error) bool {
+	var opErr *net.OpError
+	if !errors.As(err, &opErr) {
+		return false
+	}
+	return errors.Is(opErr, syscall.EPIPE) || errors.Is(opErr, syscall.ECONNRESET)
+}
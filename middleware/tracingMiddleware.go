@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/PranavMasekar/restaurant-management/tracing"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Probes and scrapes would fill the traces with nothing worth looking at
+var untracedPaths = map[string]bool{"/healthz": true, "/readyz": true, "/metrics": true}
+
+// Tracing starts a server span for each request, continuing the trace of the caller when it
+// sent a traceparent header. Handlers get the span through the request context, so the
+// MongoDB commands they run become its children.
+func Tracing() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if untracedPaths[ctx.Request.URL.Path] {
+			ctx.Next()
+			return
+		}
+
+		route := ctx.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		parent := otel.GetTextMapPropagator().Extract(ctx.Request.Context(), propagation.HeaderCarrier(ctx.Request.Header))
+		c, span := tracing.Tracer().Start(parent, ctx.Request.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(ctx.Request.Method),
+				semconv.HTTPRoute(route),
+				semconv.URLPath(ctx.Request.URL.Path),
+				semconv.ClientAddress(ctx.ClientIP()),
+			),
+		)
+		defer span.End()
+		ctx.Request = ctx.Request.WithContext(c)
+
+		ctx.Next()
+
+		status := ctx.Writer.Status()
+		span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+		for _, err := range ctx.Errors {
+			span.RecordError(err.Err)
+		}
+		// Client errors are the caller's doing, only server errors fail the span
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// recordSpans installs a tracer provider keeping the ended spans until the test is over
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	provider, propagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(provider)
+		otel.SetTextMapPropagator(propagator)
+	})
+	return recorder
+}
+
+func attributeValue(span sdktrace.ReadOnlySpan, key attribute.Key) attribute.Value {
+	for _, kv := range span.Attributes() {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestTracing(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	const caller = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	tests := []struct {
+		name        string
+		path        string
+		traceparent string
+		span        string
+		status      int64
+		failed      bool
+	}{
+		{"route", "/foods/1", "", "GET /foods/:food_id", http.StatusOK, false},
+		{"client error", "/foods/missing", "", "GET /foods/:food_id", http.StatusNotFound, false},
+		{"server error", "/foods/broken", "", "GET /foods/:food_id", http.StatusInternalServerError, true},
+		{"unmatched", "/nothing/here", "", "GET unmatched", http.StatusNotFound, false},
+		{"continued trace", "/foods/1", caller, "GET /foods/:food_id", http.StatusOK, false},
+		{"probe", "/healthz", "", "", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := recordSpans(t)
+			var handlerSpan trace.SpanContext
+			router := gin.New()
+			router.Use(Tracing())
+			router.GET("/healthz", func(ctx *gin.Context) { ctx.Status(http.StatusOK) })
+			router.GET("/foods/:food_id", func(ctx *gin.Context) {
+				handlerSpan = trace.SpanContextFromContext(ctx.Request.Context())
+				switch ctx.Param("food_id") {
+				case "missing":
+					ctx.Status(http.StatusNotFound)
+				case "broken":
+					ctx.Status(http.StatusInternalServerError)
+				default:
+					ctx.Status(http.StatusOK)
+				}
+			})
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.traceparent != "" {
+				req.Header.Set("traceparent", tt.traceparent)
+			}
+			router.ServeHTTP(httptest.NewRecorder(), req)
+
+			spans := recorder.Ended()
+			if tt.span == "" {
+				if len(spans) != 0 {
+					t.Fatalf("traced %d spans, want none", len(spans))
+				}
+				return
+			}
+			if len(spans) != 1 {
+				t.Fatalf("traced %d spans, want 1", len(spans))
+			}
+			span := spans[0]
+			if span.Name() != tt.span || span.SpanKind() != trace.SpanKindServer {
+				t.Fatalf("span = %s (%v), want the server span %s", span.Name(), span.SpanKind(), tt.span)
+			}
+			if got := attributeValue(span, "http.response.status_code").AsInt64(); got != tt.status {
+				t.Fatalf("status code = %d, want %d", got, tt.status)
+			}
+			if failed := span.Status().Code == codes.Error; failed != tt.failed {
+				t.Fatalf("span status = %v, want failed %v", span.Status(), tt.failed)
+			}
+			if handlerSpan.IsValid() && handlerSpan.SpanID() != span.SpanContext().SpanID() {
+				t.Fatal("the handler does not get the request span in its context")
+			}
+			if tt.traceparent != "" && (span.Parent().TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" || !span.Parent().IsRemote()) {
+				t.Fatalf("parent = %v, want the caller's span", span.Parent())
+			}
+		})
+	}
+}
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Device is a registered POS terminal staff can log in on with their PIN.
+// Only the SHA-256 hash of the device secret is stored.
+type Device struct {
+	ID            primitive.ObjectID `bson:"_id"`
+	Name          *string            `json:"name" validate:"required,min=2,max=100"`
+	Secret_hash   string             `json:"-"`
+	Revoked       bool               `json:"revoked"`
+	Registered_by string             `json:"registered_by"`
+	Created_at    time.Time          `json:"created_at"`
+	Updated_at    time.Time          `json:"updated_at"`
+	Device_id     string             `json:"device_id"`
+}
@@ -3,16 +3,44 @@ package models
 import (
 	"time"
 
+	"github.com/PranavMasekar/restaurant-management/money"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// Food is a dish of a menu. The staff set In_stock to false when the kitchen runs out of it,
+// foods stored without the field are in stock. Tax_class, "standard" unless set, tells which
+// VAT or sales tax rate applies to it. Modifier_groups are the choices offered with the food,
+// like its size, add-ons or removals.
 type Food struct {
-	ID         primitive.ObjectID `bson:"_id"`
-	Name       *string            `json:"name" validate:"required,min=2,max=100"`
-	Price      *float64           `json:"price" validate:"required"`
-	Food_image *string            `json:"food_image" validate:"required"`
-	Created_at time.Time          `json:"created_at"`
-	Updated_at time.Time          `json:"updated_at"`
-	Food_id    string             `json:"food_id"`
-	Menu_id    *string            `json:"menu_id" validate:"required"`
+	ID              primitive.ObjectID `bson:"_id"`
+	Name            *string            `json:"name" validate:"required,min=2,max=100"`
+	Price           *money.Money       `json:"price" validate:"required"`
+	Food_image      *string            `json:"food_image" validate:"required"`
+	Created_at      time.Time          `json:"created_at"`
+	Updated_at      time.Time          `json:"updated_at"`
+	Food_id         string             `json:"food_id"`
+	Menu_id         *string            `json:"menu_id" validate:"required"`
+	In_stock        *bool              `json:"in_stock"`
+	Tax_class       *string            `json:"tax_class" validate:"omitempty,max=32"`
+	Modifier_groups []ModifierGroup    `json:"modifier_groups" validate:"omitempty,dive"`
+}
+
+// ModifierGroup is a choice offered with a food. Customers pick between Min_selections and
+// Max_selections of its options, at least one when it is Required. A Max_selections of 0
+// allows every option.
+type ModifierGroup struct {
+	Group_id       string           `json:"group_id" validate:"required,max=64"`
+	Name           string           `json:"name" validate:"required,max=100"`
+	Required       bool             `json:"required"`
+	Min_selections int              `json:"min_selections" validate:"min=0"`
+	Max_selections int              `json:"max_selections" validate:"min=0"`
+	Options        []ModifierOption `json:"options" validate:"required,min=1,dive"`
+}
+
+// ModifierOption is one of the options of a group. Price_delta is added to the price of the
+// food, it is negative for removals that make it cheaper and free when not set.
+type ModifierOption struct {
+	Option_id   string       `json:"option_id" validate:"required,max=64"`
+	Name        string       `json:"name" validate:"required,max=100"`
+	Price_delta *money.Money `json:"price_delta"`
 }
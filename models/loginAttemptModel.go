@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// LoginAttempt counts failed logins for one email address or one client IP, Key is "email:<address>" or "ip:<address>"
+type LoginAttempt struct {
+	ID           primitive.ObjectID `bson:"_id"`
+	Key          string             `json:"key"`
+	Failures     int                `json:"failures"`
+	Lockouts     int                `json:"lockouts"`
+	Locked_until *time.Time         `json:"locked_until"`
+	Last_failure time.Time          `json:"last_failure"`
+}
@@ -6,13 +6,25 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// Menu is served between its start and end dates, when they are set, and during its
+// schedule, when it has one. The schedule is in the timezone of the menu, UTC by default.
 type Menu struct {
 	ID         primitive.ObjectID `bson:"_id"`
 	Name       string             `json:"name" validate:"required"`
 	Category   string             `json:"category" validate:"required"`
 	Start_Date *time.Time         `json:"start_date"`
 	End_Date   *time.Time         `json:"end_date"`
+	Timezone   *string            `json:"timezone" validate:"omitempty,timezone"`
+	Schedule   []MenuSchedule     `json:"schedule" validate:"omitempty,dive"`
 	Created_at time.Time          `json:"created_at"`
 	Updated_at time.Time          `json:"updated-at"`
 	Menu_id    string             `json:"menu_id"`
 }
+
+// MenuSchedule is a recurring day-part, like breakfast from 07:00 to 11:00 on weekdays.
+// A window ending before it starts runs past midnight into the next day.
+type MenuSchedule struct {
+	Days       []string `json:"days" validate:"required,min=1,dive,oneof=mon tue wed thu fri sat sun"`
+	Start_time string   `json:"start_time" validate:"required,clock"`
+	End_time   string   `json:"end_time" validate:"required,clock"`
+}
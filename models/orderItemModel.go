@@ -3,16 +3,33 @@ package models
 import (
 	"time"
 
+	"github.com/PranavMasekar/restaurant-management/money"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// OrderItem is a line of an order, Quantity times the food with the picked Modifiers. Unit_price,
+// the price of the food and of its modifiers, Food_name and Tax_class are copied from the food
+// when the line is created, so that editing the food never changes what was ordered.
 type OrderItem struct {
 	ID            primitive.ObjectID `bson:"_id"`
-	Quantity      *string            `json:"quantity" validate:"required,eq=S|eq=M|eq=L"`
-	Unit_price    *float64           `json:"unit_price" validate:"required"`
+	Quantity      *int               `json:"quantity" validate:"omitempty,min=1,max=99"`
+	Modifiers     []SelectedModifier `json:"modifiers" validate:"omitempty,dive"`
+	Unit_price    *money.Money       `json:"unit_price"`
+	Food_name     *string            `json:"food_name"`
+	Tax_class     *string            `json:"tax_class"`
 	Created_at    time.Time          `json:"created_at"`
 	Updated_at    time.Time          `json:"updated_at"`
 	Food_id       *string            `json:"food_id" validate:"required"`
 	Order_item_id string             `json:"order_item_id"`
 	Order_id      string             `json:"order_id" validate:"required"`
 }
+
+// SelectedModifier is an option picked for an order item. Clients send the group and option
+// ids, the names and the price are copied from the food.
+type SelectedModifier struct {
+	Group_id    string      `json:"group_id" validate:"required"`
+	Option_id   string      `json:"option_id" validate:"required"`
+	Group_name  string      `json:"group_name"`
+	Name        string      `json:"name"`
+	Price_delta money.Money `json:"price_delta"`
+}
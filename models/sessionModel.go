@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+)
+
+// Session is one login of a user on one device. Every refresh rotates the refresh token
+// stored here, so a previously used refresh token showing up again means it was stolen.
+type Session struct {
+	Session_id    string    `json:"session_id"`
+	Refresh_token string    `json:"-"`
+	Revoked       bool      `json:"revoked"`
+	Mfa           bool      `json:"mfa"`
+	Scope         string    `json:"scope"`
+	Device_id     string    `json:"device_id"`
+	Created_at    time.Time `json:"created_at"`
+	Updated_at    time.Time `json:"updated_at"`
+	Expires_at    time.Time `json:"expires_at"`
+}
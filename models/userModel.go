@@ -6,17 +6,37 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// Roles a member of staff can hold, stored in User_type and carried in the JWT
+const (
+	RoleAdmin   = "ADMIN"
+	RoleManager = "MANAGER"
+	RoleWaiter  = "WAITER"
+	RoleKitchen = "KITCHEN"
+	RoleCashier = "CASHIER"
+)
+
 type User struct {
-	ID           primitive.ObjectID `bson:"_id"`
-	First_name   *string            `json:"first_name" validate:"required,min=2,max=100"`
-	Last_name    *string            `json:"last_name" validate:"required,min=2,max=100"`
-	Password     *string            `json:"Password" validate:"required,min=6"`
-	Email        *string            `json:"email" validate:"email,required"`
-	Avatar       *string            `json:"avatar"`
-	Phone        *string            `json:"phone" validate:"required"`
-	Token        *string            `json:"token"`
-	RefreshToken *string            `json:"refresh_token"`
-	Created_at   time.Time          `json:"created_at"`
-	Updated_at   time.Time          `json:"updated_at"`
-	User_id      string             `json:"user_id"`
+	ID             primitive.ObjectID `bson:"_id"`
+	First_name     *string            `json:"first_name" validate:"required,min=2,max=100"`
+	Last_name      *string            `json:"last_name" validate:"required,min=2,max=100"`
+	Password       *string            `json:"Password" validate:"required,min=6"`
+	Email          *string            `json:"email" validate:"email,required"`
+	Email_verified bool               `json:"email_verified"`
+	Avatar         *string            `json:"avatar"`
+	Phone          *string            `json:"phone" validate:"required"`
+	User_type      *string            `json:"user_type" validate:"omitempty,eq=ADMIN|eq=MANAGER|eq=WAITER|eq=KITCHEN|eq=CASHIER"`
+	Token          *string            `json:"token"`
+	RefreshToken   *string            `json:"refresh_token"`
+	Sessions       []Session          `json:"sessions"`
+	Token_version  int                `json:"token_version"`
+	Totp_secret    *string            `json:"-"`
+	Totp_enabled   bool               `json:"totp_enabled"`
+	Totp_last_step int64              `json:"-"`
+	Recovery_codes []string           `json:"-"`
+	Pin_hash       *string            `json:"-"`
+	Pin_devices    []string           `json:"pin_devices"`
+	Deactivated_at *time.Time         `json:"deactivated_at"`
+	Created_at     time.Time          `json:"created_at"`
+	Updated_at     time.Time          `json:"updated_at"`
+	User_id        string             `json:"user_id"`
 }
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Purposes of a UserToken
+const (
+	PasswordResetToken     = "PASSWORD_RESET"
+	EmailVerificationToken = "EMAIL_VERIFICATION"
+)
+
+// UserToken is a single-use token mailed to a user at Email. Only the SHA-256 hash of the token is stored.
+type UserToken struct {
+	ID         primitive.ObjectID `bson:"_id"`
+	Token_hash string             `json:"-"`
+	Purpose    string             `json:"purpose"`
+	User_id    string             `json:"user_id"`
+	Email      string             `json:"email"`
+	Expires_at time.Time          `json:"expires_at"`
+	Used_at    *time.Time         `json:"used_at"`
+	Created_at time.Time          `json:"created_at"`
+}
@@ -0,0 +1,250 @@
+package money
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"regexp"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// DefaultCurrency is the currency of the restaurant. Amounts sent or stored without one, like
+// the prices written before they had a currency, are in it. main sets it from the configuration.
+var DefaultCurrency = "USD"
+
+// Digits after the decimal point of the currencies that do not have two
+var exponents = map[string]int{
+	"BHD": 3, "CLP": 0, "ISK": 0, "JOD": 3, "JPY": 0, "KRW": 0,
+	"KWD": 3, "OMR": 3, "TND": 3, "UGX": 0, "VND": 0, "XAF": 0, "XOF": 0,
+}
+
+// Exponent is the number of digits after the decimal point of currency, 2 for most of them
+func Exponent(currency string) int {
+	if exponent, ok := exponents[currency]; ok {
+		return exponent
+	}
+	return 2
+}
+
+// Money is an exact amount, counted in the minor unit of its currency, like cents. It is stored
+// as {amount: Decimal128, currency} and sent as {"amount": "12.50", "currency": "EUR"}.
+type Money struct {
+	Minor    int64
+	Currency string
+}
+
+func New(minor int64, currency string) Money {
+	return Money{Minor: minor, Currency: currency}
+}
+
+// Amounts are plain decimals, big.Rat alone would also take fractions like "1/4" and exponents
+// like "1e100000000" that take ages to expand
+var amountPattern = regexp.MustCompile(`^-?\d+(\.\d+)?$`)
+
+// Longest amount Parse reads, an int64 has 19 digits
+const maxAmountLength = 32
+
+// Parse reads a decimal amount like "12.50" of currency. Amounts with more decimals than the
+// currency has are refused rather than rounded.
+func Parse(amount string, currency string) (Money, error) {
+	text := strings.TrimSpace(amount)
+	if len(text) > maxAmountLength {
+		return Money{}, fmt.Errorf("%q is too large", amount)
+	}
+	if !amountPattern.MatchString(text) {
+		return Money{}, fmt.Errorf("%q is not an amount", amount)
+	}
+	value, ok := new(big.Rat).SetString(text)
+	if !ok {
+		return Money{}, fmt.Errorf("%q is not an amount", amount)
+	}
+	return fromRat(value, amount, currency)
+}
+
+// fromDecimal reads a stored Decimal128 through its digits, whatever exponent it was written with
+func fromDecimal(d primitive.Decimal128, currency string) (Money, error) {
+	digits, exp, err := d.BigInt()
+	if err != nil {
+		return Money{}, fmt.Errorf("%s is not an amount: %w", d, err)
+	}
+	if exp < -maxAmountLength || exp > maxAmountLength {
+		return Money{}, fmt.Errorf("%s is out of range", d)
+	}
+	value := new(big.Rat).SetInt(digits)
+	scale := new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs(exp))), nil))
+	if exp < 0 {
+		value.Quo(value, scale)
+	} else {
+		value.Mul(value, scale)
+	}
+	return fromRat(value, d.String(), currency)
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// fromRat converts the value of amount to the minor unit of currency
+func fromRat(value *big.Rat, amount string, currency string) (Money, error) {
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(Exponent(currency))), nil)
+	value.Mul(value, new(big.Rat).SetInt(scale))
+	if !value.IsInt() {
+		return Money{}, fmt.Errorf("%q has more than %d decimals, the most %s allows", amount, Exponent(currency), currency)
+	}
+	if !value.Num().IsInt64() {
+		return Money{}, fmt.Errorf("%q is too large", amount)
+	}
+	return New(value.Num().Int64(), currency), nil
+}
+
+// FromFloat converts an amount written as a float, rounding it half away from zero to the
+// minor unit. Only the prices stored before Money existed should need it.
+func FromFloat(amount float64, currency string) Money {
+	return New(int64(math.Round(amount*math.Pow10(Exponent(currency)))), currency)
+}
+
+// Decode converts a value read into a bson.M, like the payment_due of an aggregation, to Money
+func Decode(value interface{}) (Money, error) {
+	raw, err := bson.Marshal(bson.M{"value": value})
+	if err != nil {
+		return Money{}, err
+	}
+	var wrapper struct {
+		Value Money `bson:"value"`
+	}
+	err = bson.Unmarshal(raw, &wrapper)
+	return wrapper.Value, err
+}
+
+// Add sums two amounts of the same currency. It fails rather than wrap around past an int64.
+func (m Money) Add(other Money) (Money, error) {
+	if m.Currency != other.Currency {
+		return m, fmt.Errorf("cannot add %s to %s", other.Currency, m.Currency)
+	}
+	sum := m.Minor + other.Minor
+	if (other.Minor > 0 && sum < m.Minor) || (other.Minor < 0 && sum > m.Minor) {
+		return m, fmt.Errorf("%v plus %v is too large", m, other)
+	}
+	return New(sum, m.Currency), nil
+}
+
+// Times is the amount of quantity units costing m each. It fails rather than wrap around past
+// an int64.
+func (m Money) Times(quantity int64) (Money, error) {
+	product := m.Minor * quantity
+	if m.Minor != 0 && (product/m.Minor != quantity || (m.Minor == -1 && quantity == math.MinInt64)) {
+		return m, fmt.Errorf("%d times %v is too large", quantity, m)
+	}
+	return New(product, m.Currency), nil
+}
+
+func (m Money) IsNegative() bool {
+	return m.Minor < 0
+}
+
+// Amount writes the amount with the digits of its currency, like "12.50"
+func (m Money) Amount() string {
+	return m.decimal().String()
+}
+
+func (m Money) String() string {
+	return m.Amount() + " " + m.Currency
+}
+
+// Float64 is the amount as a float, for the metrics. Never compute with it.
+func (m Money) Float64() float64 {
+	return float64(m.Minor) / math.Pow10(Exponent(m.Currency))
+}
+
+func (m Money) decimal() primitive.Decimal128 {
+	d, _ := primitive.ParseDecimal128FromBigInt(big.NewInt(m.Minor), -Exponent(m.Currency))
+	return d
+}
+
+type document struct {
+	Amount   primitive.Decimal128 `bson:"amount"`
+	Currency string               `bson:"currency"`
+}
+
+func (m Money) MarshalBSONValue() (bsontype.Type, []byte, error) {
+	return bson.MarshalValue(document{Amount: m.decimal(), Currency: m.Currency})
+}
+
+// UnmarshalBSONValue also reads the plain numbers prices were stored as before, in DefaultCurrency
+func (m *Money) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	value := bson.RawValue{Type: t, Value: data}
+	switch t {
+	case bsontype.EmbeddedDocument:
+		var stored document
+		if err := value.Unmarshal(&stored); err != nil {
+			return err
+		}
+		parsed, err := fromDecimal(stored.Amount, stored.Currency)
+		if err != nil {
+			return err
+		}
+		*m = parsed
+	case bsontype.Double:
+		*m = FromFloat(value.Double(), DefaultCurrency)
+	case bsontype.Int32:
+		*m = FromFloat(float64(value.Int32()), DefaultCurrency)
+	case bsontype.Int64:
+		*m = FromFloat(float64(value.Int64()), DefaultCurrency)
+	case bsontype.Decimal128:
+		parsed, err := fromDecimal(value.Decimal128(), DefaultCurrency)
+		if err != nil {
+			return err
+		}
+		*m = parsed
+	case bsontype.Null:
+		*m = Money{}
+	default:
+		return fmt.Errorf("cannot decode %s into an amount", t)
+	}
+	return nil
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]string{"amount": m.Amount(), "currency": m.Currency})
+}
+
+// UnmarshalJSON accepts {"amount": "12.50", "currency": "EUR"}, or a bare amount like 12.5 or
+// "12.50" in DefaultCurrency as clients sent before. Amounts are read from their text, never
+// through a float. Like the types of encoding/json, a null leaves the value unchanged.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	if strings.TrimSpace(string(data)) == "null" {
+		return nil
+	}
+	var object struct {
+		Amount   json.RawMessage `json:"amount"`
+		Currency string          `json:"currency"`
+	}
+	amount, currency := data, DefaultCurrency
+	if strings.HasPrefix(strings.TrimSpace(string(data)), "{") {
+		if err := json.Unmarshal(data, &object); err != nil {
+			return err
+		}
+		amount = object.Amount
+		if object.Currency != "" {
+			currency = strings.ToUpper(object.Currency)
+		}
+	}
+	text := strings.Trim(strings.TrimSpace(string(amount)), `"`)
+	if text == "" || text == "null" {
+		return fmt.Errorf("an amount is required")
+	}
+	parsed, err := Parse(text, currency)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
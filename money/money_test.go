@@ -0,0 +1,221 @@
+package money
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		amount   string
+		currency string
+		want     Money
+		fails    bool
+	}{
+		{"12.50", "USD", New(1250, "USD"), false},
+		{"12.5", "EUR", New(1250, "EUR"), false},
+		{" 3 ", "USD", New(300, "USD"), false},
+		{"-1.25", "USD", New(-125, "USD"), false},
+		{"0.1", "USD", New(10, "USD"), false},
+		{"1500", "JPY", New(1500, "JPY"), false},
+		{"1.234", "KWD", New(1234, "KWD"), false},
+		{"12.505", "USD", Money{}, true},
+		{"1.5", "JPY", Money{}, true},
+		{"twelve", "USD", Money{}, true},
+		{"", "USD", Money{}, true},
+		{"99999999999999999999", "USD", Money{}, true},
+		{"1/4", "USD", Money{}, true},
+		{"1e3", "USD", Money{}, true},
+		{"1e100000000", "USD", Money{}, true},
+		{"0x10", "USD", Money{}, true},
+		{"+5", "USD", Money{}, true},
+		{".5", "USD", Money{}, true},
+		{"5.", "USD", Money{}, true},
+		{"1" + strings.Repeat("0", 40), "USD", Money{}, true},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.amount, tt.currency)
+		if (err != nil) != tt.fails || got != tt.want {
+			t.Errorf("Parse(%q, %s) = %v, %v, want %v (fails %v)", tt.amount, tt.currency, got, err, tt.want, tt.fails)
+		}
+	}
+}
+
+func TestAmount(t *testing.T) {
+	tests := []struct {
+		money Money
+		want  string
+	}{
+		{New(1250, "USD"), "12.50"},
+		{New(5, "USD"), "0.05"},
+		{New(-125, "EUR"), "-1.25"},
+		{New(1500, "JPY"), "1500"},
+		{New(1234, "KWD"), "1.234"},
+	}
+	for _, tt := range tests {
+		if got := tt.money.Amount(); got != tt.want {
+			t.Errorf("%#v.Amount() = %q, want %q", tt.money, got, tt.want)
+		}
+	}
+}
+
+func TestAdd(t *testing.T) {
+	tests := []struct {
+		a, b  Money
+		want  Money
+		fails bool
+	}{
+		{New(1000, "USD"), New(150, "USD"), New(1150, "USD"), false},
+		{New(1000, "USD"), New(-1200, "USD"), New(-200, "USD"), false},
+		{New(1000, "USD"), New(150, "EUR"), New(1000, "USD"), true},
+		{New(1000, "USD"), Money{}, New(1000, "USD"), true},
+		{New(math.MaxInt64, "USD"), New(1, "USD"), New(math.MaxInt64, "USD"), true},
+		{New(math.MinInt64, "USD"), New(-1, "USD"), New(math.MinInt64, "USD"), true},
+	}
+	for _, tt := range tests {
+		got, err := tt.a.Add(tt.b)
+		if (err != nil) != tt.fails || got != tt.want {
+			t.Errorf("%v.Add(%v) = %v, %v, want %v (fails %v)", tt.a, tt.b, got, err, tt.want, tt.fails)
+		}
+	}
+}
+
+func TestTimes(t *testing.T) {
+	tests := []struct {
+		m        Money
+		quantity int64
+		want     Money
+		fails    bool
+	}{
+		{New(1150, "USD"), 3, New(3450, "USD"), false},
+		{New(-125, "USD"), 4, New(-500, "USD"), false},
+		{New(0, "USD"), math.MaxInt64, New(0, "USD"), false},
+		{New(math.MaxInt64/2+1, "USD"), 2, New(math.MaxInt64/2+1, "USD"), true},
+		{New(-1, "USD"), math.MinInt64, New(-1, "USD"), true},
+		{New(1<<40, "USD"), 1 << 30, New(1<<40, "USD"), true},
+	}
+	for _, tt := range tests {
+		got, err := tt.m.Times(tt.quantity)
+		if (err != nil) != tt.fails || got != tt.want {
+			t.Errorf("%v.Times(%d) = %v, %v, want %v (fails %v)", tt.m, tt.quantity, got, err, tt.want, tt.fails)
+		}
+	}
+}
+
+func TestFromFloat(t *testing.T) {
+	tests := []struct {
+		amount float64
+		want   Money
+	}{
+		{12.5, New(1250, "USD")},
+		{0.1 + 0.2, New(30, "USD")},
+		{19.99, New(1999, "USD")},
+		{-2.5, New(-250, "USD")},
+	}
+	for _, tt := range tests {
+		if got := FromFloat(tt.amount, "USD"); got != tt.want {
+			t.Errorf("FromFloat(%v) = %v, want %v", tt.amount, got, tt.want)
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	tests := []struct {
+		body  string
+		want  Money
+		fails bool
+	}{
+		{`{"amount":"12.50","currency":"EUR"}`, New(1250, "EUR"), false},
+		{`{"amount":12.5,"currency":"eur"}`, New(1250, "EUR"), false},
+		{`{"amount":"12.50"}`, New(1250, DefaultCurrency), false},
+		{`12.5`, New(1250, DefaultCurrency), false},
+		{`"12.50"`, New(1250, DefaultCurrency), false},
+		{`{"currency":"EUR"}`, Money{}, true},
+		{`{"amount":null,"currency":"EUR"}`, Money{}, true},
+		{`{"amount":"12.505","currency":"EUR"}`, Money{}, true},
+		{`"twelve"`, Money{}, true},
+		{`1e3`, Money{}, true},
+		{`"1/4"`, Money{}, true},
+	}
+	for _, tt := range tests {
+		var got Money
+		err := json.Unmarshal([]byte(tt.body), &got)
+		if (err != nil) != tt.fails || got != tt.want {
+			t.Errorf("unmarshal %s = %v, %v, want %v (fails %v)", tt.body, got, err, tt.want, tt.fails)
+		}
+		if tt.fails {
+			continue
+		}
+		raw, err := json.Marshal(got)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var back Money
+		if err = json.Unmarshal(raw, &back); err != nil || back != got {
+			t.Errorf("round trip of %v through %s = %v, %v", got, raw, back, err)
+		}
+	}
+	// A null leaves the value alone, as it does for the types of encoding/json
+	kept := New(150, "EUR")
+	if err := json.Unmarshal([]byte(`null`), &kept); err != nil || kept != New(150, "EUR") {
+		t.Errorf("unmarshal null = %v, %v, want the value unchanged", kept, err)
+	}
+	var modifier struct {
+		Price_delta Money `json:"price_delta"`
+	}
+	if err := json.Unmarshal([]byte(`{"price_delta":null}`), &modifier); err != nil || modifier.Price_delta != (Money{}) {
+		t.Errorf("unmarshal a null field = %v, %v, want the zero Money", modifier.Price_delta, err)
+	}
+	if raw, _ := json.Marshal(New(1250, "EUR")); string(raw) != `{"amount":"12.50","currency":"EUR"}` {
+		t.Errorf("marshal = %s", raw)
+	}
+}
+
+func TestBSON(t *testing.T) {
+	decimal, _ := primitive.ParseDecimal128("12.5")
+	// Aggregations may write decimals with a positive exponent, that Parse would not read
+	scientific, _ := primitive.ParseDecimal128("1.25E+3")
+	tests := []struct {
+		name   string
+		stored interface{}
+		want   Money
+	}{
+		{"document", New(1250, "EUR"), New(1250, "EUR")},
+		{"yen", New(1500, "JPY"), New(1500, "JPY")},
+		{"negative", New(-125, "USD"), New(-125, "USD")},
+		{"legacy double", 12.5, New(1250, DefaultCurrency)},
+		{"legacy int32", int32(12), New(1200, DefaultCurrency)},
+		{"legacy int64", int64(12), New(1200, DefaultCurrency)},
+		{"legacy decimal", decimal, New(1250, DefaultCurrency)},
+		{"decimal with an exponent", scientific, New(125000, DefaultCurrency)},
+		{"null", nil, Money{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw, err := bson.Marshal(bson.M{"price": tt.stored})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got struct {
+				Price Money `bson:"price"`
+			}
+			if err = bson.Unmarshal(raw, &got); err != nil || got.Price != tt.want {
+				t.Fatalf("decoded %v, %v, want %v", got.Price, err, tt.want)
+			}
+		})
+	}
+
+	// Amounts are stored as decimals, never as floats
+	raw, _ := bson.Marshal(bson.M{"price": New(1250, "EUR")})
+	if kind := bson.Raw(raw).Lookup("price", "amount").Type; kind != bson.TypeDecimal128 {
+		t.Fatalf("amount stored as %v, want a decimal", kind)
+	}
+	if _, err := Decode(bson.M{"amount": decimal, "currency": "EUR"}); err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+}
@@ -0,0 +1,43 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/PranavMasekar/restaurant-management/models"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// DeviceRepository stores the registered POS terminals
+type DeviceRepository interface {
+	List(c context.Context) ([]models.Device, error)
+	FindById(c context.Context, deviceId string) (models.Device, error)
+	Create(c context.Context, device models.Device) error
+	// Update sets the given fields, ErrNotFound when there is no such device
+	Update(c context.Context, deviceId string, set bson.D) error
+}
+
+type deviceRepository struct {
+	store store
+}
+
+func (r deviceRepository) List(c context.Context) ([]models.Device, error) {
+	documents, err := r.store.find(c, bson.D{}, findOptions{sort: bson.D{{Key: "_id", Value: 1}}})
+	if err != nil {
+		return nil, err
+	}
+	devices := []models.Device{}
+	return devices, decodeAll(documents, &devices)
+}
+
+func (r deviceRepository) FindById(c context.Context, deviceId string) (device models.Device, err error) {
+	err = r.store.findOne(c, bson.D{{Key: "device_id", Value: deviceId}}, &device)
+	return device, err
+}
+
+func (r deviceRepository) Create(c context.Context, device models.Device) error {
+	return r.store.insert(c, device)
+}
+
+func (r deviceRepository) Update(c context.Context, deviceId string, set bson.D) error {
+	return r.store.update(c, bson.D{{Key: "device_id", Value: deviceId}}, set)
+}
@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/PranavMasekar/restaurant-management/models"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// FoodRepository stores the dishes of the menus
+type FoodRepository interface {
+	List(c context.Context, query ListQuery, p Pagination) ([]bson.M, int64, error)
+	FindById(c context.Context, foodId string) (models.Food, error)
+	Create(c context.Context, food models.Food) error
+	// Update sets the given fields, ErrNotFound when there is no such food
+	Update(c context.Context, foodId string, set bson.D) error
+	// ByMenus returns the foods of the given menus
+	ByMenus(c context.Context, menuIds []string) ([]models.Food, error)
+}
+
+type foodRepository struct {
+	store store
+}
+
+func (r foodRepository) List(c context.Context, query ListQuery, p Pagination) ([]bson.M, int64, error) {
+	return paginate(c, r.store, query, p)
+}
+
+func (r foodRepository) FindById(c context.Context, foodId string) (food models.Food, err error) {
+	err = r.store.findOne(c, bson.D{{Key: "food_id", Value: foodId}}, &food)
+	return food, err
+}
+
+func (r foodRepository) Create(c context.Context, food models.Food) error {
+	return r.store.insert(c, food)
+}
+
+func (r foodRepository) Update(c context.Context, foodId string, set bson.D) error {
+	return r.store.update(c, bson.D{{Key: "food_id", Value: foodId}}, set)
+}
+
+func (r foodRepository) ByMenus(c context.Context, menuIds []string) ([]models.Food, error) {
+	ids := bson.A{}
+	for _, menuId := range menuIds {
+		ids = append(ids, menuId)
+	}
+	documents, err := r.store.find(c, bson.D{{Key: "menu_id", Value: bson.D{{Key: "$in", Value: ids}}}},
+		findOptions{sort: bson.D{{Key: "name", Value: 1}}})
+	if err != nil {
+		return nil, err
+	}
+	foods := []models.Food{}
+	return foods, decodeAll(documents, &foods)
+}
@@ -0,0 +1,38 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/PranavMasekar/restaurant-management/models"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// InvoiceRepository stores the invoices of the orders, listed with keyset cursors
+type InvoiceRepository interface {
+	List(c context.Context, query ListQuery, p Pagination) ([]bson.M, KeysetPage, error)
+	FindById(c context.Context, invoiceId string) (models.Invoice, error)
+	Create(c context.Context, invoice models.Invoice) error
+	// Update sets the given fields, ErrNotFound when there is no such invoice
+	Update(c context.Context, invoiceId string, set bson.D) error
+}
+
+type invoiceRepository struct {
+	store store
+}
+
+func (r invoiceRepository) List(c context.Context, query ListQuery, p Pagination) ([]bson.M, KeysetPage, error) {
+	return paginateByCursor(c, r.store, query, p)
+}
+
+func (r invoiceRepository) FindById(c context.Context, invoiceId string) (invoice models.Invoice, err error) {
+	err = r.store.findOne(c, bson.D{{Key: "invoice_id", Value: invoiceId}}, &invoice)
+	return invoice, err
+}
+
+func (r invoiceRepository) Create(c context.Context, invoice models.Invoice) error {
+	return r.store.insert(c, invoice)
+}
+
+func (r invoiceRepository) Update(c context.Context, invoiceId string, set bson.D) error {
+	return r.store.update(c, bson.D{{Key: "invoice_id", Value: invoiceId}}, set)
+}
@@ -0,0 +1,143 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/PranavMasekar/restaurant-management/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// LoginAttemptRepository counts the failures of the throttled keys, like an email or a client IP
+type LoginAttemptRepository interface {
+	// Locked returns the attempts of the keys that are locked at at
+	Locked(c context.Context, keys []string, at time.Time) ([]models.LoginAttempt, error)
+	FindByKey(c context.Context, key string) (models.LoginAttempt, error)
+	Delete(c context.Context, key string) error
+	// RecordFailure counts a failure of key at at, forgetting the failures older than window,
+	// and returns the updated attempt
+	RecordFailure(c context.Context, key string, at time.Time, window time.Duration) (models.LoginAttempt, error)
+	// Lock refuses key until until and starts counting its failures again
+	Lock(c context.Context, key string, until time.Time) error
+}
+
+type loginAttemptRepository struct {
+	store store
+}
+
+func (r loginAttemptRepository) Locked(c context.Context, keys []string, at time.Time) ([]models.LoginAttempt, error) {
+	documents, err := r.store.find(c, bson.D{
+		{Key: "key", Value: bson.D{{Key: "$in", Value: keys}}},
+		{Key: "locked_until", Value: bson.D{{Key: "$gt", Value: at}}},
+	}, findOptions{})
+	if err != nil {
+		return nil, err
+	}
+	attempts := []models.LoginAttempt{}
+	return attempts, decodeAll(documents, &attempts)
+}
+
+func (r loginAttemptRepository) FindByKey(c context.Context, key string) (attempt models.LoginAttempt, err error) {
+	err = r.store.findOne(c, bson.D{{Key: "key", Value: key}}, &attempt)
+	return attempt, err
+}
+
+func (r loginAttemptRepository) Delete(c context.Context, key string) error {
+	return r.store.delete(c, bson.D{{Key: "key", Value: key}})
+}
+
+type mongoLoginAttemptRepository struct {
+	loginAttemptRepository
+	collection *mongo.Collection
+}
+
+func (r mongoLoginAttemptRepository) RecordFailure(c context.Context, key string, at time.Time, window time.Duration) (models.LoginAttempt, error) {
+	var attempt models.LoginAttempt
+	_, err := r.collection.UpdateOne(
+		c,
+		bson.M{"key": key, "last_failure": bson.M{"$lt": at.Add(-window)}},
+		bson.M{"$set": bson.M{"failures": 0}},
+	)
+	if err != nil {
+		return attempt, err
+	}
+	increment := func() error {
+		return r.collection.FindOneAndUpdate(
+			c,
+			bson.M{"key": key},
+			bson.M{
+				"$inc": bson.M{"failures": 1},
+				"$set": bson.M{"last_failure": at},
+			},
+			options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+		).Decode(&attempt)
+	}
+	err = increment()
+	// A concurrent first failure inserted the counter and the unique index on key refused this
+	// one, which now finds the counter to increment
+	if mongo.IsDuplicateKeyError(err) {
+		err = increment()
+	}
+	return attempt, err
+}
+
+func (r mongoLoginAttemptRepository) Lock(c context.Context, key string, until time.Time) error {
+	_, err := r.collection.UpdateOne(
+		c,
+		bson.M{"key": key},
+		bson.M{
+			"$set": bson.M{"failures": 0, "locked_until": until},
+			"$inc": bson.M{"lockouts": 1},
+		},
+	)
+	return err
+}
+
+// memoryLoginAttemptRepository counts under mu what mongoLoginAttemptRepository counts with $inc
+type memoryLoginAttemptRepository struct {
+	loginAttemptRepository
+	mu *sync.Mutex
+}
+
+func (r memoryLoginAttemptRepository) RecordFailure(c context.Context, key string, at time.Time, window time.Duration) (models.LoginAttempt, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	attempt, err := r.FindByKey(c, key)
+	if err == ErrNotFound {
+		attempt = models.LoginAttempt{ID: primitive.NewObjectID(), Key: key, Failures: 1, Last_failure: at}
+		return attempt, r.store.insert(c, attempt)
+	}
+	if err != nil {
+		return attempt, err
+	}
+	if attempt.Last_failure.Before(at.Add(-window)) {
+		attempt.Failures = 0
+	}
+	attempt.Failures++
+	attempt.Last_failure = at
+	return attempt, r.store.update(c, bson.D{{Key: "key", Value: key}}, bson.D{
+		{Key: "failures", Value: attempt.Failures},
+		{Key: "last_failure", Value: at},
+	})
+}
+
+func (r memoryLoginAttemptRepository) Lock(c context.Context, key string, until time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	attempt, err := r.FindByKey(c, key)
+	if err == ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return r.store.update(c, bson.D{{Key: "key", Value: key}}, bson.D{
+		{Key: "failures", Value: 0},
+		{Key: "locked_until", Value: until},
+		{Key: "lockouts", Value: attempt.Lockouts + 1},
+	})
+}
@@ -0,0 +1,394 @@
+package repository
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// memoryStore keeps documents the way MongoDB would store them. It understands the part of the
+// query language the repositories use: dotted paths, equality, regular expressions, $eq, $ne,
+// $gt, $gte, $lt, $lte, $in, $and and $or.
+type memoryStore struct {
+	mu        *sync.RWMutex
+	documents *[]bson.M
+}
+
+func newMemoryStore() memoryStore {
+	return memoryStore{mu: &sync.RWMutex{}, documents: &[]bson.M{}}
+}
+
+func (s memoryStore) find(c context.Context, filter bson.D, opts findOptions) ([]bson.M, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	documents := []bson.M{}
+	for _, document := range *s.documents {
+		if matches(document, filter) {
+			documents = append(documents, document)
+		}
+	}
+	sort.SliceStable(documents, func(i, j int) bool {
+		for _, key := range opts.sort {
+			order, _ := compare(lookup(documents[i], key.Key), lookup(documents[j], key.Key))
+			if order != 0 {
+				if direction, _ := compare(key.Value, 0); direction < 0 {
+					return order > 0
+				}
+				return order < 0
+			}
+		}
+		return false
+	})
+
+	if opts.skip >= int64(len(documents)) {
+		return []bson.M{}, nil
+	}
+	documents = documents[opts.skip:]
+	if opts.limit > 0 && opts.limit < int64(len(documents)) {
+		documents = documents[:opts.limit]
+	}
+	results := make([]bson.M, len(documents))
+	for i, document := range documents {
+		results[i] = project(document, opts.projection)
+	}
+	return results, nil
+}
+
+func (s memoryStore) count(c context.Context, filter bson.D) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var total int64
+	for _, document := range *s.documents {
+		if matches(document, filter) {
+			total++
+		}
+	}
+	return total, nil
+}
+
+func (s memoryStore) findOne(c context.Context, filter bson.D, result interface{}) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, document := range *s.documents {
+		if matches(document, filter) {
+			raw, err := bson.Marshal(document)
+			if err != nil {
+				return err
+			}
+			return bson.Unmarshal(raw, result)
+		}
+	}
+	return ErrNotFound
+}
+
+func (s memoryStore) insert(c context.Context, documents ...interface{}) error {
+	normalized := make([]bson.M, len(documents))
+	for i, document := range documents {
+		raw, err := bson.Marshal(document)
+		if err != nil {
+			return err
+		}
+		if err = bson.Unmarshal(raw, &normalized[i]); err != nil {
+			return err
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	*s.documents = append(*s.documents, normalized...)
+	return nil
+}
+
+func (s memoryStore) update(c context.Context, filter bson.D, set bson.D) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, document := range *s.documents {
+		if matches(document, filter) {
+			for _, field := range set {
+				document[field.Key] = normalize(field.Value)
+			}
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (s memoryStore) delete(c context.Context, filter bson.D) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kept := []bson.M{}
+	for _, document := range *s.documents {
+		if !matches(document, filter) {
+			kept = append(kept, document)
+		}
+	}
+	*s.documents = kept
+	return nil
+}
+
+// normalize converts a Go value to what reading it back from BSON gives
+func normalize(value interface{}) interface{} {
+	raw, err := bson.Marshal(bson.M{"value": value})
+	if err != nil {
+		return value
+	}
+	var document bson.M
+	if err = bson.Unmarshal(raw, &document); err != nil {
+		return value
+	}
+	return document["value"]
+}
+
+func matches(document bson.M, filter bson.D) bool {
+	for _, condition := range filter {
+		if condition.Key == "$and" {
+			clauses, _ := normalize(condition.Value).(primitive.A)
+			for _, clause := range clauses {
+				if !matches(document, toD(clause)) {
+					return false
+				}
+			}
+			continue
+		}
+		if condition.Key == "$or" {
+			alternatives, _ := normalize(condition.Value).(primitive.A)
+			matched := false
+			for _, alternative := range alternatives {
+				if matches(document, toD(alternative)) {
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return false
+			}
+			continue
+		}
+		if !matchField(lookup(document, condition.Key), normalize(condition.Value)) {
+			return false
+		}
+	}
+	return true
+}
+
+// lookup follows a dotted path like price.amount into the embedded documents
+func lookup(document bson.M, path string) interface{} {
+	key, rest, nested := strings.Cut(path, ".")
+	if !nested {
+		return document[key]
+	}
+	embedded, ok := document[key].(primitive.M)
+	if !ok {
+		return nil
+	}
+	return lookup(embedded, rest)
+}
+
+func matchField(value interface{}, condition interface{}) bool {
+	if pattern, ok := condition.(primitive.Regex); ok {
+		text, isText := value.(string)
+		flags := ""
+		if pattern.Options != "" {
+			flags = "(?" + pattern.Options + ")"
+		}
+		expression, err := regexp.Compile(flags + pattern.Pattern)
+		return isText && err == nil && expression.MatchString(text)
+	}
+	operators, ok := condition.(primitive.M)
+	if !ok || !isOperatorDocument(operators) {
+		order, comparable := compare(value, condition)
+		return comparable && order == 0
+	}
+	for operator, operand := range operators {
+		order, comparable := compare(value, operand)
+		switch operator {
+		case "$eq":
+			if !comparable || order != 0 {
+				return false
+			}
+		case "$ne":
+			if comparable && order == 0 {
+				return false
+			}
+		case "$gt", "$gte", "$lt", "$lte":
+			// Range operators never match null or values of another kind
+			if !comparable || value == nil || operand == nil || !inRange(operator, order) {
+				return false
+			}
+		case "$in":
+			list, _ := operand.(primitive.A)
+			found := false
+			for _, item := range list {
+				if order, comparable := compare(value, item); comparable && order == 0 {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func inRange(operator string, order int) bool {
+	switch operator {
+	case "$gt":
+		return order > 0
+	case "$gte":
+		return order >= 0
+	case "$lt":
+		return order < 0
+	}
+	return order <= 0
+}
+
+func isOperatorDocument(document primitive.M) bool {
+	for key := range document {
+		if !strings.HasPrefix(key, "$") {
+			return false
+		}
+	}
+	return len(document) > 0
+}
+
+// compare orders two normalized values, comparable is false for values of different kinds.
+// A missing value equals null and sorts before everything else, like in MongoDB.
+func compare(a, b interface{}) (order int, comparable bool) {
+	if a == nil || b == nil {
+		switch {
+		case a == nil && b == nil:
+			return 0, true
+		case a == nil:
+			return -1, true
+		default:
+			return 1, true
+		}
+	}
+	if x, ok := number(a); ok {
+		y, ok := number(b)
+		if !ok {
+			return 0, false
+		}
+		return sign(x - y), true
+	}
+	switch x := a.(type) {
+	case string:
+		y, ok := b.(string)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(x, y), true
+	case bool:
+		y, ok := b.(bool)
+		if !ok {
+			return 0, false
+		}
+		if x == y {
+			return 0, true
+		}
+		if !x {
+			return -1, true
+		}
+		return 1, true
+	case primitive.DateTime:
+		y, ok := b.(primitive.DateTime)
+		if !ok {
+			return 0, false
+		}
+		return sign(float64(x) - float64(y)), true
+	case primitive.ObjectID:
+		y, ok := b.(primitive.ObjectID)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(x.Hex(), y.Hex()), true
+	}
+	return 0, false
+}
+
+func number(value interface{}) (float64, bool) {
+	switch n := value.(type) {
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	case primitive.Decimal128:
+		f, err := strconv.ParseFloat(n.String(), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func sign(x float64) int {
+	switch {
+	case x < 0:
+		return -1
+	case x > 0:
+		return 1
+	}
+	return 0
+}
+
+func toD(value interface{}) bson.D {
+	document, _ := value.(primitive.M)
+	keys := make([]string, 0, len(document))
+	for key := range document {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	d := bson.D{}
+	for _, key := range keys {
+		d = append(d, bson.E{Key: key, Value: document[key]})
+	}
+	return d
+}
+
+// project applies an inclusion or an exclusion projection to a copy of the document
+func project(document bson.M, projection bson.D) bson.M {
+	result := bson.M{}
+	if len(projection) == 0 {
+		for key, value := range document {
+			result[key] = value
+		}
+		return result
+	}
+	inclusion := false
+	for _, field := range projection {
+		if included, _ := compare(normalize(field.Value), 0); included != 0 {
+			inclusion = true
+		}
+	}
+	if inclusion {
+		result["_id"] = document["_id"]
+		for _, field := range projection {
+			if value, ok := document[field.Key]; ok {
+				result[field.Key] = value
+			}
+		}
+		return result
+	}
+	for key, value := range document {
+		if !projected(projection, key) {
+			result[key] = value
+		}
+	}
+	return result
+}
@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/PranavMasekar/restaurant-management/models"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// MenuRepository stores the menus foods belong to
+type MenuRepository interface {
+	List(c context.Context, query ListQuery, p Pagination) ([]bson.M, int64, error)
+	FindById(c context.Context, menuId string) (models.Menu, error)
+	Create(c context.Context, menu models.Menu) error
+	// Update sets the given fields, ErrNotFound when there is no such menu
+	Update(c context.Context, menuId string, set bson.D) error
+	// InEffect returns the menus whose start and end dates, when set, include at. Their
+	// schedules still have to be checked.
+	InEffect(c context.Context, at time.Time) ([]models.Menu, error)
+}
+
+type menuRepository struct {
+	store store
+}
+
+func (r menuRepository) List(c context.Context, query ListQuery, p Pagination) ([]bson.M, int64, error) {
+	return paginate(c, r.store, query, p)
+}
+
+func (r menuRepository) FindById(c context.Context, menuId string) (menu models.Menu, err error) {
+	err = r.store.findOne(c, bson.D{{Key: "menu_id", Value: menuId}}, &menu)
+	return menu, err
+}
+
+func (r menuRepository) Create(c context.Context, menu models.Menu) error {
+	return r.store.insert(c, menu)
+}
+
+func (r menuRepository) Update(c context.Context, menuId string, set bson.D) error {
+	return r.store.update(c, bson.D{{Key: "menu_id", Value: menuId}}, set)
+}
+
+func (r menuRepository) InEffect(c context.Context, at time.Time) ([]models.Menu, error) {
+	filter := bson.D{{Key: "$and", Value: bson.A{
+		bson.D{{Key: "$or", Value: bson.A{
+			bson.D{{Key: "start_date", Value: nil}},
+			bson.D{{Key: "start_date", Value: bson.D{{Key: "$lte", Value: at}}}},
+		}}},
+		bson.D{{Key: "$or", Value: bson.A{
+			bson.D{{Key: "end_date", Value: nil}},
+			bson.D{{Key: "end_date", Value: bson.D{{Key: "$gt", Value: at}}}},
+		}}},
+	}}}
+	documents, err := r.store.find(c, filter, findOptions{sort: bson.D{{Key: "name", Value: 1}}})
+	if err != nil {
+		return nil, err
+	}
+	menus := []models.Menu{}
+	return menus, decodeAll(documents, &menus)
+}
@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoStore struct {
+	collection *mongo.Collection
+}
+
+func (s mongoStore) find(c context.Context, filter bson.D, opts findOptions) ([]bson.M, error) {
+	findOpts := options.Find()
+	if len(opts.sort) > 0 {
+		findOpts.SetSort(opts.sort)
+	}
+	if opts.skip > 0 {
+		findOpts.SetSkip(opts.skip)
+	}
+	if opts.limit > 0 {
+		findOpts.SetLimit(opts.limit)
+	}
+	if len(opts.projection) > 0 {
+		findOpts.SetProjection(opts.projection)
+	}
+	cursor, err := s.collection.Find(c, filter, findOpts)
+	if err != nil {
+		return nil, err
+	}
+	documents := []bson.M{}
+	if err = cursor.All(c, &documents); err != nil {
+		return nil, err
+	}
+	return documents, nil
+}
+
+func (s mongoStore) count(c context.Context, filter bson.D) (int64, error) {
+	return s.collection.CountDocuments(c, filter)
+}
+
+func (s mongoStore) findOne(c context.Context, filter bson.D, result interface{}) error {
+	err := s.collection.FindOne(c, filter).Decode(result)
+	if err == mongo.ErrNoDocuments {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (s mongoStore) insert(c context.Context, documents ...interface{}) error {
+	if len(documents) == 1 {
+		_, err := s.collection.InsertOne(c, documents[0])
+		return err
+	}
+	_, err := s.collection.InsertMany(c, documents)
+	return err
+}
+
+func (s mongoStore) update(c context.Context, filter bson.D, set bson.D) error {
+	result, err := s.collection.UpdateOne(c, filter, bson.D{{Key: "$set", Value: set}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s mongoStore) delete(c context.Context, filter bson.D) error {
+	_, err := s.collection.DeleteMany(c, filter)
+	return err
+}
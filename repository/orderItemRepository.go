@@ -0,0 +1,270 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/PranavMasekar/restaurant-management/models"
+	"github.com/PranavMasekar/restaurant-management/money"
+	"github.com/PranavMasekar/restaurant-management/tracing"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// OrderItemRepository stores the lines of the orders, listed with keyset cursors
+type OrderItemRepository interface {
+	List(c context.Context, query ListQuery, p Pagination) ([]bson.M, KeysetPage, error)
+	FindById(c context.Context, orderItemId string) (models.OrderItem, error)
+	Create(c context.Context, orderItems ...models.OrderItem) error
+	// Update sets the given fields, ErrNotFound when there is no such order item
+	Update(c context.Context, orderItemId string, set bson.D) error
+	// ItemsByOrder joins the items of an order with their food and table. The result has a
+	// single document with the payment_due, the total_count, the table_number and the order_items,
+	// each with its quantity, its modifiers and its line_total. Items are priced with the snapshot
+	// taken when they were ordered.
+	ItemsByOrder(c context.Context, orderId string) ([]bson.M, error)
+}
+
+type orderItemRepository struct {
+	store store
+}
+
+func (r orderItemRepository) List(c context.Context, query ListQuery, p Pagination) ([]bson.M, KeysetPage, error) {
+	return paginateByCursor(c, r.store, query, p)
+}
+
+func (r orderItemRepository) FindById(c context.Context, orderItemId string) (orderItem models.OrderItem, err error) {
+	err = r.store.findOne(c, bson.D{{Key: "order_item_id", Value: orderItemId}}, &orderItem)
+	return orderItem, err
+}
+
+func (r orderItemRepository) Create(c context.Context, orderItems ...models.OrderItem) error {
+	documents := make([]interface{}, len(orderItems))
+	for i, orderItem := range orderItems {
+		documents[i] = orderItem
+	}
+	return r.store.insert(c, documents...)
+}
+
+func (r orderItemRepository) Update(c context.Context, orderItemId string, set bson.D) error {
+	return r.store.update(c, bson.D{{Key: "order_item_id", Value: orderItemId}}, set)
+}
+
+type mongoOrderItemRepository struct {
+	orderItemRepository
+	collection *mongo.Collection
+}
+
+func (r mongoOrderItemRepository) ItemsByOrder(c context.Context, orderId string) ([]bson.M, error) {
+	// The aggregate and the getMore commands reading its cursor are children of this span
+	c, span := tracing.Tracer().Start(c, "OrderItemRepository.ItemsByOrder", trace.WithAttributes(attribute.String("order_id", orderId)))
+	defer span.End()
+
+	cursor, err := r.collection.Aggregate(c, itemsByOrderPipeline(orderId))
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	var orderItems []bson.M
+	if err = cursor.All(c, &orderItems); err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	span.SetAttributes(attribute.Int("order_item_groups", len(orderItems)))
+	return orderItems, nil
+}
+
+// itemsByOrderPipeline joins, prices and groups the items of the order. Its $project stages
+// include fields, so the only field they may exclude is _id.
+func itemsByOrderPipeline(orderId string) mongo.Pipeline {
+	matchStage := bson.D{{Key: "$match", Value: bson.D{{Key: "order_id", Value: orderId}}}}
+
+	// lookup => used to look Up in particular collection i.e. food in this case
+	lookupFoodStage := bson.D{{Key: "$lookup", Value: bson.D{
+		{Key: "from", Value: "food"},
+		{Key: "localField", Value: "food_id"},
+		{Key: "foreignField", Value: "food_id"},
+		{Key: "as", Value: "food"},
+	}}}
+	// LookUp stage gives array and to perform actions on it we have to unwind the array
+	unwindFoodStage := bson.D{{Key: "$unwind", Value: bson.D{
+		{Key: "path", Value: "$food"},
+		{Key: "preserveNullAndEmptyArrays", Value: true},
+	}}}
+
+	lookupOrderStage := bson.D{{Key: "$lookup", Value: bson.D{
+		{Key: "from", Value: "order"},
+		{Key: "localField", Value: "order_id"},
+		{Key: "foreignField", Value: "order_id"},
+		{Key: "as", Value: "order"},
+	}}}
+	unwindOrderStage := bson.D{{Key: "$unwind", Value: bson.D{
+		{Key: "path", Value: "$order"},
+		{Key: "preserveNullAndEmptyArrays", Value: true},
+	}}}
+
+	lookupTableStage := bson.D{{Key: "$lookup", Value: bson.D{
+		{Key: "from", Value: "table"},
+		{Key: "localField", Value: "order.table_id"},
+		{Key: "foreignField", Value: "table_id"},
+		{Key: "as", Value: "table"},
+	}}}
+	unwindTableStage := bson.D{{Key: "$unwind", Value: bson.D{
+		{Key: "path", Value: "$table"},
+		{Key: "preserveNullAndEmptyArrays", Value: true},
+	}}}
+
+	// Items hold a snapshot of their food since they have a food_name, older ones are
+	// priced with what their food costs now. Prices are {amount: Decimal128, currency}.
+	snapshotted := bson.D{{Key: "$eq", Value: bson.A{bson.D{{Key: "$type", Value: "$food_name"}}, "string"}}}
+	priceStage := bson.D{{Key: "$addFields", Value: bson.D{
+		{Key: "price", Value: bson.D{{Key: "$cond", Value: bson.A{snapshotted, "$unit_price", "$food.price"}}}},
+		{Key: "quantity", Value: bson.D{{Key: "$ifNull", Value: bson.A{"$quantity", 1}}}},
+	}}}
+
+	projectStage := bson.D{{Key: "$project", Value: bson.D{
+		{Key: "amount", Value: "$price"},
+		{Key: "total_count", Value: 1},
+		{Key: "food_name", Value: bson.D{{Key: "$ifNull", Value: bson.A{"$food_name", "$food.name"}}}},
+		{Key: "food_image", Value: "$food.food_image"},
+		{Key: "tax_class", Value: bson.D{{Key: "$ifNull", Value: bson.A{"$tax_class", "$food.tax_class"}}}},
+		{Key: "table_number", Value: "$table.table_number"},
+		{Key: "table_id", Value: "$table.table_id"},
+		{Key: "order_id", Value: "$order.order_id"},
+		{Key: "price", Value: 1},
+		{Key: "quantity", Value: 1},
+		{Key: "modifiers", Value: bson.D{{Key: "$ifNull", Value: bson.A{"$modifiers", bson.A{}}}}},
+		{Key: "line_total", Value: bson.D{
+			{Key: "amount", Value: bson.D{{Key: "$multiply", Value: bson.A{"$price.amount", "$quantity"}}}},
+			{Key: "currency", Value: "$price.currency"},
+		}},
+	}}}
+
+	groupStage := bson.D{{Key: "$group", Value: bson.D{
+		{Key: "_id", Value: bson.D{
+			{Key: "order_id", Value: "$order_id"},
+			{Key: "table_id", Value: "$table_id"},
+			{Key: "table_number", Value: "$table_number"},
+		}},
+		// Decimal sums are exact, unlike the sums of doubles
+		{Key: "payment_due", Value: bson.D{{Key: "$sum", Value: "$line_total.amount"}}},
+		{Key: "currency", Value: bson.D{{Key: "$first", Value: "$line_total.currency"}}},
+		{Key: "total_count", Value: bson.D{{Key: "$sum", Value: 1}}},
+		{Key: "order_items", Value: bson.D{{Key: "$push", Value: "$$ROOT"}}},
+	}}}
+
+	projectStage2 := bson.D{{Key: "$project", Value: bson.D{
+		{Key: "_id", Value: 0},
+		{Key: "payment_due", Value: bson.D{
+			{Key: "amount", Value: "$payment_due"},
+			{Key: "currency", Value: "$currency"},
+		}},
+		{Key: "total_count", Value: 1},
+		{Key: "table_number", Value: "$_id.table_number"},
+		{Key: "order_items", Value: 1},
+	}}}
+
+	return mongo.Pipeline{
+		matchStage,
+		lookupFoodStage,
+		unwindFoodStage,
+		lookupOrderStage,
+		unwindOrderStage,
+		lookupTableStage,
+		unwindTableStage,
+		priceStage,
+		projectStage,
+		groupStage,
+		projectStage2,
+	}
+}
+
+type memoryOrderItemRepository struct {
+	orderItemRepository
+	items, foods, orders, tables memoryStore
+}
+
+// ItemsByOrder does in Go what the aggregation pipeline of mongoOrderItemRepository does
+func (r memoryOrderItemRepository) ItemsByOrder(c context.Context, orderId string) ([]bson.M, error) {
+	items, err := r.items.find(c, bson.D{{Key: "order_id", Value: orderId}}, findOptions{sort: bson.D{{Key: "_id", Value: 1}}})
+	if err != nil || len(items) == 0 {
+		return []bson.M{}, err
+	}
+
+	food := func(foodId interface{}) bson.M {
+		documents, _ := r.foods.find(c, bson.D{{Key: "food_id", Value: foodId}}, findOptions{limit: 1})
+		if len(documents) == 0 {
+			return bson.M{}
+		}
+		return documents[0]
+	}
+	order, table := bson.M{}, bson.M{}
+	if documents, _ := r.orders.find(c, bson.D{{Key: "order_id", Value: orderId}}, findOptions{limit: 1}); len(documents) > 0 {
+		order = documents[0]
+	}
+	if documents, _ := r.tables.find(c, bson.D{{Key: "table_id", Value: order["table_id"]}}, findOptions{limit: 1}); len(documents) > 0 && order["table_id"] != nil {
+		table = documents[0]
+	}
+
+	paymentDue, priced := money.New(0, money.DefaultCurrency), false
+	orderItems := bson.A{}
+	for _, item := range items {
+		itemFood := food(item["food_id"])
+		storedPrice, name, taxClass := itemFood["price"], itemFood["name"], itemFood["tax_class"]
+		if _, snapshotted := item["food_name"].(string); snapshotted {
+			storedPrice, name = item["unit_price"], item["food_name"]
+		}
+		if item["tax_class"] != nil {
+			taxClass = item["tax_class"]
+		}
+		quantity, modifiers := item["quantity"], item["modifiers"]
+		if quantity == nil {
+			quantity = int32(1)
+		}
+		if modifiers == nil {
+			modifiers = bson.A{}
+		}
+		// Like $sum, items without a price add nothing
+		var lineTotal interface{}
+		if storedPrice != nil {
+			unitPrice, err := money.Decode(storedPrice)
+			if err != nil {
+				return nil, err
+			}
+			units, _ := number(quantity)
+			total, err := unitPrice.Times(int64(units))
+			if err != nil {
+				return nil, err
+			}
+			if !priced {
+				paymentDue.Currency, priced = total.Currency, true
+			}
+			if paymentDue, err = paymentDue.Add(total); err != nil {
+				return nil, err
+			}
+			lineTotal = total
+		}
+		orderItems = append(orderItems, bson.M{
+			"_id":          item["_id"],
+			"amount":       storedPrice,
+			"food_name":    name,
+			"food_image":   itemFood["food_image"],
+			"tax_class":    taxClass,
+			"table_number": table["table_number"],
+			"table_id":     table["table_id"],
+			"order_id":     order["order_id"],
+			"price":        storedPrice,
+			"quantity":     quantity,
+			"modifiers":    modifiers,
+			"line_total":   lineTotal,
+		})
+	}
+	return []bson.M{{
+		"payment_due":  paymentDue,
+		"total_count":  int32(len(items)),
+		"table_number": table["table_number"],
+		"order_items":  orderItems,
+	}}, nil
+}
@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	"github.com/PranavMasekar/restaurant-management/models"
+	"github.com/PranavMasekar/restaurant-management/money"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// excluded tells whether a $project value drops its field rather than including or computing it
+func excluded(value interface{}) bool {
+	switch v := value.(type) {
+	case int:
+		return v == 0
+	case bool:
+		return !v
+	}
+	return false
+}
+
+func TestItemsByOrderPipelineProjections(t *testing.T) {
+	for i, stage := range itemsByOrderPipeline("order") {
+		if stage[0].Key != "$project" {
+			continue
+		}
+		var included, exclusions []string
+		for _, field := range stage[0].Value.(bson.D) {
+			if excluded(field.Value) {
+				exclusions = append(exclusions, field.Key)
+			} else {
+				included = append(included, field.Key)
+			}
+		}
+		// MongoDB refuses "Cannot do exclusion on field ... in inclusion projection"
+		for _, field := range exclusions {
+			if field != "_id" && len(included) > 0 {
+				t.Errorf("stage %d excludes %q next to the included %v", i, field, included)
+			}
+		}
+	}
+}
+
+func TestItemsByOrderMatchesThePipelineOutput(t *testing.T) {
+	c := context.Background()
+	repos := NewMemoryRepositories()
+	number, quantity, name, price := 7, 2, "Burger", money.New(1000, money.DefaultCurrency)
+	table := models.Table{ID: primitive.NewObjectID(), Table_id: "table", Table_number: &number}
+	order := models.Order{ID: primitive.NewObjectID(), Order_id: "order", Table_id: &table.Table_id}
+	item := models.OrderItem{ID: primitive.NewObjectID(), Order_item_id: "item", Order_id: "order", Food_name: &name, Unit_price: &price, Quantity: &quantity}
+	if err := repos.Tables.Create(c, table); err != nil {
+		t.Fatal(err)
+	}
+	if err := repos.Orders.Create(c, order); err != nil {
+		t.Fatal(err)
+	}
+	if err := repos.OrderItems.Create(c, item); err != nil {
+		t.Fatal(err)
+	}
+	groups, err := repos.OrderItems.ItemsByOrder(c, "order")
+	if err != nil || len(groups) != 1 {
+		t.Fatalf("ItemsByOrder = %v, %v, want one group", groups, err)
+	}
+
+	// The in-memory result has the fields the last $project leaves
+	pipeline := itemsByOrderPipeline("order")
+	var want []string
+	for _, field := range pipeline[len(pipeline)-1][0].Value.(bson.D) {
+		if !excluded(field.Value) {
+			want = append(want, field.Key)
+		}
+	}
+	var got []string
+	for key := range groups[0] {
+		got = append(got, key)
+	}
+	sort.Strings(want)
+	sort.Strings(got)
+	if len(got) != len(want) {
+		t.Fatalf("ItemsByOrder fields = %v, the pipeline returns %v", got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("ItemsByOrder fields = %v, the pipeline returns %v", got, want)
+		}
+	}
+	if due, err := money.Decode(groups[0]["payment_due"]); err != nil || due != money.New(2000, money.DefaultCurrency) {
+		t.Fatalf("payment_due = %v, %v, want 20.00", due, err)
+	}
+}
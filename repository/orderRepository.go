@@ -0,0 +1,38 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/PranavMasekar/restaurant-management/models"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// OrderRepository stores the orders taken at the tables, listed with keyset cursors
+type OrderRepository interface {
+	List(c context.Context, query ListQuery, p Pagination) ([]bson.M, KeysetPage, error)
+	FindById(c context.Context, orderId string) (models.Order, error)
+	Create(c context.Context, order models.Order) error
+	// Update sets the given fields, ErrNotFound when there is no such order
+	Update(c context.Context, orderId string, set bson.D) error
+}
+
+type orderRepository struct {
+	store store
+}
+
+func (r orderRepository) List(c context.Context, query ListQuery, p Pagination) ([]bson.M, KeysetPage, error) {
+	return paginateByCursor(c, r.store, query, p)
+}
+
+func (r orderRepository) FindById(c context.Context, orderId string) (order models.Order, err error) {
+	err = r.store.findOne(c, bson.D{{Key: "order_id", Value: orderId}}, &order)
+	return order, err
+}
+
+func (r orderRepository) Create(c context.Context, order models.Order) error {
+	return r.store.insert(c, order)
+}
+
+func (r orderRepository) Update(c context.Context, orderId string, set bson.D) error {
+	return r.store.update(c, bson.D{{Key: "order_id", Value: orderId}}, set)
+}
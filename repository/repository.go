@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrNotFound is returned when no document matches the id or the filter
+var ErrNotFound = errors.New("document not found")
+
+// Repositories bundles the data access of the restaurant resources and of the staff accounts
+type Repositories struct {
+	Foods         FoodRepository
+	Menus         MenuRepository
+	Tables        TableRepository
+	Orders        OrderRepository
+	OrderItems    OrderItemRepository
+	Invoices      InvoiceRepository
+	Users         UserRepository
+	Devices       DeviceRepository
+	UserTokens    UserTokenRepository
+	LoginAttempts LoginAttemptRepository
+}
+
+// NewMongoRepositories serves the resources from the collections of db
+func NewMongoRepositories(db *mongo.Database) Repositories {
+	items, users, attempts := db.Collection("orderItem"), db.Collection("user"), db.Collection("loginAttempt")
+	return Repositories{
+		Foods:         foodRepository{store: mongoStore{db.Collection("food")}},
+		Menus:         menuRepository{store: mongoStore{db.Collection("menu")}},
+		Tables:        tableRepository{store: mongoStore{db.Collection("table")}},
+		Orders:        orderRepository{store: mongoStore{db.Collection("order")}},
+		OrderItems:    mongoOrderItemRepository{orderItemRepository{store: mongoStore{items}}, items},
+		Invoices:      invoiceRepository{store: mongoStore{db.Collection("invoice")}},
+		Users:         mongoUserRepository{userRepository{store: mongoStore{users}}, users, db.Collection("bootstrap")},
+		Devices:       deviceRepository{store: mongoStore{db.Collection("device")}},
+		UserTokens:    userTokenRepository{store: mongoStore{db.Collection("userToken")}},
+		LoginAttempts: mongoLoginAttemptRepository{loginAttemptRepository{store: mongoStore{attempts}}, attempts},
+	}
+}
+
+// NewMemoryRepositories keeps the resources in memory, for tests and local runs without MongoDB
+func NewMemoryRepositories() Repositories {
+	foods, orders, tables, items := newMemoryStore(), newMemoryStore(), newMemoryStore(), newMemoryStore()
+	return Repositories{
+		Foods:         foodRepository{store: foods},
+		Menus:         menuRepository{store: newMemoryStore()},
+		Tables:        tableRepository{store: tables},
+		Orders:        orderRepository{store: orders},
+		OrderItems:    memoryOrderItemRepository{orderItemRepository{store: items}, items, foods, orders, tables},
+		Invoices:      invoiceRepository{store: newMemoryStore()},
+		Users:         memoryUserRepository{userRepository{store: newMemoryStore()}, &sync.Mutex{}},
+		Devices:       deviceRepository{store: newMemoryStore()},
+		UserTokens:    userTokenRepository{store: newMemoryStore()},
+		LoginAttempts: memoryLoginAttemptRepository{loginAttemptRepository{store: newMemoryStore()}, &sync.Mutex{}},
+	}
+}
+
+// ListQuery is what a list endpoint fetches: the documents matching Filter, ordered by Sort,
+// with Projection applied to every returned document
+type ListQuery struct {
+	Filter     bson.D
+	Sort       bson.D
+	Projection bson.D
+}
+
+// Pagination is the page a list endpoint was asked for. Keyset paginated lists only use
+// Per_page and Cursor.
+type Pagination struct {
+	Page        int
+	Per_page    int
+	Start_index int
+	Cursor      *KeysetCursor
+}
+
+// KeysetCursor points between two documents of a list ordered by created_at and _id.
+// Backward cursors fetch the page before that position.
+type KeysetCursor struct {
+	Created_at time.Time          `json:"t"`
+	ID         primitive.ObjectID `json:"id"`
+	Backward   bool               `json:"b,omitempty"`
+}
+
+// KeysetPage is where the previous and the next page of a keyset paginated list start
+type KeysetPage struct {
+	Prev *KeysetCursor
+	Next *KeysetCursor
+}
+
+func (cursor KeysetCursor) Encode() string {
+	raw, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func DecodeKeysetCursor(value string) (*KeysetCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	var cursor KeysetCursor
+	if err = json.Unmarshal(raw, &cursor); err != nil || cursor.ID.IsZero() {
+		return nil, errors.New("invalid cursor")
+	}
+	return &cursor, nil
+}
@@ -0,0 +1,150 @@
+package repository
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// store is the part of a collection the repositories use. mongoStore and memoryStore implement it.
+type store interface {
+	find(c context.Context, filter bson.D, opts findOptions) ([]bson.M, error)
+	count(c context.Context, filter bson.D) (int64, error)
+	findOne(c context.Context, filter bson.D, result interface{}) error
+	insert(c context.Context, documents ...interface{}) error
+	// update sets the fields of the first matching document, ErrNotFound when nothing matches
+	update(c context.Context, filter bson.D, set bson.D) error
+	// delete removes every matching document
+	delete(c context.Context, filter bson.D) error
+}
+
+type findOptions struct {
+	sort       bson.D
+	skip       int64
+	limit      int64
+	projection bson.D
+}
+
+// paginate fetches the page p of query and counts all the matching documents
+func paginate(c context.Context, s store, query ListQuery, p Pagination) ([]bson.M, int64, error) {
+	filter := query.Filter
+	if filter == nil {
+		filter = bson.D{}
+	}
+	total, err := s.count(c, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	sort := query.Sort
+	if len(sort) == 0 {
+		sort = bson.D{{Key: "_id", Value: 1}}
+	}
+	items, err := s.find(c, filter, findOptions{
+		sort:       sort,
+		skip:       int64(p.Start_index),
+		limit:      int64(p.Per_page),
+		projection: query.Projection,
+	})
+	return items, total, err
+}
+
+// paginateByCursor fetches the page of query starting at the cursor of p. Unlike paginate it
+// never skips or counts documents, so its cost does not grow with the size of the collection.
+// The sort of query must start with created_at, _id always follows in the same direction.
+func paginateByCursor(c context.Context, s store, query ListQuery, p Pagination) ([]bson.M, KeysetPage, error) {
+	var page KeysetPage
+	order := 1
+	if len(query.Sort) > 0 && query.Sort[0].Key == "created_at" && query.Sort[0].Value == -1 {
+		order = -1
+	}
+	backward := p.Cursor != nil && p.Cursor.Backward
+	if backward {
+		order = -order
+	}
+
+	filter := append(bson.D{}, query.Filter...)
+	if p.Cursor != nil {
+		comparison := "$gt"
+		if order == -1 {
+			comparison = "$lt"
+		}
+		filter = append(filter, bson.E{Key: "$or", Value: bson.A{
+			bson.M{"created_at": bson.M{comparison: p.Cursor.Created_at}},
+			bson.M{"created_at": p.Cursor.Created_at, "_id": bson.M{comparison: p.Cursor.ID}},
+		}})
+	}
+
+	projection := query.Projection
+	// The cursors are built from created_at, whatever fields were asked for
+	if len(projection) > 0 && !projected(projection, "created_at") {
+		projection = append(append(bson.D{}, projection...), bson.E{Key: "created_at", Value: 1})
+	}
+	// One more than asked tells whether there is a page after this one
+	items, err := s.find(c, filter, findOptions{
+		sort:       bson.D{{Key: "created_at", Value: order}, {Key: "_id", Value: order}},
+		limit:      int64(p.Per_page + 1),
+		projection: projection,
+	})
+	if err != nil {
+		return nil, page, err
+	}
+	more := len(items) > p.Per_page
+	if more {
+		items = items[:p.Per_page]
+	}
+	if backward {
+		for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+			items[i], items[j] = items[j], items[i]
+		}
+	}
+	if len(items) == 0 {
+		return items, page, nil
+	}
+
+	first, last := keysetPosition(items[0]), keysetPosition(items[len(items)-1])
+	// Walking backward there is always a next page, the one the cursor came from
+	if more || backward {
+		page.Next = &last
+	}
+	if (more && backward) || (p.Cursor != nil && !backward) {
+		first.Backward = true
+		page.Prev = &first
+	}
+	return items, page, nil
+}
+
+func projected(projection bson.D, field string) bool {
+	for _, e := range projection {
+		if e.Key == field {
+			return true
+		}
+	}
+	return false
+}
+
+func keysetPosition(item bson.M) KeysetCursor {
+	var cursor KeysetCursor
+	if createdAt, ok := item["created_at"].(primitive.DateTime); ok {
+		cursor.Created_at = createdAt.Time().UTC()
+	}
+	if id, ok := item["_id"].(primitive.ObjectID); ok {
+		cursor.ID = id
+	}
+	return cursor
+}
+
+// decodeAll decodes documents into results, which must be a pointer to a slice
+func decodeAll(documents []bson.M, results interface{}) error {
+	raw, err := bson.Marshal(bson.M{"documents": documents})
+	if err != nil {
+		return err
+	}
+	var wrapper struct {
+		Documents bson.RawValue `bson:"documents"`
+	}
+	if err = bson.Unmarshal(raw, &wrapper); err != nil {
+		return err
+	}
+	return wrapper.Documents.Unmarshal(results)
+}
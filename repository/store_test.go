@@ -0,0 +1,143 @@
+package repository
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestKeysetCursorRoundTrip(t *testing.T) {
+	at := time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+	for _, cursor := range []KeysetCursor{
+		{Created_at: at, ID: primitive.NewObjectID()},
+		{Created_at: at, ID: primitive.NewObjectID(), Backward: true},
+	} {
+		decoded, err := DecodeKeysetCursor(cursor.Encode())
+		if err != nil {
+			t.Fatalf("DecodeKeysetCursor(%v) failed: %v", cursor, err)
+		}
+		if !decoded.Created_at.Equal(cursor.Created_at) || decoded.ID != cursor.ID || decoded.Backward != cursor.Backward {
+			t.Fatalf("decoded %v, want %v", *decoded, cursor)
+		}
+	}
+}
+
+func TestDecodeKeysetCursorRejects(t *testing.T) {
+	encode := func(raw string) string { return base64.RawURLEncoding.EncodeToString([]byte(raw)) }
+	valid := KeysetCursor{Created_at: time.Now(), ID: primitive.NewObjectID()}.Encode()
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{"not base64", "not a cursor!"},
+		{"not json", encode("offset:20")},
+		{"no id", encode(`{"t":"2024-03-01T12:30:00Z"}`)},
+		{"bad id", encode(`{"t":"2024-03-01T12:30:00Z","id":"zzz"}`)},
+		{"bad time", encode(`{"t":"yesterday","id":"65e1c1a0a1b2c3d4e5f60718"}`)},
+		{"tampered", valid[:len(valid)-3] + "xyz"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if cursor, err := DecodeKeysetCursor(tt.cursor); err == nil {
+				t.Fatalf("DecodeKeysetCursor(%q) = %v, want an error", tt.cursor, *cursor)
+			}
+		})
+	}
+}
+
+// seedKeyset stores n documents a minute apart, the documents 2 and 3 share a created_at.
+// It returns their ids in created_at then _id order.
+func seedKeyset(t *testing.T, n int) (store, []primitive.ObjectID) {
+	t.Helper()
+	s := newMemoryStore()
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	ids := make([]primitive.ObjectID, n)
+	for i := range ids {
+		ids[i] = primitive.NewObjectID()
+		at := start.Add(time.Duration(i) * time.Minute)
+		if i == 3 {
+			at = start.Add(2 * time.Minute)
+		}
+		if err := s.insert(context.Background(), bson.M{"_id": ids[i], "created_at": at}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return s, ids
+}
+
+func TestPaginateByCursor(t *testing.T) {
+	s, ids := seedKeyset(t, 5)
+	oldestFirst := ListQuery{Sort: bson.D{{Key: "created_at", Value: 1}}}
+	newestFirst := ListQuery{Sort: bson.D{{Key: "created_at", Value: -1}}}
+	position := func(i int, backward bool) *KeysetCursor {
+		item := bson.M{"_id": ids[i], "created_at": primitive.NewDateTimeFromTime(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC).Add(time.Duration(i) * time.Minute))}
+		if i == 3 {
+			item["created_at"] = primitive.NewDateTimeFromTime(time.Date(2024, 3, 1, 12, 2, 0, 0, time.UTC))
+		}
+		cursor := keysetPosition(item)
+		cursor.Backward = backward
+		return &cursor
+	}
+
+	tests := []struct {
+		name       string
+		query      ListQuery
+		perPage    int
+		cursor     *KeysetCursor
+		want       []int
+		prev, next bool
+	}{
+		{"first page", oldestFirst, 2, nil, []int{0, 1}, false, true},
+		{"across the tie", oldestFirst, 2, position(1, false), []int{2, 3}, true, true},
+		{"after the tie", oldestFirst, 2, position(2, false), []int{3, 4}, true, false},
+		{"last page", oldestFirst, 2, position(3, false), []int{4}, true, false},
+		{"past the end", oldestFirst, 2, position(4, false), []int{}, false, false},
+		{"whole list", oldestFirst, 5, nil, []int{0, 1, 2, 3, 4}, false, false},
+		{"back to the first page", oldestFirst, 2, position(2, true), []int{0, 1}, false, true},
+		{"back across the tie", oldestFirst, 2, position(4, true), []int{2, 3}, true, true},
+		{"newest first", newestFirst, 2, nil, []int{4, 3}, false, true},
+		{"newest first after the tie", newestFirst, 2, position(3, false), []int{2, 1}, true, true},
+		{"newest first back to the start", newestFirst, 2, position(2, true), []int{4, 3}, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items, page, err := paginateByCursor(context.Background(), s, tt.query, Pagination{Per_page: tt.perPage, Cursor: tt.cursor})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(items) != len(tt.want) {
+				t.Fatalf("got %d items, want %d", len(items), len(tt.want))
+			}
+			for i, want := range tt.want {
+				if items[i]["_id"] != ids[want] {
+					t.Fatalf("item %d is %v, want document %d", i, items[i]["_id"], want)
+				}
+			}
+			if (page.Prev != nil) != tt.prev || (page.Next != nil) != tt.next {
+				t.Fatalf("prev %v next %v, want prev %v next %v", page.Prev != nil, page.Next != nil, tt.prev, tt.next)
+			}
+			if page.Prev != nil && (!page.Prev.Backward || page.Prev.ID != items[0]["_id"]) {
+				t.Fatalf("prev = %v, want a backward cursor on the first item", *page.Prev)
+			}
+			if page.Next != nil && (page.Next.Backward || page.Next.ID != items[len(items)-1]["_id"]) {
+				t.Fatalf("next = %v, want a forward cursor on the last item", *page.Next)
+			}
+		})
+	}
+}
+
+func TestPaginateByCursorKeepsCreatedAtInProjections(t *testing.T) {
+	s, ids := seedKeyset(t, 3)
+	query := ListQuery{Projection: bson.D{{Key: "name", Value: 1}}}
+	_, page, err := paginateByCursor(context.Background(), s, query, Pagination{Per_page: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Next == nil || page.Next.ID != ids[0] || page.Next.Created_at.IsZero() {
+		t.Fatalf("next = %v, want the position of the first document", page.Next)
+	}
+}
@@ -0,0 +1,38 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/PranavMasekar/restaurant-management/models"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// TableRepository stores the tables of the restaurant
+type TableRepository interface {
+	List(c context.Context, query ListQuery, p Pagination) ([]bson.M, int64, error)
+	FindById(c context.Context, tableId string) (models.Table, error)
+	Create(c context.Context, table models.Table) error
+	// Update sets the given fields, ErrNotFound when there is no such table
+	Update(c context.Context, tableId string, set bson.D) error
+}
+
+type tableRepository struct {
+	store store
+}
+
+func (r tableRepository) List(c context.Context, query ListQuery, p Pagination) ([]bson.M, int64, error) {
+	return paginate(c, r.store, query, p)
+}
+
+func (r tableRepository) FindById(c context.Context, tableId string) (table models.Table, err error) {
+	err = r.store.findOne(c, bson.D{{Key: "table_id", Value: tableId}}, &table)
+	return table, err
+}
+
+func (r tableRepository) Create(c context.Context, table models.Table) error {
+	return r.store.insert(c, table)
+}
+
+func (r tableRepository) Update(c context.Context, tableId string, set bson.D) error {
+	return r.store.update(c, bson.D{{Key: "table_id", Value: tableId}}, set)
+}
@@ -0,0 +1,432 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/PranavMasekar/restaurant-management/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// UserRepository stores the staff accounts along with their login sessions
+type UserRepository interface {
+	List(c context.Context, query ListQuery, p Pagination) ([]models.User, int64, error)
+	FindById(c context.Context, userId string) (models.User, error)
+	FindByEmail(c context.Context, email string) (models.User, error)
+	// Count returns the number of users, deactivated ones included
+	Count(c context.Context) (int64, error)
+	// EmailOrPhoneTaken tells whether another user than exceptUserId already uses the email or the phone
+	EmailOrPhoneTaken(c context.Context, email *string, phone *string, exceptUserId string) (bool, error)
+	Create(c context.Context, user models.User) error
+	// CreateFirstUser stores user only when the service has no user yet, false otherwise. Of
+	// concurrent calls on an empty database a single one succeeds.
+	CreateFirstUser(c context.Context, user models.User) (bool, error)
+	// Update sets the given fields, ErrNotFound when there is no such user
+	Update(c context.Context, userId string, set bson.D) error
+
+	// SaveSession stores the tokens of a login on the user and its session, whose Refresh_token
+	// is the refresh token handed out. Sessions that can no longer be refreshed are dropped.
+	SaveSession(c context.Context, userId string, session models.Session, token string) error
+	// RotateRefreshToken replaces the refresh token of the session by the one of session, but only
+	// while oldRefreshToken is still the current one and the session is not revoked. It returns
+	// false when another request already rotated it.
+	RotateRefreshToken(c context.Context, userId string, session models.Session, oldRefreshToken string, token string) (bool, error)
+	// RevokeSession marks a session as revoked, false when the user has no such session
+	RevokeSession(c context.Context, userId string, sessionId string) (bool, error)
+	// RevokeAllSessions bumps the token version, which invalidates every access token already
+	// handed out, and revokes all the sessions. It returns false when there is no such user.
+	RevokeAllSessions(c context.Context, userId string) (bool, error)
+	// UseTotpStep records the time step of a TOTP code, false when a code of that step or a
+	// later one was already used
+	UseTotpStep(c context.Context, userId string, step int64) (bool, error)
+	// UseRecoveryCode removes the recovery code with the hash, false when the user does not have it
+	UseRecoveryCode(c context.Context, userId string, hash string) (bool, error)
+}
+
+type userRepository struct {
+	store store
+}
+
+func (r userRepository) List(c context.Context, query ListQuery, p Pagination) ([]models.User, int64, error) {
+	documents, total, err := paginate(c, r.store, query, p)
+	if err != nil {
+		return nil, 0, err
+	}
+	users := []models.User{}
+	return users, total, decodeAll(documents, &users)
+}
+
+func (r userRepository) FindById(c context.Context, userId string) (user models.User, err error) {
+	err = r.store.findOne(c, bson.D{{Key: "user_id", Value: userId}}, &user)
+	return user, err
+}
+
+func (r userRepository) FindByEmail(c context.Context, email string) (user models.User, err error) {
+	err = r.store.findOne(c, bson.D{{Key: "email", Value: email}}, &user)
+	return user, err
+}
+
+func (r userRepository) Count(c context.Context) (int64, error) {
+	return r.store.count(c, bson.D{})
+}
+
+func (r userRepository) EmailOrPhoneTaken(c context.Context, email *string, phone *string, exceptUserId string) (bool, error) {
+	or := bson.A{}
+	if email != nil {
+		or = append(or, bson.D{{Key: "email", Value: *email}})
+	}
+	if phone != nil {
+		or = append(or, bson.D{{Key: "phone", Value: *phone}})
+	}
+	if len(or) == 0 {
+		return false, nil
+	}
+	count, err := r.store.count(c, bson.D{
+		{Key: "$or", Value: or},
+		{Key: "user_id", Value: bson.D{{Key: "$ne", Value: exceptUserId}}},
+	})
+	return count > 0, err
+}
+
+func (r userRepository) Create(c context.Context, user models.User) error {
+	return r.store.insert(c, user)
+}
+
+func (r userRepository) Update(c context.Context, userId string, set bson.D) error {
+	return r.store.update(c, bson.D{{Key: "user_id", Value: userId}}, set)
+}
+
+type mongoUserRepository struct {
+	userRepository
+	collection *mongo.Collection
+	// bootstrap holds the one document claiming the creation of the first user
+	bootstrap *mongo.Collection
+}
+
+// firstUserClaim is the fixed _id of the bootstrap document, its uniqueness serializes the
+// creations of the first user
+const firstUserClaim = "first_user"
+
+func (r mongoUserRepository) CreateFirstUser(c context.Context, user models.User) (bool, error) {
+	_, err := r.bootstrap.InsertOne(c, bson.D{{Key: "_id", Value: firstUserClaim}, {Key: "user_id", Value: user.User_id}})
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	// Databases that had users before the claim was introduced keep it and stay closed
+	count, err := r.Count(c)
+	if err != nil || count > 0 {
+		return false, err
+	}
+	if err := r.Create(c, user); err != nil {
+		// Give the next attempt its chance
+		if _, deleteErr := r.bootstrap.DeleteOne(c, bson.D{{Key: "_id", Value: firstUserClaim}}); deleteErr != nil {
+			return false, deleteErr
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (r mongoUserRepository) SaveSession(c context.Context, userId string, session models.Session, token string) error {
+	_, err := r.collection.UpdateOne(
+		c,
+		bson.M{"user_id": userId},
+		bson.D{{Key: "$set", Value: bson.D{
+			{Key: "token", Value: token},
+			{Key: "refresh_token", Value: session.Refresh_token},
+			{Key: "updated_at", Value: session.Updated_at},
+		}}},
+	)
+	if err != nil {
+		return err
+	}
+	result, err := r.collection.UpdateOne(
+		c,
+		bson.M{"user_id": userId, "sessions.session_id": session.Session_id},
+		bson.D{
+			{Key: "$set", Value: bson.D{
+				{Key: "sessions.$.refresh_token", Value: session.Refresh_token},
+				{Key: "sessions.$.updated_at", Value: session.Updated_at},
+				{Key: "sessions.$.expires_at", Value: session.Expires_at},
+			}},
+		},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount > 0 {
+		return nil
+	}
+	// Drop sessions that can no longer be refreshed before adding the new one
+	_, err = r.collection.UpdateOne(
+		c,
+		bson.M{"user_id": userId},
+		bson.D{{Key: "$pull", Value: bson.M{"sessions": bson.M{"expires_at": bson.M{"$lt": session.Updated_at}}}}},
+	)
+	if err != nil {
+		return err
+	}
+	_, err = r.collection.UpdateOne(
+		c,
+		bson.M{"user_id": userId},
+		bson.D{{Key: "$push", Value: bson.M{"sessions": session}}},
+	)
+	return err
+}
+
+func (r mongoUserRepository) RotateRefreshToken(c context.Context, userId string, session models.Session, oldRefreshToken string, token string) (bool, error) {
+	filter := bson.M{
+		"user_id": userId,
+		"sessions": bson.M{"$elemMatch": bson.M{
+			"session_id":    session.Session_id,
+			"refresh_token": oldRefreshToken,
+			"revoked":       false,
+		}},
+	}
+	result, err := r.collection.UpdateOne(
+		c,
+		filter,
+		bson.D{
+			{Key: "$set", Value: bson.D{
+				{Key: "token", Value: token},
+				{Key: "refresh_token", Value: session.Refresh_token},
+				{Key: "updated_at", Value: session.Updated_at},
+				{Key: "sessions.$.refresh_token", Value: session.Refresh_token},
+				{Key: "sessions.$.updated_at", Value: session.Updated_at},
+				{Key: "sessions.$.expires_at", Value: session.Expires_at},
+			}},
+		},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+func (r mongoUserRepository) RevokeSession(c context.Context, userId string, sessionId string) (bool, error) {
+	updated_at, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	result, err := r.collection.UpdateOne(
+		c,
+		bson.M{"user_id": userId, "sessions.session_id": sessionId},
+		bson.D{
+			{Key: "$set", Value: bson.D{
+				{Key: "sessions.$.revoked", Value: true},
+				{Key: "sessions.$.updated_at", Value: updated_at},
+			}},
+		},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
+
+func (r mongoUserRepository) RevokeAllSessions(c context.Context, userId string) (bool, error) {
+	updated_at, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	result, err := r.collection.UpdateOne(
+		c,
+		bson.M{"user_id": userId},
+		bson.D{
+			{Key: "$inc", Value: bson.M{"token_version": 1}},
+			{Key: "$set", Value: bson.D{
+				{Key: "updated_at", Value: updated_at},
+			}},
+			{Key: "$unset", Value: bson.D{
+				{Key: "token", Value: ""},
+				{Key: "refresh_token", Value: ""},
+			}},
+		},
+	)
+	if err != nil {
+		return false, err
+	}
+	// Users who have not logged in since sessions were introduced have no sessions array to update
+	_, err = r.collection.UpdateOne(
+		c,
+		bson.M{"user_id": userId, "sessions": bson.M{"$type": "array"}},
+		bson.D{
+			{Key: "$set", Value: bson.D{
+				{Key: "sessions.$[].revoked", Value: true},
+				{Key: "sessions.$[].updated_at", Value: updated_at},
+			}},
+		},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
+
+func (r mongoUserRepository) UseTotpStep(c context.Context, userId string, step int64) (bool, error) {
+	result, err := r.collection.UpdateOne(
+		c,
+		bson.M{"user_id": userId, "totp_last_step": bson.M{"$lt": step}},
+		bson.M{"$set": bson.M{"totp_last_step": step}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+func (r mongoUserRepository) UseRecoveryCode(c context.Context, userId string, hash string) (bool, error) {
+	result, err := r.collection.UpdateOne(
+		c,
+		bson.M{"user_id": userId, "recovery_codes": hash},
+		bson.M{"$pull": bson.M{"recovery_codes": hash}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+// memoryUserRepository does in Go what the update operators of mongoUserRepository do. The
+// users are read, changed and written back under mu, so concurrent changes do not overwrite
+// each other.
+type memoryUserRepository struct {
+	userRepository
+	mu *sync.Mutex
+}
+
+// change applies fn to the user and stores the result. It returns false, leaving the user as it
+// was, when there is no such user or fn returns false.
+func (r memoryUserRepository) change(c context.Context, userId string, fn func(user *models.User) bool) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	user, err := r.FindById(c, userId)
+	if err == ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if !fn(&user) {
+		return false, nil
+	}
+	set, err := fields(user)
+	if err != nil {
+		return false, err
+	}
+	return true, r.Update(c, userId, set)
+}
+
+func (r memoryUserRepository) CreateFirstUser(c context.Context, user models.User) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	count, err := r.Count(c)
+	if err != nil || count > 0 {
+		return false, err
+	}
+	return true, r.Create(c, user)
+}
+
+func (r memoryUserRepository) SaveSession(c context.Context, userId string, session models.Session, token string) error {
+	_, err := r.change(c, userId, func(user *models.User) bool {
+		user.Token, user.RefreshToken = &token, &session.Refresh_token
+		user.Updated_at = session.Updated_at
+		if existing := findSession(user, session.Session_id); existing != nil {
+			existing.Refresh_token = session.Refresh_token
+			existing.Updated_at = session.Updated_at
+			existing.Expires_at = session.Expires_at
+			return true
+		}
+		sessions := []models.Session{}
+		for _, kept := range user.Sessions {
+			if !kept.Expires_at.Before(session.Updated_at) {
+				sessions = append(sessions, kept)
+			}
+		}
+		user.Sessions = append(sessions, session)
+		return true
+	})
+	return err
+}
+
+func (r memoryUserRepository) RotateRefreshToken(c context.Context, userId string, session models.Session, oldRefreshToken string, token string) (bool, error) {
+	return r.change(c, userId, func(user *models.User) bool {
+		current := findSession(user, session.Session_id)
+		if current == nil || current.Revoked || current.Refresh_token != oldRefreshToken {
+			return false
+		}
+		user.Token, user.RefreshToken = &token, &session.Refresh_token
+		user.Updated_at = session.Updated_at
+		current.Refresh_token = session.Refresh_token
+		current.Updated_at = session.Updated_at
+		current.Expires_at = session.Expires_at
+		return true
+	})
+}
+
+func (r memoryUserRepository) RevokeSession(c context.Context, userId string, sessionId string) (bool, error) {
+	updated_at, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	return r.change(c, userId, func(user *models.User) bool {
+		session := findSession(user, sessionId)
+		if session == nil {
+			return false
+		}
+		session.Revoked = true
+		session.Updated_at = updated_at
+		return true
+	})
+}
+
+func (r memoryUserRepository) RevokeAllSessions(c context.Context, userId string) (bool, error) {
+	updated_at, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+	return r.change(c, userId, func(user *models.User) bool {
+		user.Token_version++
+		user.Token, user.RefreshToken = nil, nil
+		user.Updated_at = updated_at
+		for i := range user.Sessions {
+			user.Sessions[i].Revoked = true
+			user.Sessions[i].Updated_at = updated_at
+		}
+		return true
+	})
+}
+
+func (r memoryUserRepository) UseTotpStep(c context.Context, userId string, step int64) (bool, error) {
+	return r.change(c, userId, func(user *models.User) bool {
+		if user.Totp_last_step >= step {
+			return false
+		}
+		user.Totp_last_step = step
+		return true
+	})
+}
+
+func (r memoryUserRepository) UseRecoveryCode(c context.Context, userId string, hash string) (bool, error) {
+	return r.change(c, userId, func(user *models.User) bool {
+		for i, code := range user.Recovery_codes {
+			if code == hash {
+				user.Recovery_codes = append(user.Recovery_codes[:i], user.Recovery_codes[i+1:]...)
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func findSession(user *models.User, sessionId string) *models.Session {
+	for i := range user.Sessions {
+		if user.Sessions[i].Session_id == sessionId {
+			return &user.Sessions[i]
+		}
+	}
+	return nil
+}
+
+// fields lists the fields of document, to write all of them back with an update
+func fields(document interface{}) (bson.D, error) {
+	raw, err := bson.Marshal(document)
+	if err != nil {
+		return nil, err
+	}
+	var set bson.D
+	return set, bson.Unmarshal(raw, &set)
+}
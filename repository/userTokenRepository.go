@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/PranavMasekar/restaurant-management/models"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// UserTokenRepository stores the single-use tokens mailed to the users
+type UserTokenRepository interface {
+	// Replace stores token and deletes the unused tokens the user had for the same purpose
+	Replace(c context.Context, token models.UserToken) error
+	// Consume marks the unused and unexpired token with the hash as used at at and returns it,
+	// ErrNotFound when there is no such token
+	Consume(c context.Context, tokenHash string, purpose string, at time.Time) (models.UserToken, error)
+}
+
+type userTokenRepository struct {
+	store store
+}
+
+func (r userTokenRepository) Replace(c context.Context, token models.UserToken) error {
+	err := r.store.delete(c, bson.D{
+		{Key: "user_id", Value: token.User_id},
+		{Key: "purpose", Value: token.Purpose},
+		{Key: "used_at", Value: nil},
+	})
+	if err != nil {
+		return err
+	}
+	return r.store.insert(c, token)
+}
+
+func (r userTokenRepository) Consume(c context.Context, tokenHash string, purpose string, at time.Time) (token models.UserToken, err error) {
+	err = r.store.findOne(c, bson.D{
+		{Key: "token_hash", Value: tokenHash},
+		{Key: "purpose", Value: purpose},
+		{Key: "used_at", Value: nil},
+		{Key: "expires_at", Value: bson.D{{Key: "$gt", Value: at}}},
+	}, &token)
+	if err != nil {
+		return token, err
+	}
+	// Only the request that still finds the token unused gets to consume it
+	err = r.store.update(c, bson.D{
+		{Key: "_id", Value: token.ID},
+		{Key: "used_at", Value: nil},
+	}, bson.D{{Key: "used_at", Value: at}})
+	token.Used_at = &at
+	return token, err
+}
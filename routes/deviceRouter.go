@@ -0,0 +1,13 @@
+package routes
+
+import (
+	"github.com/PranavMasekar/restaurant-management/controllers"
+	"github.com/PranavMasekar/restaurant-management/middleware"
+	"github.com/gin-gonic/gin"
+)
+
+func DeviceRoutes(incomingRoutes *gin.Engine, handler *controllers.DeviceHandler) {
+	incomingRoutes.GET("/devices", middleware.Authorize(management...), handler.GetDevices())
+	incomingRoutes.POST("/devices", middleware.Authorize(management...), handler.RegisterDevice())
+	incomingRoutes.DELETE("/devices/:device_id", middleware.Authorize(management...), handler.RevokeDevice())
+}
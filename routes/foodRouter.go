@@ -2,12 +2,13 @@ package routes
 
 import (
 	"github.com/PranavMasekar/restaurant-management/controllers"
+	"github.com/PranavMasekar/restaurant-management/middleware"
 	"github.com/gin-gonic/gin"
 )
 
-func FoodRoutes(incomingRoutes *gin.Engine) {
-	incomingRoutes.GET("/foods", controllers.GetFoods())
-	incomingRoutes.GET("/foods/:food_id", controllers.GetFood())
-	incomingRoutes.POST("/foods", controllers.CreateFood())
-	incomingRoutes.PATCH("/foods/:food_id", controllers.UpdateFood())
+func FoodRoutes(incomingRoutes *gin.Engine, handler *controllers.FoodHandler) {
+	incomingRoutes.GET("/foods", middleware.AuthorizeTerminal(allStaff...), handler.GetFoods())
+	incomingRoutes.GET("/foods/:food_id", middleware.AuthorizeTerminal(allStaff...), handler.GetFood())
+	incomingRoutes.POST("/foods", middleware.Authorize(management...), handler.CreateFood())
+	incomingRoutes.PATCH("/foods/:food_id", middleware.Authorize(management...), handler.UpdateFood())
 }
@@ -0,0 +1,12 @@
+package routes
+
+import (
+	"github.com/PranavMasekar/restaurant-management/controllers"
+	"github.com/gin-gonic/gin"
+)
+
+// HealthRoutes registers the probes, they are public and must stay cheap
+func HealthRoutes(incomingRoutes *gin.Engine, handler *controllers.HealthHandler) {
+	incomingRoutes.GET("/healthz", handler.Healthz())
+	incomingRoutes.GET("/readyz", handler.Readyz())
+}
@@ -2,12 +2,13 @@ package routes
 
 import (
 	"github.com/PranavMasekar/restaurant-management/controllers"
+	"github.com/PranavMasekar/restaurant-management/middleware"
 	"github.com/gin-gonic/gin"
 )
 
-func InvoiceRoutes(incomingRoutes *gin.Engine) {
-	incomingRoutes.GET("/invoices", controllers.GetInvoices())
-	incomingRoutes.GET("/invoices/:invoice_id", controllers.GetInvoice())
-	incomingRoutes.POST("/invoices", controllers.CreateInvoice())
-	incomingRoutes.PATCH("/invoices/:invoice_id", controllers.UpdateInvoice())
+func InvoiceRoutes(incomingRoutes *gin.Engine, handler *controllers.InvoiceHandler) {
+	incomingRoutes.GET("/invoices", middleware.AuthorizeTerminal(billing...), handler.GetInvoices())
+	incomingRoutes.GET("/invoices/:invoice_id", middleware.AuthorizeTerminal(billing...), handler.GetInvoice())
+	incomingRoutes.POST("/invoices", middleware.AuthorizeTerminal(billing...), handler.CreateInvoice())
+	incomingRoutes.PATCH("/invoices/:invoice_id", middleware.Authorize(cashiers...), handler.UpdateInvoice())
 }
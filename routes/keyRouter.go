@@ -0,0 +1,10 @@
+package routes
+
+import (
+	"github.com/PranavMasekar/restaurant-management/controllers"
+	"github.com/gin-gonic/gin"
+)
+
+func KeyRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/.well-known/jwks.json", controllers.GetJWKS())
+}
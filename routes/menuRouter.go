@@ -2,12 +2,14 @@ package routes
 
 import (
 	"github.com/PranavMasekar/restaurant-management/controllers"
+	"github.com/PranavMasekar/restaurant-management/middleware"
 	"github.com/gin-gonic/gin"
 )
 
-func MenuRoutes(incomingRoutes *gin.Engine) {
-	incomingRoutes.GET("/menus", controllers.GetMenues())
-	incomingRoutes.GET("/menus/:menu_id", controllers.GetMenu())
-	incomingRoutes.POST("/menus", controllers.CreateMenu())
-	incomingRoutes.PATCH("/menus/:menu_id", controllers.UpdateMenu())
+func MenuRoutes(incomingRoutes *gin.Engine, handler *controllers.MenuHandler) {
+	incomingRoutes.GET("/menus", middleware.AuthorizeTerminal(allStaff...), handler.GetMenues())
+	incomingRoutes.GET("/menus/active", middleware.AuthorizeTerminal(allStaff...), handler.GetActiveMenus())
+	incomingRoutes.GET("/menus/:menu_id", middleware.AuthorizeTerminal(allStaff...), handler.GetMenu())
+	incomingRoutes.POST("/menus", middleware.Authorize(management...), handler.CreateMenu())
+	incomingRoutes.PATCH("/menus/:menu_id", middleware.Authorize(management...), handler.UpdateMenu())
 }
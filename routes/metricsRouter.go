@@ -0,0 +1,12 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// MetricsRoutes exposes the Prometheus metrics. Like the probes they are meant for the cluster,
+// keep /metrics out of the public ingress.
+func MetricsRoutes(incomingRoutes *gin.Engine) {
+	incomingRoutes.GET("/metrics", gin.WrapH(promhttp.Handler()))
+}
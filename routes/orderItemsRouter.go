@@ -2,13 +2,14 @@ package routes
 
 import (
 	"github.com/PranavMasekar/restaurant-management/controllers"
+	"github.com/PranavMasekar/restaurant-management/middleware"
 	"github.com/gin-gonic/gin"
 )
 
-func OrderItemRoutes(incomingRoutes *gin.Engine) {
-	incomingRoutes.GET("/orderItems", controllers.GetOrderItems())
-	incomingRoutes.GET("/orderItems/:orderItem_id", controllers.GetOrderItem())
-	incomingRoutes.GET("/orderItems-order/:order_id", controllers.GetOrderItemsByOrder())
-	incomingRoutes.POST("/orderItems", controllers.CreateOrderItem())
-	incomingRoutes.PATCH("/orderItems/:orderItem_id", controllers.UpdateOrderItem())
+func OrderItemRoutes(incomingRoutes *gin.Engine, handler *controllers.OrderItemHandler) {
+	incomingRoutes.GET("/orderItems", middleware.AuthorizeTerminal(allStaff...), handler.GetOrderItems())
+	incomingRoutes.GET("/orderItems/:order_item_id", middleware.AuthorizeTerminal(allStaff...), handler.GetOrderItem())
+	incomingRoutes.GET("/orderItems-order/:order_id", middleware.AuthorizeTerminal(allStaff...), handler.GetOrderItemsByOrder())
+	incomingRoutes.POST("/orderItems", middleware.AuthorizeTerminal(floorStaff...), handler.CreateOrderItem())
+	incomingRoutes.PATCH("/orderItems/:order_item_id", middleware.AuthorizeTerminal(serviceStaff...), handler.UpdateOrderItem())
 }
@@ -2,12 +2,13 @@ package routes
 
 import (
 	"github.com/PranavMasekar/restaurant-management/controllers"
+	"github.com/PranavMasekar/restaurant-management/middleware"
 	"github.com/gin-gonic/gin"
 )
 
-func OrderRoutes(incomingRoutes *gin.Engine) {
-	incomingRoutes.GET("/orders", controllers.GetOrders())
-	incomingRoutes.GET("/orders/:order_id", controllers.GetOrder())
-	incomingRoutes.POST("/orders", controllers.CreateOrder())
-	incomingRoutes.PATCH("/orders/:order_id", controllers.UpdateOrder())
+func OrderRoutes(incomingRoutes *gin.Engine, handler *controllers.OrderHandler) {
+	incomingRoutes.GET("/orders", middleware.AuthorizeTerminal(allStaff...), handler.GetOrders())
+	incomingRoutes.GET("/orders/:order_id", middleware.AuthorizeTerminal(allStaff...), handler.GetOrder())
+	incomingRoutes.POST("/orders", middleware.AuthorizeTerminal(floorStaff...), handler.CreateOrder())
+	incomingRoutes.PATCH("/orders/:order_id", middleware.AuthorizeTerminal(floorStaff...), handler.UpdateOrder())
 }
@@ -0,0 +1,13 @@
+package routes
+
+import "github.com/PranavMasekar/restaurant-management/models"
+
+// Role sets used by the route policies in this package
+var (
+	allStaff     = []string{models.RoleAdmin, models.RoleManager, models.RoleWaiter, models.RoleKitchen, models.RoleCashier}
+	management   = []string{models.RoleAdmin, models.RoleManager}
+	floorStaff   = []string{models.RoleAdmin, models.RoleManager, models.RoleWaiter}
+	serviceStaff = []string{models.RoleAdmin, models.RoleManager, models.RoleWaiter, models.RoleKitchen}
+	billing      = []string{models.RoleAdmin, models.RoleManager, models.RoleWaiter, models.RoleCashier}
+	cashiers     = []string{models.RoleAdmin, models.RoleManager, models.RoleCashier}
+)
@@ -2,12 +2,13 @@ package routes
 
 import (
 	"github.com/PranavMasekar/restaurant-management/controllers"
+	"github.com/PranavMasekar/restaurant-management/middleware"
 	"github.com/gin-gonic/gin"
 )
 
-func TableRoutes(incomingRoutes *gin.Engine) {
-	incomingRoutes.GET("/tables", controllers.GetTables())
-	incomingRoutes.GET("/tables/:table_id", controllers.GetTable())
-	incomingRoutes.POST("/tables", controllers.CreateTable())
-	incomingRoutes.POST("/tables/:table_id", controllers.UpdateTable())
+func TableRoutes(incomingRoutes *gin.Engine, handler *controllers.TableHandler) {
+	incomingRoutes.GET("/tables", middleware.AuthorizeTerminal(allStaff...), handler.GetTables())
+	incomingRoutes.GET("/tables/:table_id", middleware.AuthorizeTerminal(allStaff...), handler.GetTable())
+	incomingRoutes.POST("/tables", middleware.Authorize(management...), handler.CreateTable())
+	incomingRoutes.POST("/tables/:table_id", middleware.Authorize(management...), handler.UpdateTable())
 }
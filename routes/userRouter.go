@@ -2,13 +2,45 @@ package routes
 
 import (
 	"github.com/PranavMasekar/restaurant-management/controllers"
+	"github.com/PranavMasekar/restaurant-management/middleware"
+	"github.com/PranavMasekar/restaurant-management/models"
 	"github.com/gin-gonic/gin"
 )
 
-func UserRoutes(incomingRoutes *gin.Engine) {
-	incomingRoutes.GET("/users", controllers.GetUsers())
-	incomingRoutes.GET("/users/:user_id", controllers.GetUser())
-	incomingRoutes.POST("/users/signup", controllers.SignUp())
-	incomingRoutes.POST("/users/login", controllers.Login())
+func UserRoutes(incomingRoutes *gin.Engine, handler *controllers.UserHandler, auth *middleware.Authenticator) {
+	incomingRoutes.POST("/users/bootstrap", handler.Bootstrap())
+	incomingRoutes.POST("/users/login", handler.Login())
+	incomingRoutes.POST("/users/pin-login", handler.PinLogin())
+	incomingRoutes.POST("/users/refresh", handler.RefreshToken())
+	incomingRoutes.POST("/users/password/forgot", handler.ForgotPassword())
+	incomingRoutes.POST("/users/password/reset", handler.ResetPassword())
+	incomingRoutes.POST("/users/verify-email", handler.VerifyEmail())
 
+	// Registered before the global Authentication middleware, so these authenticate themselves.
+	// Authorize(allStaff...) keeps POS scoped tokens away from the self-service routes.
+	incomingRoutes.POST("/users/signup", auth.Authentication(), middleware.Authorize(management...), handler.SignUp())
+	incomingRoutes.GET("/users", auth.Authentication(), middleware.Authorize(management...), handler.GetUsers())
+	incomingRoutes.GET("/users/me", auth.Authentication(), middleware.Authorize(allStaff...), handler.GetUser())
+	incomingRoutes.PATCH("/users/me", auth.Authentication(), middleware.Authorize(allStaff...), handler.UpdateUser())
+	incomingRoutes.POST("/users/me/password", auth.Authentication(), middleware.Authorize(allStaff...), handler.ChangePassword())
+	incomingRoutes.GET("/users/:user_id", auth.Authentication(), middleware.AuthorizeSelfOr("user_id", management...), handler.GetUser())
+	incomingRoutes.PATCH("/users/:user_id", auth.Authentication(), middleware.AuthorizeSelfOr("user_id", management...), handler.UpdateUser())
+	incomingRoutes.DELETE("/users/:user_id", auth.Authentication(), middleware.Authorize(management...), handler.DeactivateUser())
+	incomingRoutes.POST("/users/:user_id/reactivate", auth.Authentication(), middleware.Authorize(management...), handler.ReactivateUser())
+	incomingRoutes.PATCH("/users/:user_id/role", auth.Authentication(), middleware.Authorize(models.RoleAdmin), handler.UpdateUserRole())
+	incomingRoutes.POST("/users/logout", auth.EnrollmentAuthentication(), handler.Logout())
+	incomingRoutes.POST("/users/logout-all", auth.EnrollmentAuthentication(), handler.LogoutAll())
+	incomingRoutes.POST("/users/2fa/setup", auth.EnrollmentAuthentication(), middleware.Authorize(allStaff...), handler.SetupTwoFactor())
+	incomingRoutes.POST("/users/2fa/enable", auth.EnrollmentAuthentication(), middleware.Authorize(allStaff...), handler.EnableTwoFactor())
+	incomingRoutes.POST("/users/2fa/disable", auth.Authentication(), middleware.Authorize(allStaff...), handler.DisableTwoFactor())
+	incomingRoutes.POST("/users/2fa/recovery-codes", auth.Authentication(), middleware.Authorize(allStaff...), handler.RegenerateRecoveryCodes())
+	incomingRoutes.DELETE("/users/:user_id/2fa", auth.Authentication(), middleware.Authorize(models.RoleAdmin), handler.ResetTwoFactor())
+	incomingRoutes.POST("/users/verify-email/resend", auth.Authentication(), middleware.Authorize(allStaff...), handler.ResendVerificationEmail())
+	incomingRoutes.POST("/users/:user_id/pin", auth.Authentication(), middleware.AuthorizeSelfOr("user_id"), handler.SetPin())
+	incomingRoutes.DELETE("/users/:user_id/pin", auth.Authentication(), middleware.AuthorizeSelfOr("user_id", management...), handler.RemovePin())
+	incomingRoutes.GET("/users/:user_id/lockout", auth.Authentication(), middleware.Authorize(management...), handler.GetUserLockout())
+	incomingRoutes.DELETE("/users/:user_id/lockout", auth.Authentication(), middleware.Authorize(management...), handler.UnlockUser())
+	incomingRoutes.GET("/users/:user_id/sessions", auth.Authentication(), middleware.AuthorizeSelfOr("user_id", management...), handler.GetUserSessions())
+	incomingRoutes.DELETE("/users/:user_id/sessions", auth.Authentication(), middleware.AuthorizeSelfOr("user_id", management...), handler.RevokeUserSessions())
+	incomingRoutes.DELETE("/users/:user_id/sessions/:session_id", auth.Authentication(), middleware.AuthorizeSelfOr("user_id", management...), handler.RevokeUserSession())
 }
@@ -0,0 +1,52 @@
+package tracing
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/PranavMasekar/restaurant-management/config"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func TestSetup(t *testing.T) {
+	tests := []struct {
+		exporter  string
+		recording bool
+		fails     bool
+	}{
+		{"none", false, false},
+		{"stdout", true, false},
+		{"jaeger", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.exporter, func(t *testing.T) {
+			provider, propagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+			defer func() {
+				// Setting the global provider to itself only logs a warning
+				if otel.GetTracerProvider() != provider {
+					otel.SetTracerProvider(provider)
+				}
+				otel.SetTextMapPropagator(propagator)
+			}()
+
+			shutdown, err := Setup(context.Background(), config.Tracing{Exporter: tt.exporter, Service_name: "test", Sample_ratio: 1})
+			if (err != nil) != tt.fails {
+				t.Fatalf("Setup() = %v, want failure %v", err, tt.fails)
+			}
+			if err != nil {
+				return
+			}
+			defer shutdown(context.Background())
+			if _, ok := otel.GetTracerProvider().(*sdktrace.TracerProvider); ok != tt.recording {
+				t.Fatalf("provider = %T, want an SDK provider %v", otel.GetTracerProvider(), tt.recording)
+			}
+			// Callers' trace contexts are continued whatever the exporter
+			fields := otel.GetTextMapPropagator().Fields()
+			if !strings.Contains(strings.Join(fields, " "), "traceparent") {
+				t.Fatalf("propagated fields = %v, want the W3C trace context", fields)
+			}
+		})
+	}
+}